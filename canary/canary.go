@@ -0,0 +1,149 @@
+// Package canary periodically writes a tiny synthetic trace and reads it
+// back, measuring end-to-end read-after-write latency. A failing canary
+// catches token expiry and schema breakage before users do.
+package canary
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+const (
+	// serviceName identifies canary spans, so they can be filtered out of
+	// searches and retention policies.
+	serviceName = "jaeger-influxdb-canary"
+
+	// readBackTimeout bounds how long one probe polls for its trace to become
+	// readable; writes are batched, so the first poll usually misses.
+	readBackTimeout = 30 * time.Second
+
+	readBackPollInterval = 500 * time.Millisecond
+)
+
+// Result describes the most recent canary probe.
+type Result struct {
+	// Latency is the time from write to first successful read back.
+	Latency     time.Duration
+	LastSuccess time.Time
+	LastError   error
+}
+
+// Canary periodically writes one synthetic trace and polls until it can be
+// read back, retaining the latest result for health reporting.
+type Canary struct {
+	reader   spanstore.Reader
+	writer   spanstore.Writer
+	interval time.Duration
+
+	mu     sync.RWMutex
+	latest Result
+
+	stop   chan struct{}
+	stopWG sync.WaitGroup
+
+	logger hclog.Logger
+}
+
+// NewCanary returns a started Canary that probes every interval. Call Close
+// to stop it.
+func NewCanary(reader spanstore.Reader, writer spanstore.Writer, interval time.Duration, logger hclog.Logger) *Canary {
+	c := &Canary{
+		reader:   reader,
+		writer:   writer,
+		interval: interval,
+		stop:     make(chan struct{}),
+		logger:   logger,
+	}
+
+	c.stopWG.Add(1)
+	go c.run()
+
+	return c
+}
+
+// Close triggers a graceful shutdown
+func (c *Canary) Close() error {
+	close(c.stop)
+	c.stopWG.Wait()
+	return nil
+}
+
+// LatestResult returns the result of the most recent probe.
+func (c *Canary) LatestResult() Result {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.latest
+}
+
+func (c *Canary) run() {
+	defer c.stopWG.Done()
+
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-t.C:
+			latency, err := c.probe(context.Background())
+			c.mu.Lock()
+			c.latest.LastError = err
+			if err == nil {
+				c.latest.Latency = latency
+				c.latest.LastSuccess = time.Now()
+			}
+			c.mu.Unlock()
+			if err != nil {
+				c.logger.Warn("canary probe failed", "error", err)
+			}
+		}
+	}
+}
+
+// probe writes one synthetic trace and polls until it reads back, returning
+// the end-to-end read-after-write latency.
+func (c *Canary) probe(ctx context.Context) (time.Duration, error) {
+	span := &model.Span{
+		TraceID:       model.TraceID{Low: rand.Uint64()},
+		SpanID:        model.SpanID(rand.Uint64()),
+		OperationName: "canary",
+		StartTime:     time.Now(),
+		Duration:      time.Millisecond,
+		Process: &model.Process{
+			ServiceName: serviceName,
+		},
+	}
+
+	written := time.Now()
+	if err := c.writer.WriteSpan(span); err != nil {
+		return 0, err
+	}
+
+	deadline := written.Add(readBackTimeout)
+	var err error
+	for time.Now().Before(deadline) {
+		select {
+		case <-c.stop:
+			return 0, ctx.Err()
+		case <-time.After(readBackPollInterval):
+		}
+
+		var trace *model.Trace
+		trace, err = c.reader.GetTrace(ctx, span.TraceID)
+		if err == nil && trace != nil && len(trace.Spans) > 0 {
+			return time.Since(written), nil
+		}
+	}
+
+	if err != nil {
+		return 0, err
+	}
+	return 0, context.DeadlineExceeded
+}
@@ -1,32 +1,199 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"net/http"
 	"os"
+	"os/signal"
 	"sort"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/influxdata/jaeger-influxdb/config"
+	"github.com/influxdata/jaeger-influxdb/grpcplugin"
+	"github.com/influxdata/jaeger-influxdb/influx2http"
 	"github.com/influxdata/jaeger-influxdb/storev1"
 	"github.com/influxdata/jaeger-influxdb/storev2"
-	"github.com/jaegertracing/jaeger/plugin/storage/grpc"
+	"github.com/influxdata/jaeger-influxdb/storev3"
 	"github.com/jaegertracing/jaeger/plugin/storage/grpc/shared"
-	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
 
 var configPath string
 
+// Startup backoff for -retry-startup, doubling up to the maximum.
+var (
+	startupBackoff    = time.Second
+	maxStartupBackoff = 30 * time.Second
+)
+
 func main() {
 	logger := hclog.New(&hclog.LoggerOptions{
 		Name:  "jaeger-influxdb",
 		Level: hclog.Warn, // Jaeger only captures >= Warn, so don't bother logging below Warn
 	})
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrate(logger, os.Args[2:])
+		return
+	}
+
 	flag.StringVar(&configPath, "config", "", "The absolute path to the InfluxDB plugin's configuration file")
 	flag.Parse()
 
+	conf := loadConfiguration(logger, configPath)
+
+	environ := os.Environ()
+	sort.Strings(environ)
+	for _, env := range environ {
+		logger.Warn(env)
+	}
+
+	if conf.DialTimeout > 0 || conf.ConnRecycleInterval > 0 {
+		influx2http.ConfigureTransport(influx2http.TransportConfig{
+			DialTimeout:         conf.DialTimeout,
+			ConnRecycleInterval: conf.ConnRecycleInterval,
+		})
+	}
+
+	if conf.SRVRecord != "" {
+		resolver, err := influx2http.NewSRVResolver(conf.SRVRecord, conf.DiscoveryInterval)
+		if err != nil {
+			logger.Error("failed to resolve InfluxDB SRV record", "error", err)
+			os.Exit(1)
+		}
+		influx2http.SetEndpointResolver(resolver)
+	}
+
+	var openStore func() (shared.StoragePlugin, func() error, error)
+
+	if conf.V3Database != "" {
+		logger.Warn("Started with InfluxDB v3")
+		openStore = func() (shared.StoragePlugin, func() error, error) {
+			return storev3.NewStore(&conf, logger)
+		}
+	} else if conf.Database != "" {
+		logger.Warn("Started with InfluxDB v1")
+		openStore = func() (shared.StoragePlugin, func() error, error) {
+			if err := storev1.Preflight(&conf, logger); err != nil {
+				return nil, nil, err
+			}
+			return storev1.NewStore(&conf, logger)
+		}
+	} else if conf.Organization != "" && conf.Bucket != "" && conf.Token != "" {
+		logger.Warn("Started with InfluxDB v2")
+		openStore = func() (shared.StoragePlugin, func() error, error) {
+			if err := storev2.Preflight(context.Background(), &conf, logger); err != nil {
+				return nil, nil, err
+			}
+			return storev2.NewStore(&conf, logger)
+		}
+	} else {
+		logger.Error("missing flags; for InfluxDB V1 set database and retention policy; for InfluxDB V2 set organization, bucket and token; for InfluxDB V3 set v3-database and token")
+		os.Exit(1)
+	}
+
+	store, closeStore, err := openStore()
+	for err != nil && conf.RetryStartup {
+		// Degraded start: InfluxDB isn't reachable yet (e.g. Kubernetes is
+		// still scheduling it); keep retrying until the backend appears.
+		logger.Warn("InfluxDB not ready; retrying", "error", err, "backoff", startupBackoff.String())
+		time.Sleep(startupBackoff)
+		if startupBackoff < maxStartupBackoff {
+			startupBackoff *= 2
+		}
+		store, closeStore, err = openStore()
+	}
+
+	if err != nil {
+		logger.Error("failed to open store", "error", err)
+		os.Exit(1)
+	}
+
+	serveAdmin(store, conf.AdminAddr, logger)
+
+	grpcplugin.Serve(store)
+
+	if err = closeStore(); err != nil {
+		logger.Error("failed to close store", "error", err)
+		os.Exit(1)
+	}
+}
+
+// cacheFlusher is implemented by stores with flushable metadata caches.
+type cacheFlusher interface {
+	FlushMetadataCaches(name string)
+}
+
+// healthChecker is implemented by stores that can verify their path to
+// InfluxDB on demand.
+type healthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// readyCheckTimeout bounds one readiness check, so a hung InfluxDB fails the
+// check instead of stalling the prober.
+const readyCheckTimeout = 10 * time.Second
+
+// serveAdmin wires the plugin's operational endpoints: metadata caches are
+// flushed on SIGHUP or POST /flush?cache=services, and GET /ready runs the
+// store's health check so orchestrators get a meaningful readiness signal
+// instead of a failure at first query. Endpoints the store does not support
+// are omitted; no server is started when addr is empty.
+func serveAdmin(store shared.StoragePlugin, addr string, logger hclog.Logger) {
+	flusher, canFlush := store.(cacheFlusher)
+	checker, canCheck := store.(healthChecker)
+
+	if canFlush {
+		sighup := make(chan os.Signal, 1)
+		signal.Notify(sighup, syscall.SIGHUP)
+		go func() {
+			for range sighup {
+				logger.Warn("flushing metadata caches on SIGHUP")
+				flusher.FlushMetadataCaches("all")
+			}
+		}()
+	}
+
+	if addr == "" || (!canFlush && !canCheck) {
+		return
+	}
+	mux := http.NewServeMux()
+	if canFlush {
+		mux.HandleFunc("/flush", func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodPost {
+				http.Error(w, "POST required", http.StatusMethodNotAllowed)
+				return
+			}
+			cache := req.URL.Query().Get("cache")
+			logger.Warn("flushing metadata caches via admin endpoint", "cache", cache)
+			flusher.FlushMetadataCaches(cache)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+	if canCheck {
+		mux.HandleFunc("/ready", func(w http.ResponseWriter, req *http.Request) {
+			ctx, cancel := context.WithTimeout(req.Context(), readyCheckTimeout)
+			defer cancel()
+			if err := checker.CheckHealth(ctx); err != nil {
+				logger.Warn("readiness check failed", "error", err)
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logger.Error("admin endpoint failed", "error", err)
+		}
+	}()
+}
+
+func loadConfiguration(logger hclog.Logger, configPath string) config.Configuration {
 	v := viper.New()
 	v.AutomaticEnv()
 	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
@@ -44,35 +211,53 @@ func main() {
 	conf := config.Configuration{}
 	conf.InitFromViper(v)
 
-	environ := os.Environ()
-	sort.Strings(environ)
-	for _, env := range environ {
-		logger.Warn(env)
-	}
+	return conf
+}
 
-	var store shared.StoragePlugin
-	var closeStore func() error
-	var err error
+// migrate runs the schema migration subcommand, copying historical data
+// from one measurement layout to another. InfluxDB v2.x only.
+func migrate(logger hclog.Logger, args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	migrateConfigPath := flags.String("config", "", "The absolute path to the InfluxDB plugin's configuration file")
+	from := flags.String("from", "", "The source measurement")
+	to := flags.String("to", "", "The destination measurement")
+	startString := flags.String("start", "", "RFC3339 start of the time range to migrate; use the value from a failed run to resume")
+	endString := flags.String("end", "", "RFC3339 end of the time range to migrate (defaults to now)")
+	chunkInterval := flags.Duration("chunk", time.Hour, "Duration of each migration batch")
+	throttle := flags.Duration("throttle", 0, "Sleep duration between migration batches")
+	if err := flags.Parse(args); err != nil {
+		os.Exit(1)
+	}
 
-	if conf.Database != "" {
-		logger.Warn("Started with InfluxDB v1")
-		store, closeStore, err = storev1.NewStore(&conf, logger)
-	} else if conf.Organization != "" && conf.Bucket != "" && conf.Token != "" {
-		logger.Warn("Started with InfluxDB v2")
-		store, closeStore, err = storev2.NewStore(&conf, logger)
-	} else {
-		err = errors.New("missing flags; for InfluxDB V1 set database and retention policy; for InfluxDB V2 set organization, bucket and token")
+	if *from == "" || *to == "" || *startString == "" {
+		logger.Error("migrate requires -from, -to and -start")
+		os.Exit(1)
 	}
 
+	start, err := time.Parse(time.RFC3339, *startString)
 	if err != nil {
-		logger.Error("failed to open store", "error", err)
+		logger.Error("failed to parse -start", "error", err)
 		os.Exit(1)
 	}
+	end := time.Now()
+	if *endString != "" {
+		end, err = time.Parse(time.RFC3339, *endString)
+		if err != nil {
+			logger.Error("failed to parse -end", "error", err)
+			os.Exit(1)
+		}
+	}
 
-	grpc.Serve(store)
+	conf := loadConfiguration(logger, *migrateConfigPath)
 
-	if err = closeStore(); err != nil {
-		logger.Error("failed to close store", "error", err)
+	migrator, err := storev2.NewMigrator(&conf, *from, *to, *chunkInterval, *throttle, logger)
+	if err != nil {
+		logger.Error("failed to open migrator", "error", err)
+		os.Exit(1)
+	}
+
+	if err := migrator.Run(context.Background(), start, end); err != nil {
+		logger.Error("migration failed", "error", err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,163 @@
+package common
+
+import (
+	"context"
+	"io/ioutil"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrAccessDenied is returned when an access policy rejects a read.
+var ErrAccessDenied = errors.New("access denied for requested service")
+
+var _ spanstore.Reader = (*AuthorizedReader)(nil)
+
+// AccessPolicy maps caller bearer tokens to the service names they may read.
+// A service entry of "*" grants visibility into all services. Callers
+// presenting no token, or an unrecognized token, get the default services.
+type AccessPolicy struct {
+	DefaultServices []string            `yaml:"default"`
+	TokenServices   map[string][]string `yaml:"tokens"`
+}
+
+// LoadAccessPolicy reads an access policy from a YAML file.
+func LoadAccessPolicy(path string) (*AccessPolicy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read access policy")
+	}
+	policy := &AccessPolicy{}
+	if err = yaml.Unmarshal(b, policy); err != nil {
+		return nil, errors.Wrap(err, "failed to parse access policy")
+	}
+	return policy, nil
+}
+
+// allowedServices returns the services visible to the caller, or allowAll.
+func (p *AccessPolicy) allowedServices(ctx context.Context) (services []string, allowAll bool) {
+	services = p.DefaultServices
+	if token, found := spanstore.GetBearerToken(ctx); found {
+		if tokenServices, ok := p.TokenServices[token]; ok {
+			services = tokenServices
+		}
+	}
+	for _, service := range services {
+		if service == "*" {
+			return nil, true
+		}
+	}
+	return services, false
+}
+
+// allows reports whether the caller may read spans from service.
+func (p *AccessPolicy) allows(ctx context.Context, service string) bool {
+	services, allowAll := p.allowedServices(ctx)
+	if allowAll {
+		return true
+	}
+	for _, allowed := range services {
+		if allowed == service {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizedReader decorates a spanstore.Reader, restricting each caller to
+// the services its access policy permits. Multi-team deployments get basic
+// read isolation within a single database/bucket.
+type AuthorizedReader struct {
+	reader spanstore.Reader
+	policy *AccessPolicy
+}
+
+// NewAuthorizedReader returns a policy-enforcing decorator around reader.
+func NewAuthorizedReader(reader spanstore.Reader, policy *AccessPolicy) *AuthorizedReader {
+	return &AuthorizedReader{
+		reader: reader,
+		policy: policy,
+	}
+}
+
+// GetTrace rejects traces containing spans from services the caller may not read.
+func (r *AuthorizedReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	trace, err := r.reader.GetTrace(ctx, traceID)
+	if err != nil {
+		return nil, err
+	}
+	if !r.traceAllowed(ctx, trace) {
+		return nil, ErrAccessDenied
+	}
+	return trace, nil
+}
+
+// traceAllowed reports whether every span in the trace belongs to a service
+// the caller may read.
+func (r *AuthorizedReader) traceAllowed(ctx context.Context, trace *model.Trace) bool {
+	for _, span := range trace.Spans {
+		if span.Process != nil && !r.policy.allows(ctx, span.Process.ServiceName) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetServices filters the service list down to what the caller may read.
+func (r *AuthorizedReader) GetServices(ctx context.Context) ([]string, error) {
+	services, err := r.reader.GetServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, allowAll := r.policy.allowedServices(ctx); allowAll {
+		return services, nil
+	}
+	filtered := services[:0]
+	for _, service := range services {
+		if r.policy.allows(ctx, service) {
+			filtered = append(filtered, service)
+		}
+	}
+	return filtered, nil
+}
+
+// GetOperations rejects queries against services the caller may not read.
+func (r *AuthorizedReader) GetOperations(ctx context.Context, param spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	if !r.policy.allows(ctx, param.ServiceName) {
+		return nil, ErrAccessDenied
+	}
+	return r.reader.GetOperations(ctx, param)
+}
+
+// FindTraces rejects queries against services the caller may not read, and
+// drops result traces that GetTrace would reject: a multi-service trace
+// matched through an allowed service would otherwise leak the other
+// services' spans through search.
+func (r *AuthorizedReader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	if query != nil && !r.policy.allows(ctx, query.ServiceName) {
+		return nil, ErrAccessDenied
+	}
+	traces, err := r.reader.FindTraces(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	filtered := traces[:0]
+	for _, trace := range traces {
+		if r.traceAllowed(ctx, trace) {
+			filtered = append(filtered, trace)
+		}
+	}
+	return filtered, nil
+}
+
+// FindTraceIDs rejects queries against services the caller may not read.
+// The IDs themselves carry no span data; fetching the spans goes through
+// GetTrace, which enforces the per-span policy.
+func (r *AuthorizedReader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	if query != nil && !r.policy.allows(ctx, query.ServiceName) {
+		return nil, ErrAccessDenied
+	}
+	return r.reader.FindTraceIDs(ctx, query)
+}
@@ -0,0 +1,77 @@
+package common
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// pacerMinDelay is the smallest nonzero pause between batch writes.
+	pacerMinDelay = 10 * time.Millisecond
+	// pacerMaxDelay caps how far backpressure can slow batch writes.
+	pacerMaxDelay = 10 * time.Second
+	// pacerLatencyThreshold is the batch write latency above which the
+	// server is considered under pressure even when writes succeed.
+	pacerLatencyThreshold = time.Second
+)
+
+// WritePacer converts write outcomes into a submission delay, so a struggling
+// InfluxDB is offloaded gradually instead of being pushed into collapse by
+// retries. Rejected writes (queue full, partial write) double the delay,
+// slow-but-successful writes grow it additively, and healthy writes decay it.
+type WritePacer struct {
+	mtx   sync.Mutex
+	delay time.Duration
+
+	pacedBatches uint64
+}
+
+// NewWritePacer returns a pacer with no initial delay.
+func NewWritePacer() *WritePacer {
+	return &WritePacer{}
+}
+
+// ObserveWrite records the outcome of one batch write; failed marks
+// server-side rejection signals such as queue-full or partial writes.
+func (p *WritePacer) ObserveWrite(latency time.Duration, failed bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	switch {
+	case failed:
+		if p.delay == 0 {
+			p.delay = pacerMinDelay
+		} else {
+			p.delay *= 2
+		}
+	case latency > pacerLatencyThreshold:
+		p.delay += pacerMinDelay
+	default:
+		p.delay /= 2
+		if p.delay < pacerMinDelay {
+			p.delay = 0
+		}
+	}
+	if p.delay > pacerMaxDelay {
+		p.delay = pacerMaxDelay
+	}
+}
+
+// Delay returns the pause to insert before the next batch write, and counts
+// the batch as paced when the pause is nonzero.
+func (p *WritePacer) Delay() time.Duration {
+	p.mtx.Lock()
+	delay := p.delay
+	p.mtx.Unlock()
+
+	if delay > 0 {
+		atomic.AddUint64(&p.pacedBatches, 1)
+	}
+	return delay
+}
+
+// PacedBatches returns the number of batch writes delayed by backpressure.
+func (p *WritePacer) PacedBatches() uint64 {
+	return atomic.LoadUint64(&p.pacedBatches)
+}
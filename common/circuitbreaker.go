@@ -0,0 +1,77 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultCircuitBreakerCoolDown is how long an open circuit breaker waits
+// before probing the server again, unless configured otherwise.
+const DefaultCircuitBreakerCoolDown = 30 * time.Second
+
+// CircuitBreaker fails queries fast while InfluxDB is down, instead of
+// letting every UI request wait out its full timeout. The breaker opens
+// after threshold consecutive failures; after the cool-down it lets one
+// probe query through, closing again on success.
+type CircuitBreaker struct {
+	mtx       sync.Mutex
+	threshold int
+	coolDown  time.Duration
+
+	failures     int
+	openedAt     time.Time
+	probing      bool
+	fastFailures uint64
+}
+
+// NewCircuitBreaker returns a breaker that opens after threshold consecutive
+// failures and probes again after coolDown.
+func NewCircuitBreaker(threshold int, coolDown time.Duration) *CircuitBreaker {
+	if coolDown <= 0 {
+		coolDown = DefaultCircuitBreakerCoolDown
+	}
+	return &CircuitBreaker{
+		threshold: threshold,
+		coolDown:  coolDown,
+	}
+}
+
+// Allow reports whether a query may proceed now; a false return means the
+// breaker is open and the query should fail fast.
+func (b *CircuitBreaker) Allow(now time.Time) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if !b.probing && now.Sub(b.openedAt) >= b.coolDown {
+		b.probing = true
+		return true
+	}
+	b.fastFailures++
+	return false
+}
+
+// Observe records the outcome of a query that Allow let through.
+func (b *CircuitBreaker) Observe(failed bool, now time.Time) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = now
+	}
+}
+
+// FastFailures returns how many queries were failed fast by an open breaker.
+func (b *CircuitBreaker) FastFailures() uint64 {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.fastFailures
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Span timestamp collision strategies. InfluxDB keeps at most one point per
+// (series key, timestamp), so two spans of the same series starting in the
+// same nanosecond overwrite each other.
+const (
+	// CollisionStrategyJitter is the default: a deterministic span-ID-derived
+	// nanosecond suffix is merged into the (µs precision) span timestamp,
+	// making same-timestamp collisions rare but not impossible.
+	CollisionStrategyJitter = "jitter"
+
+	// CollisionStrategySpanIDTag additionally copies the span ID into the
+	// series key as a tag, making collisions impossible at the cost of one
+	// series per span.
+	CollisionStrategySpanIDTag = "span-id-tag"
+)
+
+// CollisionDetector remembers the series key and timestamp of recently
+// written span points, so the write path can count spans that would silently
+// overwrite an earlier span's point. A bounded LRU keeps memory flat.
+type CollisionDetector struct {
+	mtx        sync.Mutex
+	capacity   int
+	entries    map[string]*list.Element
+	order      *list.List // Front is most recently seen
+	collisions uint64
+}
+
+type collisionEntry struct {
+	key    string
+	spanID string
+}
+
+// NewCollisionDetector returns a CollisionDetector remembering up to
+// capacity span points.
+func NewCollisionDetector(capacity int) *CollisionDetector {
+	return &CollisionDetector{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// Observe records that spanID wrote a point under key (series key plus
+// timestamp), returning true when a different span recently wrote the same
+// key, i.e. this write overwrites that span's point.
+func (d *CollisionDetector) Observe(key, spanID string) bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if element, found := d.entries[key]; found {
+		entry := element.Value.(*collisionEntry)
+		d.order.MoveToFront(element)
+		if entry.spanID != spanID {
+			entry.spanID = spanID
+			d.collisions++
+			return true
+		}
+		return false
+	}
+
+	d.entries[key] = d.order.PushFront(&collisionEntry{key: key, spanID: spanID})
+	if d.order.Len() > d.capacity {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.entries, oldest.Value.(*collisionEntry).key)
+	}
+
+	return false
+}
+
+// Collisions returns the number of collisions observed so far.
+func (d *CollisionDetector) Collisions() uint64 {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.collisions
+}
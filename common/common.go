@@ -15,10 +15,16 @@ const (
 	FlagsKey          = "flags"
 	ProcessTagKeysKey = "process_tag_keys"
 	ReferencesKey     = "references"
+	ChecksumKey       = "checksum"
+	FlatSpanKey       = "span"        // single packed field in the flat schema
+	SpanKindTagKey    = "span_kind"   // span kind copied onto span meta points
+	SpanIDTagKey      = "span_id_tag" // span ID copied into the series key (collision strategy)
 
-	DefaultSpanMeasurement     = "span"      // Store spans here
-	DefaultSpanMetaMeasurement = "span-meta" // Store sparse span meta data here
-	DefaultLogMeasurement      = "log"       // Store logs here
+	DefaultSpanMeasurement         = "span"          // Store spans here
+	DefaultSpanMetaMeasurement     = "span-meta"     // Store sparse span meta data here
+	DefaultLogMeasurement          = "log"           // Store logs here
+	DefaultTraceQualityMeasurement = "trace-quality" // Store per-service trace quality scores here
+	DefaultSpanMetricsMeasurement  = "span-metrics"  // Store derived RED metrics with exemplars here
 
 	MeasurementKey = "_measurement"
 	FieldKey       = "_field"
@@ -27,8 +33,44 @@ const (
 	ReferenceTypeChildOf     = "ChildOf"
 	ReferenceTypeFollowsFrom = "FollowsFrom"
 
+	// Columns of the server-side dependency join result.
+	DependencyParentKey    = "parent"
+	DependencyChildKey     = "child"
+	DependencyCallCountKey = "call_count"
+
+	ErrorKey                 = "error"                   // Legacy Jaeger error tag
+	SpanKindKey              = "span.kind"               // OpenTracing span kind tag
+	OtelStatusCodeKey        = "otel.status_code"        // OTel span status code
+	OtelStatusDescriptionKey = "otel.status_description" // OTel span status message
+	HTTPStatusCodeKey        = "http.status_code"        // HTTP semantic convention
+
+	// Default write batch flush triggers; overridable per writer via
+	// SetFlushPolicy.
 	MaxFlushPoints   = 5000
 	MaxFlushInterval = time.Second
 
 	MetaCacheInterval = time.Hour
+
+	// DefaultSearchWindow bounds trace searches that arrive without a time range.
+	DefaultSearchWindow = 24 * time.Hour
+
+	// DefaultMaxTraceIDsPerQuery bounds the trace ID predicate size of one trace query.
+	DefaultMaxTraceIDsPerQuery = 100
+
+	// DefaultMetadataSnapshotInterval is how often metadata caches are
+	// persisted to disk when snapshotting is enabled.
+	DefaultMetadataSnapshotInterval = 5 * time.Minute
+
+	// DefaultMaxEmbeddedLogBytes caps the encoded logs embedded in a
+	// single-point span field.
+	DefaultMaxEmbeddedLogBytes = 64 * 1024
+
+	// TagValuesLimit is the result size at which a tagValues response is
+	// assumed truncated by the server and completed with a full scan.
+	TagValuesLimit = 1000
+
+	// SkipLogsTagKey is a reserved search tag: "true" or "false" overrides
+	// the reader's skip-search-logs setting for one query. It is stripped
+	// from the search before the query is built.
+	SkipLogsTagKey = "skip-logs"
 )
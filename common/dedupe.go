@@ -0,0 +1,68 @@
+package common
+
+import (
+	"container/list"
+	"sync"
+)
+
+// WriteDeduper suppresses duplicate span writes. Collector retries and
+// at-least-once Kafka delivery can deliver the same span more than once;
+// a bounded LRU of recently written (trace ID, span ID, content hash)
+// entries lets the write path drop exact duplicates instead of storing
+// duplicate points.
+type WriteDeduper struct {
+	mtx        sync.Mutex
+	capacity   int
+	entries    map[string]*list.Element
+	order      *list.List // Front is most recently seen
+	suppressed uint64
+}
+
+type dedupeEntry struct {
+	key  string
+	hash string
+}
+
+// NewWriteDeduper returns a WriteDeduper remembering up to capacity spans.
+func NewWriteDeduper(capacity int) *WriteDeduper {
+	return &WriteDeduper{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// Seen records a span write keyed by trace/span ID and reports whether an
+// identical write (same key and content hash) was seen recently. A key seen
+// with a different hash is recorded as new, so re-emitted spans with changed
+// content are still written.
+func (d *WriteDeduper) Seen(key, hash string) bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if element, found := d.entries[key]; found {
+		entry := element.Value.(*dedupeEntry)
+		d.order.MoveToFront(element)
+		if entry.hash == hash {
+			d.suppressed++
+			return true
+		}
+		entry.hash = hash
+		return false
+	}
+
+	d.entries[key] = d.order.PushFront(&dedupeEntry{key: key, hash: hash})
+	if d.order.Len() > d.capacity {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.entries, oldest.Value.(*dedupeEntry).key)
+	}
+	return false
+}
+
+// SuppressedDuplicates returns the count of duplicate writes suppressed.
+func (d *WriteDeduper) SuppressedDuplicates() uint64 {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.suppressed
+}
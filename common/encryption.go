@@ -0,0 +1,235 @@
+package common
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/pkg/errors"
+)
+
+// encryptedValuePrefix marks tag values that have been encrypted at rest.
+const encryptedValuePrefix = "enc:"
+
+var (
+	_ spanstore.Writer = (*EncryptingWriter)(nil)
+	_ spanstore.Reader = (*DecryptingReader)(nil)
+)
+
+// KeyProvider supplies the data encryption key for sensitive tag values.
+// Implementations may hold a static key or fetch one from a KMS.
+type KeyProvider interface {
+	EncryptionKey() ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider holding a fixed key.
+type StaticKeyProvider struct {
+	key []byte
+}
+
+// NewStaticKeyProvider parses a hex encoded AES key (16, 24 or 32 bytes).
+func NewStaticKeyProvider(hexKey string) (*StaticKeyProvider, error) {
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode encryption key")
+	}
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, errors.Errorf("encryption key must be 16, 24 or 32 bytes, got %d", len(key))
+	}
+	return &StaticKeyProvider{key: key}, nil
+}
+
+// EncryptionKey returns the static key.
+func (p *StaticKeyProvider) EncryptionKey() ([]byte, error) {
+	return p.key, nil
+}
+
+// TagCipher encrypts and decrypts the values of configured tag keys with
+// AES-GCM, so sensitive attributes are protected at rest even from database
+// admins. Non-string values are stringified before encryption.
+type TagCipher struct {
+	aead cipher.AEAD
+	keys map[string]struct{}
+}
+
+// NewTagCipher returns a TagCipher protecting the values of tagKeys.
+func NewTagCipher(provider KeyProvider, tagKeys []string) (*TagCipher, error) {
+	key, err := provider.EncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize tag cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize tag cipher")
+	}
+
+	keys := make(map[string]struct{}, len(tagKeys))
+	for _, tagKey := range tagKeys {
+		keys[tagKey] = struct{}{}
+	}
+
+	return &TagCipher{
+		aead: aead,
+		keys: keys,
+	}, nil
+}
+
+func (c *TagCipher) encryptValue(plaintext string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "failed to encrypt tag value")
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedValuePrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *TagCipher) decryptValue(value string) (string, bool) {
+	if !strings.HasPrefix(value, encryptedValuePrefix) {
+		return value, false
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedValuePrefix))
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return value, false
+	}
+	plaintext, err := c.aead.Open(nil, sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():], nil)
+	if err != nil {
+		return value, false
+	}
+	return string(plaintext), true
+}
+
+func (c *TagCipher) encryptTags(tags []model.KeyValue) error {
+	for i, tag := range tags {
+		if _, found := c.keys[tag.Key]; !found {
+			continue
+		}
+		encrypted, err := c.encryptValue(tag.AsString())
+		if err != nil {
+			return err
+		}
+		tags[i] = model.String(tag.Key, encrypted)
+	}
+	return nil
+}
+
+func (c *TagCipher) decryptTags(tags []model.KeyValue) {
+	for i, tag := range tags {
+		if _, found := c.keys[tag.Key]; !found || tag.VType != model.StringType {
+			continue
+		}
+		if plaintext, decrypted := c.decryptValue(tag.VStr); decrypted {
+			tags[i] = model.String(tag.Key, plaintext)
+		}
+	}
+}
+
+// EncryptingWriter decorates a spanstore.Writer, encrypting configured tag
+// values on spans, processes and logs before they are written.
+type EncryptingWriter struct {
+	writer spanstore.Writer
+	cipher *TagCipher
+}
+
+// NewEncryptingWriter returns an encrypting decorator around writer.
+func NewEncryptingWriter(writer spanstore.Writer, cipher *TagCipher) *EncryptingWriter {
+	return &EncryptingWriter{
+		writer: writer,
+		cipher: cipher,
+	}
+}
+
+// WriteSpan encrypts sensitive tag values, then delegates.
+func (w *EncryptingWriter) WriteSpan(span *model.Span) error {
+	if err := w.cipher.encryptTags(span.Tags); err != nil {
+		return err
+	}
+	if span.Process != nil {
+		if err := w.cipher.encryptTags(span.Process.Tags); err != nil {
+			return err
+		}
+	}
+	for _, log := range span.Logs {
+		if err := w.cipher.encryptTags(log.Fields); err != nil {
+			return err
+		}
+	}
+	return w.writer.WriteSpan(span)
+}
+
+// DecryptingReader decorates a spanstore.Reader, decrypting configured tag
+// values on spans returned by GetTrace and FindTraces.
+type DecryptingReader struct {
+	reader spanstore.Reader
+	cipher *TagCipher
+}
+
+// NewDecryptingReader returns a decrypting decorator around reader. It
+// decrypts spans in place, so it must wrap the storage reader directly,
+// beneath any caching readers that share traces between callers.
+func NewDecryptingReader(reader spanstore.Reader, cipher *TagCipher) *DecryptingReader {
+	return &DecryptingReader{
+		reader: reader,
+		cipher: cipher,
+	}
+}
+
+func (r *DecryptingReader) decryptTrace(trace *model.Trace) {
+	for _, span := range trace.Spans {
+		r.cipher.decryptTags(span.Tags)
+		if span.Process != nil {
+			r.cipher.decryptTags(span.Process.Tags)
+		}
+		for _, log := range span.Logs {
+			r.cipher.decryptTags(log.Fields)
+		}
+	}
+}
+
+// GetTrace delegates, then decrypts sensitive tag values.
+func (r *DecryptingReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	trace, err := r.reader.GetTrace(ctx, traceID)
+	if err != nil {
+		return nil, err
+	}
+	r.decryptTrace(trace)
+	return trace, nil
+}
+
+// GetServices delegates.
+func (r *DecryptingReader) GetServices(ctx context.Context) ([]string, error) {
+	return r.reader.GetServices(ctx)
+}
+
+// GetOperations delegates.
+func (r *DecryptingReader) GetOperations(ctx context.Context, param spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	return r.reader.GetOperations(ctx, param)
+}
+
+// FindTraces delegates, then decrypts sensitive tag values.
+func (r *DecryptingReader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	traces, err := r.reader.FindTraces(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	for _, trace := range traces {
+		r.decryptTrace(trace)
+	}
+	return traces, nil
+}
+
+// FindTraceIDs delegates.
+func (r *DecryptingReader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	return r.reader.FindTraceIDs(ctx, query)
+}
@@ -0,0 +1,70 @@
+package common
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// lagWarnInterval throttles watchdog warnings, so a sustained backlog does
+// not flood the log.
+const lagWarnInterval = time.Minute
+
+// WriteLagWatchdog tracks the delta between span end timestamps and write
+// time. When ingestion falls behind the configured threshold, operators get
+// a log warning before data becomes unsearchably stale.
+type WriteLagWatchdog struct {
+	mtx        sync.Mutex
+	threshold  time.Duration
+	maxLag     time.Duration
+	lastLag    time.Duration
+	lastWarned time.Time
+
+	logger hclog.Logger
+}
+
+// NewWriteLagWatchdog returns a watchdog warning when write lag exceeds threshold.
+func NewWriteLagWatchdog(threshold time.Duration, logger hclog.Logger) *WriteLagWatchdog {
+	return &WriteLagWatchdog{
+		threshold: threshold,
+		logger:    logger,
+	}
+}
+
+// Observe records the lag of one span write: the delta between the span's end
+// timestamp and now.
+func (w *WriteLagWatchdog) Observe(spanEnd, now time.Time) {
+	lag := now.Sub(spanEnd)
+	if lag < 0 {
+		// Clock skew between this host and the span's origin; not a backlog.
+		return
+	}
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	w.lastLag = lag
+	if lag > w.maxLag {
+		w.maxLag = lag
+	}
+	if lag > w.threshold && now.Sub(w.lastWarned) > lagWarnInterval {
+		w.lastWarned = now
+		w.logger.Warn("span ingestion is falling behind",
+			"lag", lag.String(), "threshold", w.threshold.String())
+	}
+}
+
+// LastLag returns the most recently observed write lag.
+func (w *WriteLagWatchdog) LastLag() time.Duration {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.lastLag
+}
+
+// MaxLag returns the largest write lag observed so far.
+func (w *WriteLagWatchdog) MaxLag() time.Duration {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.maxLag
+}
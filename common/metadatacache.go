@@ -0,0 +1,220 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+var _ spanstore.Reader = (*MetadataCachingReader)(nil)
+
+// Defaults for the metadata cache: services change rarely compared to how
+// often the UI asks for them, so a longer TTL than the search cache is safe.
+const (
+	DefaultMetadataCacheTTL  = 2 * time.Minute
+	DefaultMetadataCacheSize = 1000
+)
+
+// MetadataCachingReader decorates a spanstore.Reader with a TTL cache of
+// GetServices and GetOperations results. Both are called on every UI page
+// load, and each one runs a full tag-values scan against InfluxDB; the cache
+// turns that into one scan per TTL. Cached slices are shared, not copied.
+type MetadataCachingReader struct {
+	reader  spanstore.Reader
+	ttl     time.Duration
+	maxSize int
+
+	mtx        sync.Mutex
+	services   *cachedServices
+	operations map[string]cachedOperations
+
+	hits   uint64
+	misses uint64
+
+	stop   chan struct{}
+	stopWG sync.WaitGroup
+}
+
+type cachedServices struct {
+	services []string
+	expires  time.Time
+}
+
+type cachedOperations struct {
+	operations []spanstore.Operation
+	expires    time.Time
+}
+
+// NewMetadataCachingReader returns a caching decorator around reader;
+// results expire after ttl, and at most maxSize per-service operation
+// entries are kept.
+func NewMetadataCachingReader(reader spanstore.Reader, ttl time.Duration, maxSize int) *MetadataCachingReader {
+	if ttl <= 0 {
+		ttl = DefaultMetadataCacheTTL
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultMetadataCacheSize
+	}
+	return &MetadataCachingReader{
+		reader:     reader,
+		ttl:        ttl,
+		maxSize:    maxSize,
+		operations: make(map[string]cachedOperations),
+		stop:       make(chan struct{}),
+	}
+}
+
+// WarmInBackground refreshes the cached services and per-service operations
+// every interval (with up to 10% jitter to avoid synchronized query
+// instances), so UI dropdowns are instant even on the first request after a
+// cold start or a TTL expiry.
+func (r *MetadataCachingReader) WarmInBackground(interval time.Duration, logger hclog.Logger) {
+	r.stopWG.Add(1)
+	go func() {
+		defer r.stopWG.Done()
+
+		r.warm(context.Background(), logger)
+
+		t := time.NewTimer(withJitter(interval))
+		defer t.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-t.C:
+				r.warm(context.Background(), logger)
+				t.Reset(withJitter(interval))
+			}
+		}
+	}()
+}
+
+// warm refreshes the cache from the underlying reader unconditionally,
+// regardless of the entries' remaining TTL.
+func (r *MetadataCachingReader) warm(ctx context.Context, logger hclog.Logger) {
+	now := time.Now()
+
+	services, err := r.reader.GetServices(ctx)
+	if err != nil {
+		logger.Warn("metadata cache warm failed", "error", err)
+		return
+	}
+	r.mtx.Lock()
+	r.services = &cachedServices{services: services, expires: now.Add(r.ttl)}
+	r.mtx.Unlock()
+
+	for _, service := range services {
+		operations, err := r.reader.GetOperations(ctx, spanstore.OperationQueryParameters{ServiceName: service})
+		if err != nil {
+			logger.Warn("metadata cache warm failed", "service", service, "error", err)
+			continue
+		}
+		r.mtx.Lock()
+		r.evictLocked(now)
+		r.operations[service+"|"] = cachedOperations{operations: operations, expires: now.Add(r.ttl)}
+		r.mtx.Unlock()
+	}
+}
+
+// Close stops the background warmer, if one was started.
+func (r *MetadataCachingReader) Close() error {
+	close(r.stop)
+	r.stopWG.Wait()
+	return nil
+}
+
+// GetTrace is served directly.
+func (r *MetadataCachingReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	return r.reader.GetTrace(ctx, traceID)
+}
+
+// FindTraces is served directly.
+func (r *MetadataCachingReader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	return r.reader.FindTraces(ctx, query)
+}
+
+// FindTraceIDs is served directly.
+func (r *MetadataCachingReader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	return r.reader.FindTraceIDs(ctx, query)
+}
+
+// GetServices serves the service list from cache until the TTL elapses.
+func (r *MetadataCachingReader) GetServices(ctx context.Context) ([]string, error) {
+	now := time.Now()
+
+	r.mtx.Lock()
+	cached := r.services
+	r.mtx.Unlock()
+	if cached != nil && now.Before(cached.expires) {
+		atomic.AddUint64(&r.hits, 1)
+		return cached.services, nil
+	}
+	atomic.AddUint64(&r.misses, 1)
+
+	services, err := r.reader.GetServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mtx.Lock()
+	r.services = &cachedServices{services: services, expires: now.Add(r.ttl)}
+	r.mtx.Unlock()
+
+	return services, nil
+}
+
+// GetOperations serves a service's operation list from cache until the TTL
+// elapses. The span-kind filter is part of the cache key.
+func (r *MetadataCachingReader) GetOperations(ctx context.Context, param spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	key := param.ServiceName + "|" + param.SpanKind
+	now := time.Now()
+
+	r.mtx.Lock()
+	cached, found := r.operations[key]
+	r.mtx.Unlock()
+	if found && now.Before(cached.expires) {
+		atomic.AddUint64(&r.hits, 1)
+		return cached.operations, nil
+	}
+	atomic.AddUint64(&r.misses, 1)
+
+	operations, err := r.reader.GetOperations(ctx, param)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mtx.Lock()
+	r.evictLocked(now)
+	r.operations[key] = cachedOperations{operations: operations, expires: now.Add(r.ttl)}
+	r.mtx.Unlock()
+
+	return operations, nil
+}
+
+// CacheStats returns how many metadata lookups were served from cache and
+// how many fell through to InfluxDB.
+func (r *MetadataCachingReader) CacheStats() (hits, misses uint64) {
+	return atomic.LoadUint64(&r.hits), atomic.LoadUint64(&r.misses)
+}
+
+// evictLocked drops expired operation entries, then arbitrary ones while the
+// cache exceeds its size bound.
+func (r *MetadataCachingReader) evictLocked(now time.Time) {
+	for key, cached := range r.operations {
+		if !now.Before(cached.expires) {
+			delete(r.operations, key)
+		}
+	}
+	for key := range r.operations {
+		if len(r.operations) < r.maxSize {
+			break
+		}
+		delete(r.operations, key)
+	}
+}
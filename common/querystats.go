@@ -0,0 +1,166 @@
+package common
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+type queryStatsContextKey struct{}
+
+// ContextWithQueryStats attaches stats to the context; the reader fills it
+// in as the request executes.
+func ContextWithQueryStats(ctx context.Context, stats *QueryStats) context.Context {
+	return context.WithValue(ctx, queryStatsContextKey{}, stats)
+}
+
+// QueryStatsFromContext returns the stats attached to the context, or nil.
+func QueryStatsFromContext(ctx context.Context) *QueryStats {
+	stats, _ := ctx.Value(queryStatsContextKey{}).(*QueryStats)
+	return stats
+}
+
+// QueryStats accumulates execution statistics for one reader call: how many
+// Flux queries ran, how long the request spent waiting on InfluxDB versus
+// decoding, and how many spans and traces were reconstructed. Attach one to
+// the context with ContextWithQueryStats before calling the reader and read
+// it back afterwards; all methods are safe on a nil receiver and across
+// goroutines.
+type QueryStats struct {
+	fluxQueries   int64
+	spansDecoded  int64
+	tracesDecoded int64
+	queryWaitNS   int64
+	decodeNS      int64
+	scannedValues int64
+	scannedBytes  int64
+	planNS        int64
+	executeNS     int64
+}
+
+// ObserveQuery records one Flux query and the time spent waiting on it.
+func (s *QueryStats) ObserveQuery(wait time.Duration) {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.fluxQueries, 1)
+	atomic.AddInt64(&s.queryWaitNS, wait.Nanoseconds())
+}
+
+// ObserveDecode records one decoded result: the spans and traces
+// reconstructed from it and the time spent decoding.
+func (s *QueryStats) ObserveDecode(spans, traces int, decode time.Duration) {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.spansDecoded, int64(spans))
+	atomic.AddInt64(&s.tracesDecoded, int64(traces))
+	atomic.AddInt64(&s.decodeNS, decode.Nanoseconds())
+}
+
+// ObserveProfile records one Flux profiler report: the values and bytes the
+// server scanned and the time it spent planning and executing the query.
+func (s *QueryStats) ObserveProfile(scannedValues, scannedBytes int64, plan, execute time.Duration) {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.scannedValues, scannedValues)
+	atomic.AddInt64(&s.scannedBytes, scannedBytes)
+	atomic.AddInt64(&s.planNS, plan.Nanoseconds())
+	atomic.AddInt64(&s.executeNS, execute.Nanoseconds())
+}
+
+// FluxQueries returns the number of Flux queries executed.
+func (s *QueryStats) FluxQueries() int64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&s.fluxQueries)
+}
+
+// SpansDecoded returns the number of spans reconstructed.
+func (s *QueryStats) SpansDecoded() int64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&s.spansDecoded)
+}
+
+// TracesDecoded returns the number of traces reconstructed.
+func (s *QueryStats) TracesDecoded() int64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&s.tracesDecoded)
+}
+
+// QueryWait returns the cumulative time spent waiting on InfluxDB.
+func (s *QueryStats) QueryWait() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&s.queryWaitNS))
+}
+
+// DecodeTime returns the cumulative time spent decoding results.
+func (s *QueryStats) DecodeTime() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&s.decodeNS))
+}
+
+// ScannedValues returns the number of values the server scanned, as reported
+// by the Flux profiler; zero unless profiling is enabled.
+func (s *QueryStats) ScannedValues() int64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&s.scannedValues)
+}
+
+// ScannedBytes returns the number of bytes the server scanned, as reported
+// by the Flux profiler; zero unless profiling is enabled.
+func (s *QueryStats) ScannedBytes() int64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&s.scannedBytes)
+}
+
+// PlanTime returns the server-side query planning time reported by the Flux
+// profiler; zero unless profiling is enabled.
+func (s *QueryStats) PlanTime() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&s.planNS))
+}
+
+// ExecuteTime returns the server-side query execution time reported by the
+// Flux profiler; zero unless profiling is enabled.
+func (s *QueryStats) ExecuteTime() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&s.executeNS))
+}
+
+// LogKV returns the stats as alternating key/value pairs for hclog.
+func (s *QueryStats) LogKV() []interface{} {
+	kv := []interface{}{
+		"flux-queries", s.FluxQueries(),
+		"spans-decoded", s.SpansDecoded(),
+		"traces-decoded", s.TracesDecoded(),
+		"query-wait", s.QueryWait().String(),
+		"decode-time", s.DecodeTime().String(),
+	}
+	if s.ScannedValues() > 0 || s.ScannedBytes() > 0 {
+		kv = append(kv,
+			"scanned-values", s.ScannedValues(),
+			"scanned-bytes", s.ScannedBytes(),
+			"plan-time", s.PlanTime().String(),
+			"execute-time", s.ExecuteTime().String())
+	}
+	return kv
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"context"
+	"time"
+)
+
+// QueryTimeouts bounds each reader operation with its own context deadline,
+// so one slow query class (e.g. dependency aggregation) cannot stall the UI
+// indefinitely. A zero duration leaves that operation unbounded.
+type QueryTimeouts struct {
+	GetTrace        time.Duration
+	FindTraceIDs    time.Duration
+	FindTraces      time.Duration
+	GetServices     time.Duration
+	GetDependencies time.Duration
+}
+
+// BoundContext applies timeout to ctx when it is positive; the returned
+// cancel func is always safe to call.
+func BoundContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// WriteQuota tracks points and bytes written per UTC day against configured
+// daily limits, for chargeback and for staying within InfluxDB Cloud plan
+// limits. Once a limit is exceeded, writes are either rejected or sampled
+// down to the configured rate until the day rolls over.
+type WriteQuota struct {
+	maxPointsPerDay int64 // 0 = unlimited
+	maxBytesPerDay  int64 // 0 = unlimited
+	// sampleEveryNth keeps one in N points while over quota; 0 rejects all.
+	sampleEveryNth int64
+
+	mu            sync.Mutex
+	day           time.Time
+	points, bytes int64
+	overQuotaSeen int64
+	droppedPoints uint64
+}
+
+// NewWriteQuota returns a quota with the given daily limits. overQuotaSampleRate
+// in (0, 1) keeps that fraction of points once a limit is exceeded; 0 rejects them.
+func NewWriteQuota(maxPointsPerDay, maxBytesPerDay int64, overQuotaSampleRate float64) *WriteQuota {
+	var sampleEveryNth int64
+	if overQuotaSampleRate > 0 && overQuotaSampleRate < 1 {
+		sampleEveryNth = int64(1 / overQuotaSampleRate)
+	}
+	return &WriteQuota{
+		maxPointsPerDay: maxPointsPerDay,
+		maxBytesPerDay:  maxBytesPerDay,
+		sampleEveryNth:  sampleEveryNth,
+	}
+}
+
+// Allow accounts for a pending write of one point of the given size and
+// reports whether it should proceed.
+func (q *WriteQuota) Allow(pointBytes int, now time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	day := now.UTC().Truncate(24 * time.Hour)
+	if !day.Equal(q.day) {
+		q.day = day
+		q.points, q.bytes, q.overQuotaSeen = 0, 0, 0
+	}
+
+	overQuota := (q.maxPointsPerDay > 0 && q.points >= q.maxPointsPerDay) ||
+		(q.maxBytesPerDay > 0 && q.bytes >= q.maxBytesPerDay)
+	if overQuota {
+		q.overQuotaSeen++
+		if q.sampleEveryNth == 0 || q.overQuotaSeen%q.sampleEveryNth != 0 {
+			q.droppedPoints++
+			return false
+		}
+	}
+
+	q.points++
+	q.bytes += int64(pointBytes)
+
+	return true
+}
+
+// DroppedPoints returns the cumulative count of points dropped over quota.
+func (q *WriteQuota) DroppedPoints() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.droppedPoints
+}
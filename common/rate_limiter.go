@@ -0,0 +1,71 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// WriteRateLimiter applies a token-bucket rate limit to the write path,
+// keyed by tenant (service name), so one misbehaving service cannot starve
+// trace storage for everyone else.
+type WriteRateLimiter struct {
+	rate  float64 // tokens (spans) per second, per key
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	dropped map[string]uint64
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewWriteRateLimiter returns a limiter allowing rate spans per second per
+// key, with the given burst size (default: one second's worth).
+func NewWriteRateLimiter(rate, burst float64) *WriteRateLimiter {
+	if burst <= 0 {
+		burst = rate
+	}
+	return &WriteRateLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*tokenBucket),
+		dropped: make(map[string]uint64),
+	}
+}
+
+// Allow consumes one token for key, reporting whether the write may proceed.
+// Denied writes are counted; see Dropped.
+func (l *WriteRateLimiter) Allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		l.dropped[key]++
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// Dropped returns the cumulative count of rate-limited writes for key.
+func (l *WriteRateLimiter) Dropped(key string) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.dropped[key]
+}
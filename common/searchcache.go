@@ -0,0 +1,159 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+var _ spanstore.Reader = (*SearchCachingReader)(nil)
+
+// DefaultSearchCacheTTL is how long cached search results stay fresh.
+const DefaultSearchCacheTTL = 5 * time.Second
+
+// SearchCachingReader decorates a spanstore.Reader with a short-TTL cache of
+// FindTraces and FindTraceIDs results, keyed by normalized query parameters.
+// The Jaeger UI auto-refreshes and dashboards are often open in several
+// browsers at once; without the cache each viewer re-executes the same
+// expensive Flux search. Cached traces are shared, not copied.
+type SearchCachingReader struct {
+	reader spanstore.Reader
+	ttl    time.Duration
+
+	mtx      sync.Mutex
+	traces   map[string]cachedTraces
+	traceIDs map[string]cachedTraceIDs
+}
+
+type cachedTraces struct {
+	traces  []*model.Trace
+	expires time.Time
+}
+
+type cachedTraceIDs struct {
+	traceIDs []model.TraceID
+	expires  time.Time
+}
+
+// NewSearchCachingReader returns a caching decorator around reader; results
+// expire after ttl.
+func NewSearchCachingReader(reader spanstore.Reader, ttl time.Duration) *SearchCachingReader {
+	if ttl <= 0 {
+		ttl = DefaultSearchCacheTTL
+	}
+	return &SearchCachingReader{
+		reader:   reader,
+		ttl:      ttl,
+		traces:   make(map[string]cachedTraces),
+		traceIDs: make(map[string]cachedTraceIDs),
+	}
+}
+
+// GetTrace is served directly; single-trace loads are cheap relative to searches.
+func (r *SearchCachingReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	return r.reader.GetTrace(ctx, traceID)
+}
+
+// GetServices is served directly.
+func (r *SearchCachingReader) GetServices(ctx context.Context) ([]string, error) {
+	return r.reader.GetServices(ctx)
+}
+
+// GetOperations is served directly.
+func (r *SearchCachingReader) GetOperations(ctx context.Context, param spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	return r.reader.GetOperations(ctx, param)
+}
+
+// FindTraces serves a recent identical search from cache, otherwise delegates
+// and caches the result.
+func (r *SearchCachingReader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	key := searchCacheKey(query)
+	now := time.Now()
+
+	r.mtx.Lock()
+	cached, found := r.traces[key]
+	r.mtx.Unlock()
+	if found && now.Before(cached.expires) {
+		return cached.traces, nil
+	}
+
+	traces, err := r.reader.FindTraces(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mtx.Lock()
+	r.evictExpiredLocked(now)
+	r.traces[key] = cachedTraces{traces: traces, expires: now.Add(r.ttl)}
+	r.mtx.Unlock()
+
+	return traces, nil
+}
+
+// FindTraceIDs serves a recent identical search from cache, otherwise
+// delegates and caches the result.
+func (r *SearchCachingReader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	key := searchCacheKey(query)
+	now := time.Now()
+
+	r.mtx.Lock()
+	cached, found := r.traceIDs[key]
+	r.mtx.Unlock()
+	if found && now.Before(cached.expires) {
+		return cached.traceIDs, nil
+	}
+
+	traceIDs, err := r.reader.FindTraceIDs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mtx.Lock()
+	r.evictExpiredLocked(now)
+	r.traceIDs[key] = cachedTraceIDs{traceIDs: traceIDs, expires: now.Add(r.ttl)}
+	r.mtx.Unlock()
+
+	return traceIDs, nil
+}
+
+// evictExpiredLocked drops expired entries; the cache stays small because
+// entries only live for a few seconds.
+func (r *SearchCachingReader) evictExpiredLocked(now time.Time) {
+	for key, cached := range r.traces {
+		if !now.Before(cached.expires) {
+			delete(r.traces, key)
+		}
+	}
+	for key, cached := range r.traceIDs {
+		if !now.Before(cached.expires) {
+			delete(r.traceIDs, key)
+		}
+	}
+}
+
+// searchCacheKey normalizes query parameters into a cache key: times are
+// truncated to the second and tags are sorted, so the sliding windows of an
+// auto-refreshing UI land on the same entry within a second.
+func searchCacheKey(query *spanstore.TraceQueryParameters) string {
+	if query == nil {
+		return ""
+	}
+
+	tags := make([]string, 0, len(query.Tags))
+	for k, v := range query.Tags {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+
+	return fmt.Sprintf("%s|%s|%s|%d|%d|%d|%d|%d",
+		query.ServiceName, query.OperationName, strings.Join(tags, ","),
+		query.StartTimeMin.Unix(), query.StartTimeMax.Unix(),
+		query.DurationMin.Nanoseconds(), query.DurationMax.Nanoseconds(),
+		query.NumTraces)
+}
@@ -0,0 +1,172 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/dependencystore"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+// MetadataReader combines the reader interfaces whose results can be served
+// stale during an outage.
+type MetadataReader interface {
+	spanstore.Reader
+	dependencystore.Reader
+}
+
+var _ MetadataReader = (*StaleMetadataReader)(nil)
+
+// StaleMetadataReader decorates a reader, remembering the last successful
+// GetServices, GetOperations and GetDependencies results. When those queries
+// fail due to backend unavailability, the last known results are served
+// (marked stale in the log) so the Jaeger UI stays navigable during short
+// outages instead of erroring completely.
+type StaleMetadataReader struct {
+	reader MetadataReader
+
+	mu           sync.RWMutex
+	services     []string
+	servicesAt   time.Time
+	operations   map[string][]spanstore.Operation
+	operationsAt map[string]time.Time
+	dependencies []model.DependencyLink
+	dependsAt    time.Time
+
+	stop   chan struct{}
+	stopWG sync.WaitGroup
+
+	logger hclog.Logger
+}
+
+// NewStaleMetadataReader returns a stale-fallback decorator around reader.
+func NewStaleMetadataReader(reader MetadataReader, logger hclog.Logger) *StaleMetadataReader {
+	return &StaleMetadataReader{
+		reader:       reader,
+		operations:   make(map[string][]spanstore.Operation),
+		operationsAt: make(map[string]time.Time),
+		stop:         make(chan struct{}),
+		logger:       logger,
+	}
+}
+
+// Flush discards the named cache ("services", "operations" or
+// "dependencies"), or every cache when name is "all" or empty. Useful right
+// after onboarding a new service, without restarting the plugin.
+func (r *StaleMetadataReader) Flush(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if name == "services" || name == "all" || name == "" {
+		r.services = nil
+		r.servicesAt = time.Time{}
+	}
+	if name == "operations" || name == "all" || name == "" {
+		r.operations = make(map[string][]spanstore.Operation)
+		r.operationsAt = make(map[string]time.Time)
+	}
+	if name == "dependencies" || name == "all" || name == "" {
+		r.dependencies = nil
+		r.dependsAt = time.Time{}
+	}
+}
+
+// GetTrace delegates.
+func (r *StaleMetadataReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	return r.reader.GetTrace(ctx, traceID)
+}
+
+// GetServices delegates, falling back to the last known services on failure.
+func (r *StaleMetadataReader) GetServices(ctx context.Context) ([]string, error) {
+	services, err := r.reader.GetServices(ctx)
+	if err != nil {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		if r.services != nil {
+			r.logger.Warn("serving stale services; backend unavailable",
+				"age", time.Since(r.servicesAt).String(), "error", err)
+			return r.services, nil
+		}
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.services = services
+	r.servicesAt = time.Now()
+	r.mu.Unlock()
+	return services, nil
+}
+
+// GetOperations delegates, falling back to the last known operations on failure.
+func (r *StaleMetadataReader) GetOperations(ctx context.Context, param spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	key := param.ServiceName + "\x00" + param.SpanKind
+	operations, err := r.reader.GetOperations(ctx, param)
+	if err != nil {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		if cached, found := r.operations[key]; found {
+			r.logger.Warn("serving stale operations; backend unavailable",
+				"service", param.ServiceName, "age", time.Since(r.operationsAt[key]).String(), "error", err)
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.operations[key] = operations
+	r.operationsAt[key] = time.Now()
+	r.mu.Unlock()
+	return operations, nil
+}
+
+// FindTraces delegates.
+func (r *StaleMetadataReader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	return r.reader.FindTraces(ctx, query)
+}
+
+// FindTraceIDs delegates.
+func (r *StaleMetadataReader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	return r.reader.FindTraceIDs(ctx, query)
+}
+
+// dependencyReaderWithContext is implemented by dependency readers whose
+// GetDependencies honors caller cancellation; the dependencystore.Reader
+// interface predates context.
+type dependencyReaderWithContext interface {
+	GetDependenciesWithContext(ctx context.Context, endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error)
+}
+
+// GetDependencies delegates, falling back to the last known links on failure.
+func (r *StaleMetadataReader) GetDependencies(endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	return r.GetDependenciesWithContext(context.Background(), endTs, lookback)
+}
+
+// GetDependenciesWithContext is GetDependencies honoring the caller's context.
+func (r *StaleMetadataReader) GetDependenciesWithContext(ctx context.Context, endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	var dependencies []model.DependencyLink
+	var err error
+	if reader, ok := r.reader.(dependencyReaderWithContext); ok {
+		dependencies, err = reader.GetDependenciesWithContext(ctx, endTs, lookback)
+	} else {
+		dependencies, err = r.reader.GetDependencies(endTs, lookback)
+	}
+	if err != nil {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		if r.dependencies != nil {
+			r.logger.Warn("serving stale dependencies; backend unavailable",
+				"age", time.Since(r.dependsAt).String(), "error", err)
+			return r.dependencies, nil
+		}
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.dependencies = dependencies
+	r.dependsAt = time.Now()
+	r.mu.Unlock()
+	return dependencies, nil
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+// RefreshInBackground proactively refreshes the services and operations
+// caches every interval (with up to 10% jitter to avoid synchronized query
+// instances), rather than only on user requests. This eliminates the
+// periodic slow first request after the cached metadata goes stale.
+func (r *StaleMetadataReader) RefreshInBackground(interval time.Duration) {
+	r.stopWG.Add(1)
+	go func() {
+		defer r.stopWG.Done()
+
+		t := time.NewTimer(withJitter(interval))
+		defer t.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-t.C:
+				r.refresh(context.Background())
+				t.Reset(withJitter(interval))
+			}
+		}
+	}()
+}
+
+func (r *StaleMetadataReader) refresh(ctx context.Context) {
+	// GetServices and GetOperations update the caches on success.
+	services, err := r.GetServices(ctx)
+	if err != nil {
+		r.logger.Warn("background metadata refresh failed", "error", err)
+		return
+	}
+	for _, service := range services {
+		if _, err := r.GetOperations(ctx, spanstore.OperationQueryParameters{ServiceName: service}); err != nil {
+			r.logger.Warn("background metadata refresh failed", "service", service, "error", err)
+		}
+	}
+}
+
+func withJitter(interval time.Duration) time.Duration {
+	return interval + time.Duration(rand.Int63n(int64(interval)/10+1))
+}
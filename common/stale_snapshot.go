@@ -0,0 +1,107 @@
+package common
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/pkg/errors"
+)
+
+// metadataSnapshot is the JSON-serialized form of the cached metadata.
+type metadataSnapshot struct {
+	Services       []string                         `json:"services"`
+	ServicesAt     time.Time                        `json:"services_at"`
+	Operations     map[string][]spanstore.Operation `json:"operations"`
+	OperationsAt   map[string]time.Time             `json:"operations_at"`
+	Dependencies   []model.DependencyLink           `json:"dependencies"`
+	DependenciesAt time.Time                        `json:"dependencies_at"`
+}
+
+// PersistSnapshots loads any existing metadata snapshot from path, then
+// writes a fresh snapshot every interval. A freshly restarted query instance
+// thereby has populated dropdowns instead of a stampede of metadata queries.
+// Call Close to stop snapshotting.
+func (r *StaleMetadataReader) PersistSnapshots(path string, interval time.Duration) {
+	if err := r.loadSnapshot(path); err != nil && !os.IsNotExist(errors.Cause(err)) {
+		r.logger.Warn("failed to load metadata snapshot", "path", path, "error", err)
+	}
+
+	r.stopWG.Add(1)
+	go func() {
+		defer r.stopWG.Done()
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-t.C:
+				if err := r.writeSnapshot(path); err != nil {
+					r.logger.Warn("failed to write metadata snapshot", "path", path, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Close triggers a graceful shutdown of background snapshotting and refresh.
+func (r *StaleMetadataReader) Close() error {
+	close(r.stop)
+	r.stopWG.Wait()
+	return nil
+}
+
+func (r *StaleMetadataReader) loadSnapshot(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var snapshot metadataSnapshot
+	if err = json.Unmarshal(b, &snapshot); err != nil {
+		return errors.Wrap(err, "failed to parse metadata snapshot")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.services = snapshot.Services
+	r.servicesAt = snapshot.ServicesAt
+	if snapshot.Operations != nil {
+		r.operations = snapshot.Operations
+	}
+	if snapshot.OperationsAt != nil {
+		r.operationsAt = snapshot.OperationsAt
+	}
+	r.dependencies = snapshot.Dependencies
+	r.dependsAt = snapshot.DependenciesAt
+	return nil
+}
+
+func (r *StaleMetadataReader) writeSnapshot(path string) error {
+	r.mu.RLock()
+	snapshot := metadataSnapshot{
+		Services:       r.services,
+		ServicesAt:     r.servicesAt,
+		Operations:     r.operations,
+		OperationsAt:   r.operationsAt,
+		Dependencies:   r.dependencies,
+		DependenciesAt: r.dependsAt,
+	}
+	b, err := json.Marshal(&snapshot)
+	r.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename, so readers never see a torn snapshot.
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,160 @@
+package common
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+var _ spanstore.Reader = (*TraceCachingReader)(nil)
+
+// DefaultTraceCacheTTL is how long cached traces stay fresh.
+const DefaultTraceCacheTTL = time.Minute
+
+// TraceCachingReader decorates a spanstore.Reader with an LRU cache of whole
+// traces keyed by trace ID. UI refreshes and deep links shared around a team
+// open the same trace repeatedly; without the cache each view re-queries
+// InfluxDB. Entries expire after a TTL, since spans of a recent trace can
+// still be arriving, and total cache memory is bounded by evicting the least
+// recently used traces. Cached traces are shared, not copied.
+type TraceCachingReader struct {
+	reader   spanstore.Reader
+	ttl      time.Duration
+	maxBytes int64
+
+	negativeTTL time.Duration
+
+	mtx     sync.Mutex
+	entries map[model.TraceID]*list.Element
+	order   *list.List // Front is most recently used
+	bytes   int64
+	missing map[model.TraceID]time.Time
+}
+
+type cachedTrace struct {
+	traceID model.TraceID
+	trace   *model.Trace
+	size    int64
+	expires time.Time
+}
+
+// NewTraceCachingReader returns a caching decorator around reader. Traces
+// expire after ttl, and the cache holds at most maxBytes of trace data (zero
+// means unbounded).
+func NewTraceCachingReader(reader spanstore.Reader, ttl time.Duration, maxBytes int64) *TraceCachingReader {
+	if ttl <= 0 {
+		ttl = DefaultTraceCacheTTL
+	}
+	return &TraceCachingReader{
+		reader:   reader,
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		entries:  make(map[model.TraceID]*list.Element),
+		order:    list.New(),
+		missing:  make(map[model.TraceID]time.Time),
+	}
+}
+
+// SetNegativeTTL also caches confirmed-missing trace IDs for ttl, so
+// repeated lookups of a bad or expired trace ID don't each trigger a full
+// range scan. Keep the TTL short: a trace reported missing can appear once
+// its spans arrive.
+func (r *TraceCachingReader) SetNegativeTTL(ttl time.Duration) {
+	if ttl > 0 {
+		r.negativeTTL = ttl
+	}
+}
+
+// GetTrace serves a recently fetched trace from cache, otherwise delegates
+// and caches the result; a trace ID recently confirmed missing fails fast.
+func (r *TraceCachingReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	now := time.Now()
+
+	r.mtx.Lock()
+	if element, found := r.entries[traceID]; found {
+		cached := element.Value.(*cachedTrace)
+		if now.Before(cached.expires) {
+			r.order.MoveToFront(element)
+			r.mtx.Unlock()
+			return cached.trace, nil
+		}
+		r.removeLocked(element)
+	}
+	if expires, found := r.missing[traceID]; found {
+		if now.Before(expires) {
+			r.mtx.Unlock()
+			return nil, spanstore.ErrTraceNotFound
+		}
+		delete(r.missing, traceID)
+	}
+	r.mtx.Unlock()
+
+	trace, err := r.reader.GetTrace(ctx, traceID)
+	if err != nil {
+		if err == spanstore.ErrTraceNotFound && r.negativeTTL > 0 {
+			r.mtx.Lock()
+			for id, expires := range r.missing {
+				if !now.Before(expires) {
+					delete(r.missing, id)
+				}
+			}
+			r.missing[traceID] = now.Add(r.negativeTTL)
+			r.mtx.Unlock()
+		}
+		return nil, err
+	}
+
+	r.mtx.Lock()
+	if element, found := r.entries[traceID]; found {
+		// A concurrent fetch cached this trace first; replace it.
+		r.removeLocked(element)
+	}
+	entry := &cachedTrace{
+		traceID: traceID,
+		trace:   trace,
+		size:    int64(trace.Size()),
+		expires: now.Add(r.ttl),
+	}
+	r.entries[traceID] = r.order.PushFront(entry)
+	r.bytes += entry.size
+	if r.maxBytes > 0 {
+		for r.bytes > r.maxBytes && r.order.Len() > 1 {
+			r.removeLocked(r.order.Back())
+		}
+	}
+	r.mtx.Unlock()
+
+	return trace, nil
+}
+
+// removeLocked drops one cache entry and its accounted bytes.
+func (r *TraceCachingReader) removeLocked(element *list.Element) {
+	entry := element.Value.(*cachedTrace)
+	r.order.Remove(element)
+	delete(r.entries, entry.traceID)
+	r.bytes -= entry.size
+}
+
+// GetServices is served directly.
+func (r *TraceCachingReader) GetServices(ctx context.Context) ([]string, error) {
+	return r.reader.GetServices(ctx)
+}
+
+// GetOperations is served directly.
+func (r *TraceCachingReader) GetOperations(ctx context.Context, param spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	return r.reader.GetOperations(ctx, param)
+}
+
+// FindTraces is served directly; searches change from call to call.
+func (r *TraceCachingReader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	return r.reader.FindTraces(ctx, query)
+}
+
+// FindTraceIDs is served directly.
+func (r *TraceCachingReader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	return r.reader.FindTraceIDs(ctx, query)
+}
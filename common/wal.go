@@ -0,0 +1,210 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultWALSegmentBytes rotates write-ahead log segments once they
+	// exceed this size.
+	DefaultWALSegmentBytes = 64 << 20
+
+	// DefaultWALMaxBytes caps the rotated segments kept on disk; the oldest
+	// are deleted beyond it, bounding both disk use and the points re-sent
+	// by a replay.
+	DefaultWALMaxBytes = 1 << 30
+)
+
+// walSegmentPattern names segment files; the sequence number keeps them
+// sortable by age.
+const walSegmentPattern = "wal-%08d.log"
+
+// WriteWAL persists the write path's line-protocol points to a local
+// write-ahead log, so points buffered in memory survive a plugin restart or
+// a short InfluxDB outage. Every submitted point is appended; segments
+// rotate by size and the oldest are deleted beyond a total cap. A restart
+// replays whatever the log holds — including points that were already
+// written, which overwrite themselves harmlessly since a span always maps
+// to the same series and timestamp. The log is not fsynced, so it survives
+// a process restart but not host power loss.
+type WriteWAL struct {
+	dir          string
+	segmentBytes int64
+	maxBytes     int64
+
+	mu        sync.Mutex
+	recovered []string // segments found at open, pending replay
+	segments  []walSegment
+	seq       int
+	cur       *os.File
+	curSize   int64
+}
+
+type walSegment struct {
+	path string
+	size int64
+}
+
+// NewWriteWAL opens (creating if needed) a write-ahead log in dir. Segments
+// rotate at segmentBytes and rotated segments are capped at maxBytes in
+// total; zero keeps the corresponding default. Segments left by an earlier
+// run are held for Replay.
+func NewWriteWAL(dir string, segmentBytes, maxBytes int64) (*WriteWAL, error) {
+	if segmentBytes <= 0 {
+		segmentBytes = DefaultWALSegmentBytes
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultWALMaxBytes
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create WAL directory")
+	}
+
+	recovered, err := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(recovered)
+
+	w := &WriteWAL{
+		dir:          dir,
+		segmentBytes: segmentBytes,
+		maxBytes:     maxBytes,
+		recovered:    recovered,
+	}
+	if len(recovered) > 0 {
+		// Resume numbering after the recovered segments so replay order
+		// stays chronological.
+		if _, err := fmt.Sscanf(filepath.Base(recovered[len(recovered)-1]), "wal-%d.log", &w.seq); err == nil {
+			w.seq++
+		} else {
+			w.seq = len(recovered)
+		}
+	}
+	if err := w.openSegment(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// openSegment starts the next segment file; callers hold the mutex or have
+// exclusive access.
+func (w *WriteWAL) openSegment() error {
+	f, err := os.OpenFile(filepath.Join(w.dir, fmt.Sprintf(walSegmentPattern, w.seq)), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open WAL segment")
+	}
+	w.seq++
+	w.cur = f
+	w.curSize = 0
+	return nil
+}
+
+// Replay delivers every point persisted by an earlier run to fn, oldest
+// first, deleting each segment once consumed. Deliver the points back into
+// the write path through a method that appends to this log, so they stay
+// durable until flushed.
+func (w *WriteWAL) Replay(fn func(line string)) error {
+	w.mu.Lock()
+	recovered := w.recovered
+	w.recovered = nil
+	w.mu.Unlock()
+
+	for _, path := range recovered {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		r := bufio.NewReader(f)
+		for {
+			line, err := r.ReadString('\n')
+			if line != "" {
+				fn(line[:len(line)-len("\n")])
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				f.Close()
+				return err
+			}
+		}
+		f.Close()
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Append persists one point's line protocol, rotating the segment when it
+// exceeds the configured size.
+func (w *WriteWAL) Append(line string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.cur.WriteString(line + "\n"); err != nil {
+		return err
+	}
+	w.curSize += int64(len(line)) + 1
+	if w.curSize < w.segmentBytes {
+		return nil
+	}
+
+	if err := w.cur.Close(); err != nil {
+		return err
+	}
+	w.segments = append(w.segments, walSegment{path: w.cur.Name(), size: w.curSize})
+
+	var total int64
+	for _, seg := range w.segments {
+		total += seg.size
+	}
+	for len(w.segments) > 0 && total > w.maxBytes {
+		if err := os.Remove(w.segments[0].path); err != nil {
+			return err
+		}
+		total -= w.segments[0].size
+		w.segments = w.segments[1:]
+	}
+
+	return w.openSegment()
+}
+
+// Truncate discards the whole log; call it when every appended point is
+// known to have been flushed, e.g. on a clean shutdown.
+func (w *WriteWAL) Truncate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, seg := range w.segments {
+		if err := os.Remove(seg.path); err != nil {
+			return err
+		}
+	}
+	w.segments = nil
+	if err := w.cur.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.cur.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.curSize = 0
+	return nil
+}
+
+// Close closes the current segment; pending segments stay on disk for the
+// next run's Replay.
+func (w *WriteWAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cur.Close()
+}
@@ -0,0 +1,107 @@
+package common
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Full-queue policies for WriteQueue.
+const (
+	// QueuePolicyBlock applies backpressure: the writer blocks until the
+	// flusher frees a slot. The default.
+	QueuePolicyBlock = "block"
+
+	// QueuePolicyDropNew refuses the incoming point.
+	QueuePolicyDropNew = "drop-new"
+
+	// QueuePolicyDropOld evicts the oldest queued point to admit the new
+	// one, preferring fresh spans over stale ones.
+	QueuePolicyDropOld = "drop-old"
+)
+
+// WriteQueue bounds the points buffered between span ingestion and the
+// batching flusher, so a slow or unreachable InfluxDB cannot grow the
+// plugin's memory without limit. When the queue is full the configured
+// policy decides whether the writer blocks, the new point is refused, or
+// the oldest queued point is evicted.
+type WriteQueue struct {
+	ch        chan string
+	policy    string
+	dropped   uint64
+	closeOnce sync.Once
+}
+
+// NewWriteQueue returns a queue holding at most capacity points, applying
+// policy (one of the QueuePolicy constants) when full.
+func NewWriteQueue(capacity int, policy string) *WriteQueue {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	if policy == "" {
+		policy = QueuePolicyBlock
+	}
+	return &WriteQueue{
+		ch:     make(chan string, capacity),
+		policy: policy,
+	}
+}
+
+// Push queues one point's line protocol, reporting whether it was admitted
+// without loss: false means the point was refused (drop-new) or an older
+// point was evicted to make room (drop-old). Lost points are counted; see
+// Dropped.
+func (q *WriteQueue) Push(line string) bool {
+	switch q.policy {
+	case QueuePolicyDropNew:
+		select {
+		case q.ch <- line:
+			return true
+		default:
+			atomic.AddUint64(&q.dropped, 1)
+			return false
+		}
+	case QueuePolicyDropOld:
+		evicted := false
+		for {
+			select {
+			case q.ch <- line:
+				return !evicted
+			default:
+			}
+			select {
+			case <-q.ch:
+				atomic.AddUint64(&q.dropped, 1)
+				evicted = true
+			default:
+			}
+		}
+	default: // QueuePolicyBlock
+		q.ch <- line
+		return true
+	}
+}
+
+// Drain delivers queued points to fn until Close, then delivers the
+// remainder and returns.
+func (q *WriteQueue) Drain(fn func(string)) {
+	for line := range q.ch {
+		fn(line)
+	}
+}
+
+// Close stops the queue; Drain returns once the remaining points are
+// delivered. Push must not be called after Close.
+func (q *WriteQueue) Close() {
+	q.closeOnce.Do(func() { close(q.ch) })
+}
+
+// Depth returns the number of points currently queued.
+func (q *WriteQueue) Depth() int {
+	return len(q.ch)
+}
+
+// Dropped returns the cumulative count of points lost to the full-queue
+// policy.
+func (q *WriteQueue) Dropped() uint64 {
+	return atomic.LoadUint64(&q.dropped)
+}
@@ -9,8 +9,106 @@ import (
 const (
 	influxDBPrefix = "influxdb."
 
-	flagHost            = influxDBPrefix + "host"
-	flagDefaultLookback = influxDBPrefix + "default-lookback"
+	flagHost                 = influxDBPrefix + "host"
+	flagDefaultLookback      = influxDBPrefix + "default-lookback"
+	flagMaxLookback          = influxDBPrefix + "max-lookback"
+	flagMaxTraceIDsPerQuery  = influxDBPrefix + "max-trace-ids-per-query"
+	flagDialTimeout          = influxDBPrefix + "dial-timeout"
+	flagConnRecycleInterval  = influxDBPrefix + "conn-recycle-interval"
+	flagSRVRecord            = influxDBPrefix + "srv-record"
+	flagDiscoveryInterval    = influxDBPrefix + "discovery-refresh-interval"
+	flagTraceQualityInterval = influxDBPrefix + "trace-quality-interval"
+	flagCanaryInterval       = influxDBPrefix + "canary-interval"
+	flagSpanMetricsInterval  = influxDBPrefix + "span-metrics-interval"
+	flagSpanMetricsSource    = influxDBPrefix + "span-metrics-source"
+	flagMaxQueryWindow       = influxDBPrefix + "max-query-window"
+	flagTraceMemoryBudget    = influxDBPrefix + "trace-memory-budget"
+	flagMaxResponseBytes     = influxDBPrefix + "max-response-bytes"
+	flagMaxRowsPerQuery      = influxDBPrefix + "max-rows-per-query"
+	flagMaxServices          = influxDBPrefix + "max-services"
+	flagMetaQueryLookback    = influxDBPrefix + "meta-query-lookback"
+	flagQueryRetries         = influxDBPrefix + "query-retries"
+	flagFastCSVDecoder       = influxDBPrefix + "fast-csv-decoder"
+	flagSlowQueryThreshold   = influxDBPrefix + "slow-query-threshold"
+	flagFluxProfiling        = influxDBPrefix + "flux-profiling"
+	flagMaxConcurrentQueries = influxDBPrefix + "max-concurrent-queries"
+	flagWriteRateLimit       = influxDBPrefix + "write-rate-limit"
+	flagWriteRateBurst       = influxDBPrefix + "write-rate-burst"
+
+	flagWriteQuotaPointsPerDay = influxDBPrefix + "write-quota-points-per-day"
+	flagWriteQuotaBytesPerDay  = influxDBPrefix + "write-quota-bytes-per-day"
+	flagWriteQuotaSampleRate   = influxDBPrefix + "write-quota-sample-rate"
+
+	flagAuditLog         = influxDBPrefix + "audit-log"
+	flagAccessPolicyFile = influxDBPrefix + "access-policy-file"
+
+	flagEncryptionKey = influxDBPrefix + "encryption-key" // #nosec
+	flagEncryptTags   = influxDBPrefix + "encrypt-tags"
+
+	flagRetryStartup             = influxDBPrefix + "retry-startup"
+	flagStaleMetadataFallback    = influxDBPrefix + "stale-metadata-fallback"
+	flagMetadataSnapshotFile     = influxDBPrefix + "metadata-snapshot-file"
+	flagMetadataSnapshotInterval = influxDBPrefix + "metadata-snapshot-interval"
+	flagMetadataRefreshInterval  = influxDBPrefix + "metadata-refresh-interval"
+	flagAdminAddr                = influxDBPrefix + "admin-addr"
+
+	flagFluxTemplateDir  = influxDBPrefix + "flux-template-dir"
+	flagSearchFilterFlux = influxDBPrefix + "search-filter-flux"
+
+	flagReadConsistencyDelay = influxDBPrefix + "read-consistency-delay"
+	flagGetTraceRetryDelay   = influxDBPrefix + "get-trace-retry-delay"
+
+	flagSearchCacheTTL          = influxDBPrefix + "search-cache-ttl"
+	flagTraceCacheTTL           = influxDBPrefix + "trace-cache-ttl"
+	flagTraceCacheMaxBytes      = influxDBPrefix + "trace-cache-max-bytes"
+	flagTraceCacheNegativeTTL   = influxDBPrefix + "trace-cache-negative-ttl"
+	flagMetadataCacheTTL        = influxDBPrefix + "metadata-cache-ttl"
+	flagMetadataCacheSize       = influxDBPrefix + "metadata-cache-size"
+	flagMetadataWarmInterval    = influxDBPrefix + "metadata-warm-interval"
+	flagTraceFetchConcurrency   = influxDBPrefix + "trace-fetch-concurrency"
+	flagRegexTags               = influxDBPrefix + "regex-tags"
+	flagLogQueries              = influxDBPrefix + "log-queries"
+	flagSkipSearchLogs          = influxDBPrefix + "skip-search-logs"
+	flagTagQueriesWithRequestID = influxDBPrefix + "tag-queries-with-request-id"
+
+	flagDependencyQueryChunk = influxDBPrefix + "dependency-query-chunk"
+
+	flagGetTraceTimeout        = influxDBPrefix + "get-trace-timeout"
+	flagFindTraceIDsTimeout    = influxDBPrefix + "find-trace-ids-timeout"
+	flagFindTracesTimeout      = influxDBPrefix + "find-traces-timeout"
+	flagGetServicesTimeout     = influxDBPrefix + "get-services-timeout"
+	flagGetDependenciesTimeout = influxDBPrefix + "get-dependencies-timeout"
+
+	flagCircuitBreakerThreshold = influxDBPrefix + "circuit-breaker-threshold"
+	flagCircuitBreakerCoolDown  = influxDBPrefix + "circuit-breaker-cooldown"
+
+	flagAdjusters          = influxDBPrefix + "adjusters"
+	flagClockSkewMaxAdjust = influxDBPrefix + "clock-skew-max-adjust"
+
+	flagCollisionStrategy      = influxDBPrefix + "collision-strategy"
+	flagCollisionDetectionSize = influxDBPrefix + "collision-detection-cache-size"
+
+	flagWriteFlushPoints   = influxDBPrefix + "write-flush-points"
+	flagWriteFlushInterval = influxDBPrefix + "write-flush-interval"
+	flagWriteQueueSize     = influxDBPrefix + "write-queue-size"
+	flagWriteQueuePolicy   = influxDBPrefix + "write-queue-policy"
+	flagWALDir             = influxDBPrefix + "wal-dir"
+	flagWALSegmentBytes    = influxDBPrefix + "wal-segment-bytes"
+	flagWALMaxBytes        = influxDBPrefix + "wal-max-bytes"
+
+	flagSpanChecksums     = influxDBPrefix + "span-checksums"
+	flagDedupeCacheSize   = influxDBPrefix + "dedupe-cache-size"
+	flagWriteLagThreshold = influxDBPrefix + "write-lag-threshold"
+	flagWriteBackpressure = influxDBPrefix + "write-backpressure"
+
+	flagFlatSpanMeasurement     = influxDBPrefix + "flat-span-measurement"
+	flagSinglePointSpans        = influxDBPrefix + "single-point-spans"
+	flagMaxEmbeddedLogBytes     = influxDBPrefix + "max-embedded-log-bytes"
+	flagLogCompressionThreshold = influxDBPrefix + "log-compression-threshold"
+
+	// Measurement names from before a rename, kept readable for a transition period
+	flagSpanMeasurementAliases = influxDBPrefix + "span-measurement-aliases"
+	flagLogMeasurementAliases  = influxDBPrefix + "log-measurement-aliases"
 
 	// InfluxDB v1.x
 	flagDatabase        = influxDBPrefix + "database"
@@ -20,15 +118,329 @@ const (
 	flagUnsafeSsl       = influxDBPrefix + "unsafe_ssl"
 
 	// InfluxDB v2.x
-	flagToken        = influxDBPrefix + "token" // #nosec
-	flagOrganization = influxDBPrefix + "organization"
-	flagBucket       = influxDBPrefix + "bucket"
+	flagToken                = influxDBPrefix + "token" // #nosec
+	flagOrganization         = influxDBPrefix + "organization"
+	flagBucket               = influxDBPrefix + "bucket"
+	flagArchiveBucket        = influxDBPrefix + "archive-bucket"
+	flagColdBuckets          = influxDBPrefix + "cold-buckets"
+	flagFederatedReadTargets = influxDBPrefix + "federated-read-targets"
+	flagHedgeAddr            = influxDBPrefix + "hedge-addr"
+	flagHedgeDelay           = influxDBPrefix + "hedge-delay"
+
+	// InfluxDB v3.x
+	flagV3Database = influxDBPrefix + "v3-database"
 )
 
 // Configuration describes the options to customize the storage behavior
 type Configuration struct {
-	Host            string        `yaml:"host"`
+	Host string `yaml:"host"`
+	// DefaultLookback is how far back queries reach when the request carries
+	// no explicit time range, expressed as a positive duration (e.g. 6h).
+	// Older configurations expressed it as a negative offset from now;
+	// negative values are still accepted and treated as their absolute value.
 	DefaultLookback time.Duration `yaml:"default_lookback"`
+	// MaxLookback lets GetTrace widen its search window progressively beyond
+	// DefaultLookback, up to this bound (typically the bucket's retention),
+	// before concluding a trace does not exist; zero disables widening.
+	// InfluxDB v2.x only.
+	MaxLookback         time.Duration `yaml:"max_lookback"`
+	MaxTraceIDsPerQuery int           `yaml:"max_trace_ids_per_query"`
+	MaxQueryWindow      time.Duration `yaml:"max_query_window"`
+	// TraceMemoryBudget bounds the bytes of spans and logs decoded from one
+	// trace query; oversized results come back truncated with a warning.
+	// Zero means unlimited.
+	TraceMemoryBudget int64 `yaml:"trace_memory_budget"`
+	// MaxResponseBytes fails a Flux query once more than this many response
+	// bytes have been read off the wire; zero means unlimited. InfluxDB v2.x
+	// only.
+	MaxResponseBytes int64 `yaml:"max_response_bytes"`
+	// MaxRowsPerQuery caps the rows each result table of a generated Flux
+	// query may return, via a server-side limit(); a warning is logged when
+	// the cap is hit. Zero means uncapped. InfluxDB v2.x only.
+	MaxRowsPerQuery int `yaml:"max_rows_per_query"`
+	// MaxServices caps the service listing at this many names, applied
+	// server-side inside the Flux query. Zero means uncapped. InfluxDB v2.x
+	// only.
+	MaxServices int `yaml:"max_services"`
+	// MetaQueryLookback bounds service and operation discovery queries to
+	// this much recent data instead of scanning every retained shard; widen
+	// it when rarely-seen services must stay listed. Zero keeps the Flux
+	// library default. InfluxDB v2.x only.
+	MetaQueryLookback time.Duration `yaml:"meta_query_lookback"`
+	// QueryRetries retries transient query failures (429 and 5xx responses)
+	// up to this many times with jittered exponential backoff, honoring
+	// Retry-After; zero disables retries. InfluxDB v2.x only.
+	QueryRetries int `yaml:"query_retries"`
+	// FastCSVDecoder decodes query responses with a hand-rolled annotated-CSV
+	// decoder instead of the Flux library one; the library decoder dominates
+	// CPU on big traces. Responses are buffered whole rather than streamed,
+	// so pair it with MaxResponseBytes. InfluxDB v2.x only.
+	FastCSVDecoder bool `yaml:"fast_csv_decoder"`
+	// SlowQueryThreshold logs, at warn level, any Flux query that runs
+	// longer than this end to end, with its text, duration, and result row
+	// count; zero disables the slow query log. InfluxDB v2.x only.
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold"`
+	// FluxProfiling enables the server-side Flux query profiler on every
+	// query. The profiler's scanned-data and plan-timing statistics are
+	// folded into the per-operation statistics log and exported as metrics
+	// when the host process installs a metrics factory. InfluxDB v2.x only.
+	FluxProfiling bool `yaml:"flux_profiling"`
+	// MaxConcurrentQueries caps the Flux queries in flight at once; excess
+	// queries queue until a slot frees or their context expires. Zero means
+	// unlimited. InfluxDB v2.x only.
+	MaxConcurrentQueries int           `yaml:"max_concurrent_queries"`
+	DialTimeout          time.Duration `yaml:"dial_timeout"`
+	ConnRecycleInterval  time.Duration `yaml:"conn_recycle_interval"`
+	SRVRecord            string        `yaml:"srv_record"`
+	DiscoveryInterval    time.Duration `yaml:"discovery_refresh_interval"`
+
+	// TraceQualityInterval enables periodic trace quality analysis when > 0.
+	TraceQualityInterval time.Duration `yaml:"trace_quality_interval"`
+
+	// CanaryInterval enables a periodic synthetic trace write/read-back
+	// self-test when > 0.
+	CanaryInterval time.Duration `yaml:"canary_interval"`
+
+	// SpanMetricsInterval aggregates written spans into per-service,
+	// per-operation RED metrics with exemplar trace IDs, flushed on this
+	// interval when > 0. InfluxDB v2.x only.
+	SpanMetricsInterval time.Duration `yaml:"span_metrics_interval"`
+
+	// SpanMetricsSource selects where the metrics reader sources RED metrics:
+	// "spans" (default) reads the span-derived aggregates, "otel" reads the
+	// calls and duration measurements written by the influxdb-observability
+	// metrics exporter.
+	SpanMetricsSource string `yaml:"span_metrics_source"`
+
+	// WriteRateLimit enables per-service write rate limiting when > 0,
+	// in spans per second; WriteRateBurst defaults to one second's worth.
+	WriteRateLimit float64 `yaml:"write_rate_limit"`
+	WriteRateBurst float64 `yaml:"write_rate_burst"`
+
+	// Daily write quota for the destination database/bucket; 0 = unlimited.
+	// WriteQuotaSampleRate in (0, 1) samples over-quota points instead of
+	// rejecting them all.
+	WriteQuotaPointsPerDay int64   `yaml:"write_quota_points_per_day"`
+	WriteQuotaBytesPerDay  int64   `yaml:"write_quota_bytes_per_day"`
+	WriteQuotaSampleRate   float64 `yaml:"write_quota_sample_rate"`
+
+	// AuditLog records every read operation (method, caller, parameters,
+	// result size, latency) to a structured audit log.
+	AuditLog bool `yaml:"audit_log"`
+
+	// AccessPolicyFile restricts callers to the services their bearer token
+	// permits; see common.AccessPolicy for the file format.
+	AccessPolicyFile string `yaml:"access_policy_file"`
+
+	// EncryptionKey (hex encoded AES key) encrypts the values of the
+	// EncryptTags tag keys before writing, and decrypts them on read.
+	EncryptionKey string   `yaml:"encryption_key"`
+	EncryptTags   []string `yaml:"encrypt_tags"`
+
+	// FluxTemplateDir holds replacement Flux templates for specific queries
+	// (get-services.flux, get-operations.flux, find-trace-ids.flux,
+	// get-dependencies.flux), validated at startup. InfluxDB v2.x only.
+	FluxTemplateDir string `yaml:"flux_template_dir"`
+
+	// SearchFilterFlux is a Flux boolean expression over r injected into the
+	// filter of every span query, searches and trace fetches alike (e.g.
+	// `r.env == "prod"` to partition a shared bucket per deployment),
+	// validated at startup. InfluxDB v2.x only.
+	SearchFilterFlux string `yaml:"search_filter_flux"`
+
+	// Adjusters selects the post-processing applied to returned traces, in
+	// order; see the dbmodel.Adjuster* constants for the accepted names.
+	// ClockSkewMaxAdjust caps the clock-skew correction per span.
+	Adjusters          []string      `yaml:"adjusters"`
+	ClockSkewMaxAdjust time.Duration `yaml:"clock_skew_max_adjust"`
+
+	// CollisionStrategy selects how same-nanosecond span timestamp collisions
+	// are avoided: "jitter" (default) or "span-id-tag"; see the
+	// common.CollisionStrategy constants. CollisionDetectionCacheSize
+	// enables collision counting over that many recent span points when > 0.
+	CollisionStrategy           string `yaml:"collision_strategy"`
+	CollisionDetectionCacheSize int    `yaml:"collision_detection_cache_size"`
+
+	// SpanChecksums stores an integrity checksum field on each span point,
+	// verified on read.
+	SpanChecksums bool `yaml:"span_checksums"`
+
+	// DedupeCacheSize enables write-path suppression of duplicate spans when
+	// > 0, remembering that many recently written spans.
+	DedupeCacheSize int `yaml:"dedupe_cache_size"`
+
+	// TraceFetchConcurrency fetches trace ID chunks with this many concurrent
+	// queries during FindTraces; zero or one fetches sequentially.
+	TraceFetchConcurrency int `yaml:"trace_fetch_concurrency"`
+
+	// RegexTags interprets search tag values of the form ~/pattern/ as
+	// regular expressions pushed into the generated query.
+	RegexTags bool `yaml:"regex_tags"`
+
+	// LogQueries includes the full generated query text in the debug-level
+	// query log; off by default because query text can contain tag values.
+	LogQueries bool `yaml:"log_queries"`
+
+	// TagQueriesWithRequestID prefixes each generated query with a comment
+	// carrying the incoming request's trace context, so InfluxDB's query logs
+	// can be tied back to the Jaeger request that caused them. InfluxDB v2.x
+	// only.
+	TagQueriesWithRequestID bool `yaml:"tag_queries_with_request_id"`
+
+	// SkipSearchLogs omits span logs from FindTraces results, making
+	// searches much cheaper when log volume is high; GetTrace still returns
+	// full logs. A search tagged skip-logs=true or skip-logs=false overrides
+	// this default for one query. InfluxDB v2.x only.
+	SkipSearchLogs bool `yaml:"skip_search_logs"`
+
+	// DependencyQueryChunk splits the dependency query's time window into
+	// sub-windows of at most this duration, executed concurrently (bounded by
+	// TraceFetchConcurrency) and merged with summed call counts, so week-long
+	// lookbacks do not time out as one query. Zero queries the whole window at
+	// once. InfluxDB v2.x only.
+	DependencyQueryChunk time.Duration `yaml:"dependency_query_chunk"`
+
+	// Per-operation query timeouts, enforced as context deadlines, so one
+	// slow query class (e.g. dependency aggregation) cannot stall the UI
+	// indefinitely; zero leaves the corresponding operation unbounded.
+	GetTraceTimeout        time.Duration `yaml:"get_trace_timeout"`
+	FindTraceIDsTimeout    time.Duration `yaml:"find_trace_ids_timeout"`
+	FindTracesTimeout      time.Duration `yaml:"find_traces_timeout"`
+	GetServicesTimeout     time.Duration `yaml:"get_services_timeout"`
+	GetDependenciesTimeout time.Duration `yaml:"get_dependencies_timeout"`
+
+	// CircuitBreakerThreshold opens a circuit breaker around the query path
+	// after this many consecutive failures, failing queries fast until the
+	// cool-down elapses; zero disables the breaker. The cool-down defaults to
+	// common.DefaultCircuitBreakerCoolDown. InfluxDB v2.x only.
+	CircuitBreakerThreshold int           `yaml:"circuit_breaker_threshold"`
+	CircuitBreakerCoolDown  time.Duration `yaml:"circuit_breaker_cooldown"`
+
+	// ReadConsistencyDelay excludes the most recent interval of this length
+	// from search windows, so searches don't return partial traces whose spans
+	// are still in flight to InfluxDB; zero searches up to now. InfluxDB v2.x
+	// only.
+	ReadConsistencyDelay time.Duration `yaml:"read_consistency_delay"`
+
+	// GetTraceRetryDelay retries a not-found GetTrace once after this delay,
+	// so a trace opened immediately after ingest isn't reported missing; zero
+	// fails on the first miss. InfluxDB v2.x only.
+	GetTraceRetryDelay time.Duration `yaml:"get_trace_retry_delay"`
+
+	// SearchCacheTTL caches FindTraces/FindTraceIDs results for identical
+	// queries for this long, absorbing UI auto-refresh storms. Zero disables
+	// the cache.
+	SearchCacheTTL time.Duration `yaml:"search_cache_ttl"`
+
+	// TraceCacheTTL caches whole traces fetched by GetTrace for this long,
+	// so UI refreshes and shared deep links don't re-query InfluxDB; zero
+	// disables the cache. TraceCacheMaxBytes bounds the cache's memory,
+	// evicting the least recently used traces; zero means unbounded.
+	TraceCacheTTL      time.Duration `yaml:"trace_cache_ttl"`
+	TraceCacheMaxBytes int64         `yaml:"trace_cache_max_bytes"`
+
+	// TraceCacheNegativeTTL also caches confirmed-missing trace IDs for this
+	// long, so repeated lookups of a bad or expired trace ID don't each
+	// trigger a full range scan. Keep it short: a trace reported missing can
+	// appear once its spans arrive. Requires trace-cache-ttl; zero disables
+	// negative caching.
+	TraceCacheNegativeTTL time.Duration `yaml:"trace_cache_negative_ttl"`
+
+	// MetadataCacheTTL caches GetServices/GetOperations results for this
+	// long, sparing InfluxDB a tag-values scan per UI page load; zero
+	// disables the cache. MetadataCacheSize bounds the per-service operation
+	// entries kept, defaulting to common.DefaultMetadataCacheSize.
+	MetadataCacheTTL  time.Duration `yaml:"metadata_cache_ttl"`
+	MetadataCacheSize int           `yaml:"metadata_cache_size"`
+
+	// MetadataWarmInterval refreshes the metadata cache in the background on
+	// this interval (with jitter), so service/operation dropdowns are instant
+	// even after a cold start; requires MetadataCacheTTL. Zero disables the
+	// warmer.
+	MetadataWarmInterval time.Duration `yaml:"metadata_warm_interval"`
+
+	// WriteFlushPoints flushes a write batch once it holds this many points,
+	// and WriteFlushInterval flushes a partial batch this long after its
+	// first point, so larger batches can be traded against delivery latency
+	// under heavy span volume. Zero keeps the corresponding default (5000
+	// points, 1s).
+	WriteFlushPoints   int           `yaml:"write_flush_points"`
+	WriteFlushInterval time.Duration `yaml:"write_flush_interval"`
+
+	// WriteQueueSize bounds the points buffered between span ingestion and
+	// the batching flusher, so a slow InfluxDB cannot grow the collector's
+	// memory without limit; zero leaves the write path unbounded.
+	// WriteQueuePolicy decides what happens to points arriving at a full
+	// queue: "block" (the default) applies backpressure to the collector,
+	// "drop-new" refuses the incoming point, "drop-old" evicts the oldest
+	// queued point.
+	WriteQueueSize   int    `yaml:"write_queue_size"`
+	WriteQueuePolicy string `yaml:"write_queue_policy"`
+
+	// WALDir spills the write path to a write-ahead log in this directory,
+	// replayed on startup, so buffered spans survive plugin restarts and
+	// short InfluxDB outages; empty disables the log. WALSegmentBytes
+	// rotates log segments by size and WALMaxBytes caps the total kept on
+	// disk, bounding both disk use and the spans re-sent by a replay; zero
+	// keeps the defaults (64 MiB and 1 GiB).
+	WALDir          string `yaml:"wal_dir"`
+	WALSegmentBytes int64  `yaml:"wal_segment_bytes"`
+	WALMaxBytes     int64  `yaml:"wal_max_bytes"`
+
+	// WriteBackpressure slows batch writes in response to server
+	// backpressure signals (rejected or slow writes) instead of only
+	// reacting with retries.
+	WriteBackpressure bool `yaml:"write_backpressure"`
+
+	// WriteLagThreshold warns when spans arrive more than this long after
+	// they ended, signalling ingestion queue buildup; 0 disables the watchdog.
+	WriteLagThreshold time.Duration `yaml:"write_lag_threshold"`
+
+	// RetryStartup keeps retrying with backoff when InfluxDB is unreachable
+	// at boot, instead of failing fatally.
+	RetryStartup bool `yaml:"retry_startup"`
+
+	// StaleMetadataFallback serves the last known services, operations and
+	// dependencies when those queries fail, keeping the UI navigable during
+	// short outages.
+	StaleMetadataFallback bool `yaml:"stale_metadata_fallback"`
+
+	// MetadataSnapshotFile persists the metadata caches to disk, loaded at
+	// startup; requires StaleMetadataFallback. The interval defaults to
+	// common.DefaultMetadataSnapshotInterval.
+	MetadataSnapshotFile     string        `yaml:"metadata_snapshot_file"`
+	MetadataSnapshotInterval time.Duration `yaml:"metadata_snapshot_interval"`
+
+	// MetadataRefreshInterval proactively refreshes the services/operations
+	// caches (with jitter) when > 0; requires StaleMetadataFallback.
+	MetadataRefreshInterval time.Duration `yaml:"metadata_refresh_interval"`
+
+	// AdminAddr serves administrative endpoints (POST /flush?cache=services,
+	// GET /ready as a readiness probe) when set, e.g. "localhost:8686".
+	AdminAddr string `yaml:"admin_addr"`
+
+	// FlatSpanMeasurement opts into the flat (pivot-free) span schema under
+	// the given measurement name, for InfluxDB instances that struggle with
+	// the memory cost of Flux pivot() on trace queries. InfluxDB v2.x only;
+	// spans written under the default schema stay readable.
+	FlatSpanMeasurement string `yaml:"flat_span_measurement"`
+
+	// SinglePointSpans writes each span as exactly one point, embedding up to
+	// MaxEmbeddedLogBytes of its logs in the span field instead of separate
+	// log points; requires FlatSpanMeasurement. MaxEmbeddedLogBytes defaults
+	// to common.DefaultMaxEmbeddedLogBytes.
+	SinglePointSpans    bool `yaml:"single_point_spans"`
+	MaxEmbeddedLogBytes int  `yaml:"max_embedded_log_bytes"`
+
+	// LogCompressionThreshold compresses embedded log payloads of at least
+	// this many bytes, decompressed transparently on read; 0 keeps all log
+	// payloads plaintext.
+	LogCompressionThreshold int `yaml:"log_compression_threshold"`
+
+	// Legacy measurement names unioned into reads; aliases pair up by index,
+	// and a missing log alias falls back to the default log measurement.
+	SpanMeasurementAliases []string `yaml:"span_measurement_aliases"`
+	LogMeasurementAliases  []string `yaml:"log_measurement_aliases"`
 
 	// InfluxDB v1.x
 	Database        string `yaml:"database"`
@@ -41,12 +453,129 @@ type Configuration struct {
 	Token        string `yaml:"token"`
 	Organization string `yaml:"organization"`
 	Bucket       string `yaml:"bucket"`
+
+	// ArchiveBucket retries trace lookups that miss the primary bucket in
+	// this long-retention bucket before returning not-found, so archived
+	// traces opened from old links still resolve.
+	ArchiveBucket string `yaml:"archive_bucket"`
+
+	// ColdBuckets unions query results with these long-retention buckets
+	// (e.g. a downsampled cold tier) whenever the requested time range
+	// reaches past the primary bucket's retention. InfluxDB v2.x only.
+	ColdBuckets []string `yaml:"cold_buckets"`
+
+	// FederatedReadTargets fans FindTraceIDs and GetServices out to
+	// additional org:bucket:token read targets on the same host, merging
+	// results, for teams that write traces into separate orgs but share one
+	// Jaeger UI. InfluxDB v2.x only.
+	FederatedReadTargets []string `yaml:"federated_read_targets"`
+
+	// HedgeAddr names a read replica that receives a duplicate of each query
+	// once the primary has gone HedgeDelay (default 100ms) without
+	// responding; whichever endpoint answers first wins and the other
+	// request is cancelled, cutting tail latency when one node stalls.
+	// InfluxDB v2.x only.
+	HedgeAddr  string        `yaml:"hedge_addr"`
+	HedgeDelay time.Duration `yaml:"hedge_delay"`
+
+	// InfluxDB v3.x
+
+	// V3Database selects the InfluxDB 3.x backend and names the database to
+	// read and write; pair it with Host and Token. Flux is deprecated on the
+	// 3.x engine, so this backend queries with SQL and stores spans in the
+	// flat single-point schema.
+	V3Database string `yaml:"v3_database"`
 }
 
 // InitFromViper initializes the options struct with values from Viper
 func (c *Configuration) InitFromViper(v *viper.Viper) {
 	c.Host = v.GetString(flagHost)
 	c.DefaultLookback = v.GetDuration(flagDefaultLookback)
+	if c.DefaultLookback < 0 {
+		// Older configurations expressed the lookback as a negative offset.
+		c.DefaultLookback = -c.DefaultLookback
+	}
+	c.MaxLookback = v.GetDuration(flagMaxLookback)
+	c.MaxTraceIDsPerQuery = v.GetInt(flagMaxTraceIDsPerQuery)
+	c.MaxQueryWindow = v.GetDuration(flagMaxQueryWindow)
+	c.TraceMemoryBudget = v.GetInt64(flagTraceMemoryBudget)
+	c.MaxResponseBytes = v.GetInt64(flagMaxResponseBytes)
+	c.MaxRowsPerQuery = v.GetInt(flagMaxRowsPerQuery)
+	c.MaxServices = v.GetInt(flagMaxServices)
+	c.MetaQueryLookback = v.GetDuration(flagMetaQueryLookback)
+	c.QueryRetries = v.GetInt(flagQueryRetries)
+	c.FastCSVDecoder = v.GetBool(flagFastCSVDecoder)
+	c.SlowQueryThreshold = v.GetDuration(flagSlowQueryThreshold)
+	c.FluxProfiling = v.GetBool(flagFluxProfiling)
+	c.MaxConcurrentQueries = v.GetInt(flagMaxConcurrentQueries)
+	c.DialTimeout = v.GetDuration(flagDialTimeout)
+	c.ConnRecycleInterval = v.GetDuration(flagConnRecycleInterval)
+	c.SRVRecord = v.GetString(flagSRVRecord)
+	c.DiscoveryInterval = v.GetDuration(flagDiscoveryInterval)
+	c.TraceQualityInterval = v.GetDuration(flagTraceQualityInterval)
+	c.CanaryInterval = v.GetDuration(flagCanaryInterval)
+	c.SpanMetricsInterval = v.GetDuration(flagSpanMetricsInterval)
+	c.SpanMetricsSource = v.GetString(flagSpanMetricsSource)
+	c.WriteRateLimit = v.GetFloat64(flagWriteRateLimit)
+	c.WriteRateBurst = v.GetFloat64(flagWriteRateBurst)
+	c.WriteQuotaPointsPerDay = v.GetInt64(flagWriteQuotaPointsPerDay)
+	c.WriteQuotaBytesPerDay = v.GetInt64(flagWriteQuotaBytesPerDay)
+	c.WriteQuotaSampleRate = v.GetFloat64(flagWriteQuotaSampleRate)
+	c.AuditLog = v.GetBool(flagAuditLog)
+	c.AccessPolicyFile = v.GetString(flagAccessPolicyFile)
+	c.EncryptionKey = v.GetString(flagEncryptionKey)
+	c.EncryptTags = v.GetStringSlice(flagEncryptTags)
+	c.FluxTemplateDir = v.GetString(flagFluxTemplateDir)
+	c.SearchFilterFlux = v.GetString(flagSearchFilterFlux)
+	c.Adjusters = v.GetStringSlice(flagAdjusters)
+	c.ClockSkewMaxAdjust = v.GetDuration(flagClockSkewMaxAdjust)
+	c.CollisionStrategy = v.GetString(flagCollisionStrategy)
+	c.CollisionDetectionCacheSize = v.GetInt(flagCollisionDetectionSize)
+	c.SpanChecksums = v.GetBool(flagSpanChecksums)
+	c.DedupeCacheSize = v.GetInt(flagDedupeCacheSize)
+	c.WriteFlushPoints = v.GetInt(flagWriteFlushPoints)
+	c.WriteFlushInterval = v.GetDuration(flagWriteFlushInterval)
+	c.WriteQueueSize = v.GetInt(flagWriteQueueSize)
+	c.WriteQueuePolicy = v.GetString(flagWriteQueuePolicy)
+	c.WALDir = v.GetString(flagWALDir)
+	c.WALSegmentBytes = v.GetInt64(flagWALSegmentBytes)
+	c.WALMaxBytes = v.GetInt64(flagWALMaxBytes)
+	c.WriteLagThreshold = v.GetDuration(flagWriteLagThreshold)
+	c.WriteBackpressure = v.GetBool(flagWriteBackpressure)
+	c.ReadConsistencyDelay = v.GetDuration(flagReadConsistencyDelay)
+	c.GetTraceRetryDelay = v.GetDuration(flagGetTraceRetryDelay)
+	c.SearchCacheTTL = v.GetDuration(flagSearchCacheTTL)
+	c.TraceCacheTTL = v.GetDuration(flagTraceCacheTTL)
+	c.TraceCacheMaxBytes = v.GetInt64(flagTraceCacheMaxBytes)
+	c.TraceCacheNegativeTTL = v.GetDuration(flagTraceCacheNegativeTTL)
+	c.MetadataCacheTTL = v.GetDuration(flagMetadataCacheTTL)
+	c.MetadataCacheSize = v.GetInt(flagMetadataCacheSize)
+	c.MetadataWarmInterval = v.GetDuration(flagMetadataWarmInterval)
+	c.GetTraceTimeout = v.GetDuration(flagGetTraceTimeout)
+	c.FindTraceIDsTimeout = v.GetDuration(flagFindTraceIDsTimeout)
+	c.FindTracesTimeout = v.GetDuration(flagFindTracesTimeout)
+	c.GetServicesTimeout = v.GetDuration(flagGetServicesTimeout)
+	c.GetDependenciesTimeout = v.GetDuration(flagGetDependenciesTimeout)
+	c.CircuitBreakerThreshold = v.GetInt(flagCircuitBreakerThreshold)
+	c.CircuitBreakerCoolDown = v.GetDuration(flagCircuitBreakerCoolDown)
+	c.RegexTags = v.GetBool(flagRegexTags)
+	c.LogQueries = v.GetBool(flagLogQueries)
+	c.TagQueriesWithRequestID = v.GetBool(flagTagQueriesWithRequestID)
+	c.SkipSearchLogs = v.GetBool(flagSkipSearchLogs)
+	c.DependencyQueryChunk = v.GetDuration(flagDependencyQueryChunk)
+	c.TraceFetchConcurrency = v.GetInt(flagTraceFetchConcurrency)
+	c.RetryStartup = v.GetBool(flagRetryStartup)
+	c.StaleMetadataFallback = v.GetBool(flagStaleMetadataFallback)
+	c.MetadataSnapshotFile = v.GetString(flagMetadataSnapshotFile)
+	c.MetadataSnapshotInterval = v.GetDuration(flagMetadataSnapshotInterval)
+	c.MetadataRefreshInterval = v.GetDuration(flagMetadataRefreshInterval)
+	c.AdminAddr = v.GetString(flagAdminAddr)
+	c.FlatSpanMeasurement = v.GetString(flagFlatSpanMeasurement)
+	c.SinglePointSpans = v.GetBool(flagSinglePointSpans)
+	c.MaxEmbeddedLogBytes = v.GetInt(flagMaxEmbeddedLogBytes)
+	c.LogCompressionThreshold = v.GetInt(flagLogCompressionThreshold)
+	c.SpanMeasurementAliases = v.GetStringSlice(flagSpanMeasurementAliases)
+	c.LogMeasurementAliases = v.GetStringSlice(flagLogMeasurementAliases)
 
 	c.Database = v.GetString(flagDatabase)
 	c.RetentionPolicy = v.GetString(flagRetentionPolicy)
@@ -57,4 +586,11 @@ func (c *Configuration) InitFromViper(v *viper.Viper) {
 	c.Token = v.GetString(flagToken)
 	c.Organization = v.GetString(flagOrganization)
 	c.Bucket = v.GetString(flagBucket)
+	c.ArchiveBucket = v.GetString(flagArchiveBucket)
+	c.ColdBuckets = v.GetStringSlice(flagColdBuckets)
+	c.FederatedReadTargets = v.GetStringSlice(flagFederatedReadTargets)
+	c.HedgeAddr = v.GetString(flagHedgeAddr)
+	c.HedgeDelay = v.GetDuration(flagHedgeDelay)
+
+	c.V3Database = v.GetString(flagV3Database)
 }
@@ -0,0 +1,127 @@
+package dbmodel
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/pkg/errors"
+)
+
+// Adjuster post-processes one trace after it is read from storage.
+type Adjuster func(trace *model.Trace)
+
+// Adjuster names accepted by NewAdjusterPipeline. Different installations
+// have conflicting preferences about storage-layer "fixing" of data, so
+// none run unless configured.
+const (
+	AdjusterSortSpans     = "sort-spans"
+	AdjusterDedupeSpans   = "dedupe-spans"
+	AdjusterClockSkew     = "clock-skew"
+	AdjusterUniqueSpanIDs = "unique-span-ids"
+)
+
+// NewAdjusterPipeline resolves configured adjuster names, in order, into a
+// pipeline. clockSkewMaxAdjust caps the clock-skew correction per span;
+// zero means uncapped.
+func NewAdjusterPipeline(names []string, clockSkewMaxAdjust time.Duration) ([]Adjuster, error) {
+	adjusters := make([]Adjuster, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case AdjusterSortSpans:
+			adjusters = append(adjusters, SortSpans)
+		case AdjusterDedupeSpans:
+			adjusters = append(adjusters, DedupeSpans)
+		case AdjusterClockSkew:
+			adjusters = append(adjusters, ClockSkewAdjuster(clockSkewMaxAdjust))
+		case AdjusterUniqueSpanIDs:
+			adjusters = append(adjusters, UniquifySpanIDs)
+		default:
+			return nil, errors.Errorf("unrecognized adjuster '%s'", name)
+		}
+	}
+	return adjusters, nil
+}
+
+// SortSpans orders the trace's spans by start time.
+func SortSpans(trace *model.Trace) {
+	sort.Slice(trace.Spans, func(i, j int) bool {
+		return trace.Spans[i].StartTime.Before(trace.Spans[j].StartTime)
+	})
+}
+
+// DedupeSpans drops spans that are exact duplicates (same span ID and same
+// content checksum) of an earlier span in the trace.
+func DedupeSpans(trace *model.Trace) {
+	seen := make(map[model.SpanID]string, len(trace.Spans))
+	spans := trace.Spans[:0]
+	for _, span := range trace.Spans {
+		checksum := SpanChecksum(span)
+		if previous, found := seen[span.SpanID]; found && previous == checksum {
+			continue
+		}
+		seen[span.SpanID] = checksum
+		spans = append(spans, span)
+	}
+	trace.Spans = spans
+}
+
+// ClockSkewAdjuster shifts spans that start before their parent forward to
+// the parent's start, assuming the discrepancy is clock skew between hosts.
+// maxAdjust caps the correction per span; zero means uncapped.
+func ClockSkewAdjuster(maxAdjust time.Duration) Adjuster {
+	return func(trace *model.Trace) {
+		startBySpanID := make(map[model.SpanID]time.Time, len(trace.Spans))
+		for _, span := range trace.Spans {
+			startBySpanID[span.SpanID] = span.StartTime
+		}
+		for _, span := range trace.Spans {
+			parentID := span.ParentSpanID()
+			if parentID == 0 {
+				continue
+			}
+			parentStart, found := startBySpanID[parentID]
+			if !found || !span.StartTime.Before(parentStart) {
+				continue
+			}
+			skew := parentStart.Sub(span.StartTime)
+			if maxAdjust > 0 && skew > maxAdjust {
+				skew = maxAdjust
+			}
+			span.StartTime = span.StartTime.Add(skew)
+		}
+	}
+}
+
+// UniquifySpanIDs gives spans that share an ID with a different earlier span
+// (e.g. Zipkin-style shared client/server IDs) a fresh span ID, re-parented
+// under the original so the trace tree stays connected.
+func UniquifySpanIDs(trace *model.Trace) {
+	used := make(map[model.SpanID]struct{}, len(trace.Spans))
+	checksums := make(map[model.SpanID]string, len(trace.Spans))
+	var next model.SpanID = 1
+	for _, span := range trace.Spans {
+		used[span.SpanID] = struct{}{}
+	}
+	for _, span := range trace.Spans {
+		checksum := SpanChecksum(span)
+		previous, found := checksums[span.SpanID]
+		if !found {
+			checksums[span.SpanID] = checksum
+			continue
+		}
+		if previous == checksum {
+			continue
+		}
+		for {
+			if _, taken := used[next]; !taken {
+				break
+			}
+			next++
+		}
+		oldID := span.SpanID
+		span.SpanID = next
+		used[next] = struct{}{}
+		span.References = []model.SpanRef{model.NewChildOfRef(span.TraceID, oldID)}
+	}
+}
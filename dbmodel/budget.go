@@ -0,0 +1,55 @@
+package dbmodel
+
+import (
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/pkg/errors"
+)
+
+// errBudgetExhausted aborts a flux table iteration once the decode budget
+// is spent; callers treat it as "stop decoding", not as a failure.
+var errBudgetExhausted = errors.New("trace decode memory budget exhausted")
+
+// DecodeBudget bounds the memory used to reconstruct traces from one query
+// result. Spans and logs are charged at their marshaled size; once MaxBytes
+// is spent, decoding stops and the traces decoded so far are returned, so a
+// pathological multi-hundred-thousand-span trace degrades to a partial
+// response instead of taking the query pod down.
+type DecodeBudget struct {
+	// MaxBytes is the budget; zero or negative means unlimited.
+	MaxBytes int64
+
+	used      int64
+	exhausted bool
+}
+
+// Exhausted reports whether decoding was cut short by the budget.
+func (b *DecodeBudget) Exhausted() bool {
+	return b != nil && b.exhausted
+}
+
+// chargeSpan consumes the span's size from the budget, reporting whether
+// the span still fits.
+func (b *DecodeBudget) chargeSpan(span *model.Span) bool {
+	return b.charge(int64(span.Size()))
+}
+
+// chargeLog consumes the log's size from the budget, reporting whether the
+// log still fits.
+func (b *DecodeBudget) chargeLog(log *model.Log) bool {
+	return b.charge(int64(log.Size()))
+}
+
+func (b *DecodeBudget) charge(n int64) bool {
+	if b == nil || b.MaxBytes <= 0 {
+		return true
+	}
+	if b.exhausted {
+		return false
+	}
+	b.used += n
+	if b.used > b.MaxBytes {
+		b.exhausted = true
+		return false
+	}
+	return true
+}
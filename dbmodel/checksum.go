@@ -0,0 +1,76 @@
+package dbmodel
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/influxdata/jaeger-influxdb/common"
+	"github.com/jaegertracing/jaeger/model"
+)
+
+// SpanChecksum computes a checksum over the canonical encoding of a span.
+// The checksum is optionally stored as a field at write time and verified at
+// read time, detecting lossy schema translation bugs and partial writes.
+// The canonical encoding only covers values that survive the round trip
+// exactly: timestamps are truncated to µs (the ns digits carry the span ID),
+// tags are sorted, and the "error" tag is skipped because it may be derived
+// at write time.
+func SpanChecksum(span *model.Span) string {
+	h := fnv.New64a()
+
+	fmt.Fprintf(h, "%s|%s|%s|%s|%d|%d|%d",
+		span.TraceID.String(), span.SpanID.String(),
+		span.Process.ServiceName, span.OperationName,
+		span.StartTime.Truncate(time.Microsecond).UnixNano(),
+		span.Duration.Nanoseconds(), span.Flags)
+
+	references := make([]string, 0, len(span.References))
+	for _, reference := range span.References {
+		// Mirror the write path: zero and unrecognized references are skipped.
+		if reference.SpanID == 0 {
+			continue
+		}
+		switch reference.RefType {
+		case model.SpanRefType_CHILD_OF, model.SpanRefType_FOLLOWS_FROM:
+			references = append(references, fmt.Sprintf("%s:%s", reference.SpanID.String(), reference.RefType.String()))
+		}
+	}
+	sort.Strings(references)
+	for _, reference := range references {
+		fmt.Fprintf(h, "|%s", reference)
+	}
+
+	writeCanonicalTags(h, span.Tags)
+	writeCanonicalTags(h, span.Process.Tags)
+
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// VerifySpanChecksum recomputes the span's checksum and attaches a warning to
+// the span when it does not match the stored value.
+func VerifySpanChecksum(span *model.Span, checksum string) {
+	if checksum == "" {
+		return
+	}
+	if computed := SpanChecksum(span); computed != checksum {
+		span.Warnings = append(span.Warnings,
+			fmt.Sprintf("span checksum mismatch: stored %s, computed %s", checksum, computed))
+	}
+}
+
+func writeCanonicalTags(w io.Writer, tags []model.KeyValue) {
+	canonical := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag.Key == common.ErrorKey {
+			continue
+		}
+		canonical = append(canonical, tag.Key+"="+tag.AsString())
+	}
+	sort.Strings(canonical)
+	for _, tag := range canonical {
+		fmt.Fprintf(w, "|%s", tag)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -11,6 +12,21 @@ import (
 	"github.com/jaegertracing/jaeger/model"
 )
 
+// TraceIDStrings returns every stored string encoding that can denote
+// traceID. IDs with a zero high half have two: this plugin writes the
+// 16-character short form, but 128-bit tracers and other writers zero-pad
+// to 32 characters, so query builders must match both. Decoding is not
+// ambiguous; model.TraceIDFromString normalizes either form.
+func TraceIDStrings(traceID model.TraceID) []string {
+	if traceID.High == 0 {
+		return []string{
+			traceID.String(),
+			fmt.Sprintf("%032x", traceID.Low),
+		}
+	}
+	return []string{traceID.String()}
+}
+
 func referencesFromString(s string) ([]model.SpanRef, error) {
 	var spanReferences []model.SpanRef
 
@@ -18,10 +34,21 @@ func referencesFromString(s string) ([]model.SpanRef, error) {
 		if reference == "" {
 			continue
 		}
-		parts := strings.SplitN(reference, ":", 2)
-		if len(parts) < 2 {
+		// Two parts for same-trace references, three (with a leading trace
+		// ID) for references that cross trace boundaries.
+		parts := strings.Split(reference, ":")
+		if len(parts) < 2 || len(parts) > 3 {
 			return nil, errors.New("invalid span reference")
 		}
+		var traceID model.TraceID
+		if len(parts) == 3 {
+			var err error
+			traceID, err = model.TraceIDFromString(parts[0])
+			if err != nil {
+				return nil, err
+			}
+			parts = parts[1:]
+		}
 		spanID, err := model.SpanIDFromString(parts[0])
 		if err != nil {
 			return nil, err
@@ -36,6 +63,7 @@ func referencesFromString(s string) ([]model.SpanRef, error) {
 			return nil, errors.New("unrecognized span reference type")
 		}
 		spanRef := model.SpanRef{
+			TraceID: traceID,
 			SpanID:  spanID,
 			RefType: refType,
 		}
@@ -45,6 +73,140 @@ func referencesFromString(s string) ([]model.SpanRef, error) {
 	return spanReferences, nil
 }
 
+// fluxStringEscaper escapes the characters with special meaning inside a
+// double-quoted Flux string literal: backslash, double quote, the ${}
+// interpolation opener, and control characters. Dollar signs use the hex
+// escape because the scanner mishandles \$ and bare $ ahead of other escapes.
+var fluxStringEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"$", `\x24`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// EscapeFluxString escapes value for interpolation into a double-quoted Flux
+// string literal, so a service named `foo" or true` cannot break out of the
+// literal and inject Flux.
+func EscapeFluxString(value string) string {
+	return fluxStringEscaper.Replace(value)
+}
+
+// queryTagEncodings returns the stored encodings a query tag value can match.
+// Span tag values are written with a type prefix (see keyValueAsStrings), so
+// a query for "true" must match "b:t" and a query for "42" must match "i:42".
+// The unprefixed value is kept for data written before the prefix scheme.
+func queryTagEncodings(value string) []string {
+	encodings := []string{value, "s:" + value}
+	switch value {
+	case "true":
+		encodings = append(encodings, "b:t")
+	case "false":
+		encodings = append(encodings, "b:f")
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		encodings = append(encodings, "i:"+value)
+	} else if f, err := strconv.ParseFloat(value, 64); err == nil {
+		encodings = append(encodings, "f:"+strconv.FormatFloat(f, 'E', -1, 64))
+	}
+	return encodings
+}
+
+// regexTagPattern extracts the regular expression from a ~/pattern/ query
+// tag value, escaped for embedding in a Flux or InfluxQL regex literal.
+// Values that are not of that form, or whose pattern does not compile, are
+// reported as non-regex and matched exactly.
+func regexTagPattern(value string) (string, bool) {
+	if len(value) < 4 || !strings.HasPrefix(value, "~/") || !strings.HasSuffix(value, "/") {
+		return "", false
+	}
+	pattern := value[2 : len(value)-1]
+	if _, err := regexp.Compile(pattern); err != nil {
+		return "", false
+	}
+	// Escape delimiter slashes the pattern does not already escape; a slash
+	// preceded by an odd run of backslashes is escaped already, and adding
+	// another backslash would turn it into a literal backslash that ends the
+	// regex literal early.
+	var sb strings.Builder
+	backslashes := 0
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c == '/' && backslashes%2 == 0 {
+			sb.WriteByte('\\')
+		}
+		if c == '\\' {
+			backslashes++
+		} else {
+			backslashes = 0
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String(), true
+}
+
+// SpanKind returns the span's OpenTracing kind tag value ("server",
+// "client", ...), or the empty string when untagged.
+func SpanKind(span *model.Span) string {
+	for _, tag := range span.Tags {
+		if tag.Key == common.SpanKindKey && tag.VType == model.ValueType_STRING {
+			return tag.VStr
+		}
+	}
+	return ""
+}
+
+// IsErrorSpan reports whether a span failed, either via the legacy "error"
+// tag or via OTel/HTTP status codes.
+func IsErrorSpan(span *model.Span) bool {
+	for _, tag := range span.Tags {
+		if tag.Key == common.ErrorKey {
+			if (tag.VType == model.ValueType_BOOL && tag.VBool) ||
+				(tag.VType == model.ValueType_STRING && tag.VStr == "true") {
+				return true
+			}
+		}
+	}
+
+	_, derived := errorFromTags(span.Tags)
+	return derived
+}
+
+// errorFromTags inspects span tags for failure signals. explicit reports
+// whether the legacy "error" tag is present; derived reports whether OTel
+// status codes or an HTTP 5xx status imply failure.
+func errorFromTags(tags []model.KeyValue) (explicit, derived bool) {
+	for _, tag := range tags {
+		switch tag.Key {
+		case common.ErrorKey:
+			explicit = true
+
+		case common.OtelStatusCodeKey:
+			// OTel status is either the string "ERROR" or the enum value 2,
+			// depending on the SDK and exporter.
+			if (tag.VType == model.ValueType_STRING && tag.VStr == "ERROR") ||
+				(tag.VType == model.ValueType_INT64 && tag.VInt64 == 2) {
+				derived = true
+			}
+
+		case common.HTTPStatusCodeKey:
+			var code int64
+			switch tag.VType {
+			case model.ValueType_INT64:
+				code = tag.VInt64
+			case model.ValueType_STRING:
+				code, _ = strconv.ParseInt(tag.VStr, 10, 64)
+			}
+			if code >= 500 {
+				derived = true
+			}
+		}
+	}
+
+	return explicit, derived
+}
+
 // keyValueAsStrings converts a model.KeyValue to two strings,
 // for use as InfluxDB tag key and value.
 func keyValueAsStrings(kv *model.KeyValue) (string, string, error) {
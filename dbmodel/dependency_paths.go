@@ -0,0 +1,74 @@
+package dbmodel
+
+import (
+	"github.com/jaegertracing/jaeger/model"
+)
+
+// defaultMaxDependencyDepth bounds path walks when the caller passes no limit.
+const defaultMaxDependencyDepth = 4
+
+// DependencyPath is a chain of service names, starting at the focal service,
+// following dependency edges in one direction.
+type DependencyPath []string
+
+// DownstreamDependencyPaths returns the transitive callee paths of service,
+// i.e. what can break if a service on one of the paths goes down.
+func DownstreamDependencyPaths(links []model.DependencyLink, service string, maxDepth int) []DependencyPath {
+	adjacency := make(map[string][]string)
+	for _, link := range links {
+		adjacency[link.Parent] = append(adjacency[link.Parent], link.Child)
+	}
+
+	return walkDependencyPaths(adjacency, service, maxDepth)
+}
+
+// UpstreamDependencyPaths returns the transitive caller paths of service,
+// i.e. who is affected if the focal service goes down.
+func UpstreamDependencyPaths(links []model.DependencyLink, service string, maxDepth int) []DependencyPath {
+	adjacency := make(map[string][]string)
+	for _, link := range links {
+		adjacency[link.Child] = append(adjacency[link.Child], link.Parent)
+	}
+
+	return walkDependencyPaths(adjacency, service, maxDepth)
+}
+
+func walkDependencyPaths(adjacency map[string][]string, service string, maxDepth int) []DependencyPath {
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxDependencyDepth
+	}
+
+	var paths []DependencyPath
+	var walk func(path DependencyPath)
+	walk = func(path DependencyPath) {
+		current := path[len(path)-1]
+
+		extended := false
+		if len(path)-1 < maxDepth {
+			for _, next := range adjacency[current] {
+				if path.contains(next) { // Break dependency cycles
+					continue
+				}
+				extended = true
+				next := append(append(make(DependencyPath, 0, len(path)+1), path...), next)
+				walk(next)
+			}
+		}
+
+		if !extended && len(path) > 1 {
+			paths = append(paths, path)
+		}
+	}
+	walk(DependencyPath{service})
+
+	return paths
+}
+
+func (p DependencyPath) contains(service string) bool {
+	for _, s := range p {
+		if s == service {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package dbmodel
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/influxdata/flux"
+	"github.com/influxdata/jaeger-influxdb/common"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/pkg/errors"
+)
+
+// DependencyLinkStats extends a dependency link with per-edge latency
+// percentiles and an error ratio, for richer service-map overlays.
+type DependencyLinkStats struct {
+	model.DependencyLink
+	P50Latency time.Duration
+	P95Latency time.Duration
+	ErrorRatio float64
+}
+
+// dependencySpan is one span row of a dependency statistics query.
+type dependencySpan struct {
+	serviceName string
+	parent      model.SpanID
+	duration    time.Duration
+	isError     bool
+}
+
+// DependencyLinkStatsFromResultV2 aggregates span rows carrying service name,
+// references, duration and the error tag into per-edge call counts, latency
+// percentiles and error ratios.
+func DependencyLinkStatsFromResultV2(resultIterator flux.ResultIterator) ([]DependencyLinkStats, error) {
+	spans := make(map[model.SpanID]*dependencySpan)
+	for resultIterator.More() {
+		err := resultIterator.Next().Tables().Do(func(table flux.Table) error {
+			return table.Do(func(reader flux.ColReader) error {
+				spanIDColI, serviceNameColI, referencesColI, durationColI, errorColI := -1, -1, -1, -1, -1
+				for i := range reader.Cols() {
+					switch reader.Cols()[i].Label {
+					case common.SpanIDKey:
+						spanIDColI = i
+					case common.ServiceNameKey:
+						serviceNameColI = i
+					case common.ReferencesKey:
+						referencesColI = i
+					case common.DurationKey:
+						durationColI = i
+					case common.ErrorKey:
+						errorColI = i
+					}
+				}
+
+				for rowI := 0; rowI < reader.Len(); rowI++ {
+					spanID, err := model.SpanIDFromString(reader.Strings(spanIDColI).ValueString(rowI))
+					if err != nil {
+						return errors.WithMessagef(err, "failed to parse SpanID '%s'", reader.Strings(spanIDColI).ValueString(rowI))
+					}
+					span := &dependencySpan{
+						serviceName: reader.Strings(serviceNameColI).ValueString(rowI),
+					}
+					if durationColI > -1 && !isNull(reader, durationColI, rowI) {
+						span.duration = time.Duration(reader.Ints(durationColI).Value(rowI))
+					}
+					if errorColI > -1 && !isNull(reader, errorColI, rowI) {
+						// Tag values carry a type prefix, e.g. "b:t" or "s:true".
+						switch reader.Strings(errorColI).ValueString(rowI) {
+						case "b:t", "s:true":
+							span.isError = true
+						}
+					}
+					if referencesColI > -1 && !isNull(reader, referencesColI, rowI) {
+						references, err := referencesFromString(reader.Strings(referencesColI).ValueString(rowI))
+						if err != nil {
+							return errors.WithMessagef(err, "failed to parse references '%s'", reader.Strings(referencesColI).ValueString(rowI))
+						}
+						for _, reference := range references {
+							if reference.RefType == model.SpanRefType_CHILD_OF {
+								span.parent = reference.SpanID
+							}
+						}
+					}
+					spans[spanID] = span
+				}
+
+				return nil
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return dependencyLinkStatsFromSpans(spans), nil
+}
+
+// dependencyLinkStatsFromSpans folds parent/child span relationships into
+// per-service-edge statistics; the child span's duration stands in for the
+// edge latency.
+func dependencyLinkStatsFromSpans(spans map[model.SpanID]*dependencySpan) []DependencyLinkStats {
+	type edge struct {
+		parent, child string
+	}
+	durationsByEdge := make(map[edge][]time.Duration)
+	errorsByEdge := make(map[edge]uint64)
+	for _, span := range spans {
+		if span.parent == 0 {
+			continue
+		}
+		parent, ok := spans[span.parent]
+		if !ok || parent.serviceName == span.serviceName {
+			continue
+		}
+		e := edge{parent: parent.serviceName, child: span.serviceName}
+		durationsByEdge[e] = append(durationsByEdge[e], span.duration)
+		if span.isError {
+			errorsByEdge[e]++
+		}
+	}
+
+	stats := make([]DependencyLinkStats, 0, len(durationsByEdge))
+	for e, durations := range durationsByEdge {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		stats = append(stats, DependencyLinkStats{
+			DependencyLink: model.DependencyLink{
+				Parent:    e.parent,
+				Child:     e.child,
+				CallCount: uint64(len(durations)),
+			},
+			P50Latency: durationQuantile(durations, 0.50),
+			P95Latency: durationQuantile(durations, 0.95),
+			ErrorRatio: float64(errorsByEdge[e]) / float64(len(durations)),
+		})
+	}
+
+	return stats
+}
+
+// durationQuantile returns the nearest-rank q-th quantile of a sorted slice.
+func durationQuantile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
@@ -203,7 +203,7 @@ var (
 			common.DurationKey:       spanB.Duration.Nanoseconds(),
 			common.FlagsKey:          uint32(spanB.Flags),
 			common.ProcessTagKeysKey: "other-process-tag-a",
-			common.ReferencesKey:     "7acf501b718115:ChildOf",
+			common.ReferencesKey:     spanA.SpanID.String() + ":" + common.ReferenceTypeChildOf,
 		},
 		time.Unix(0, 1550013480000200883)) // 883 is the timestamp hash suffix, not recognized by Jaeger
 	pointsB = models.Points{pointB0}
@@ -279,7 +279,7 @@ var (
 				spanB.Duration.Nanoseconds(),
 				int64(spanB.Flags),
 				"other-process-tag-a",
-				"7acf501b718115:ChildOf",
+				spanA.SpanID.String() + ":" + common.ReferenceTypeChildOf,
 			},
 		},
 	}
@@ -335,14 +335,14 @@ var (
 )
 
 func TestSpanToPointV2(t *testing.T) {
-	gotPointsA, err := dbmodel.SpanToPointsV2(&spanA, spanMeasurement, logMeasurement, hclog.NewNullLogger())
+	gotPointsA, err := dbmodel.SpanToPointsV2(&spanA, spanMeasurement, logMeasurement, false, hclog.NewNullLogger())
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	requirePointssEqual(t, pointsA, gotPointsA, "points are not equal")
 
-	gotPointsB, err := dbmodel.SpanToPointsV2(&spanB, spanMeasurement, logMeasurement, hclog.NewNullLogger())
+	gotPointsB, err := dbmodel.SpanToPointsV2(&spanB, spanMeasurement, logMeasurement, false, hclog.NewNullLogger())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -438,7 +438,8 @@ func TestSpanFromFlux(t *testing.T) {
 	fluxResult := &executetest.Result{
 		Tbls: []*executetest.Table{&spanTable, &logTable},
 	}
-	traces, err := dbmodel.TracesFromFluxResult(fluxResult, spanMeasurement, logMeasurement, hclog.NewNullLogger())
+	resultIterator := flux.NewSliceResultIterator([]flux.Result{fluxResult})
+	traces, err := dbmodel.TracesFromFluxResult(resultIterator, spanMeasurement, logMeasurement, hclog.NewNullLogger())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -471,7 +472,7 @@ func TestSpanToPointV2_invalidReference(t *testing.T) {
 			RefType: model.SpanRefType_CHILD_OF,
 		},
 	}
-	points, err := dbmodel.SpanToPointsV2(&span, spanMeasurement, logMeasurement, hclog.NewNullLogger())
+	points, err := dbmodel.SpanToPointsV2(&span, spanMeasurement, logMeasurement, false, hclog.NewNullLogger())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -488,3 +489,209 @@ func TestSpanToPointV2_invalidReference(t *testing.T) {
 		t.Errorf("expected root span to contain zero references, but got '%s'", references)
 	}
 }
+
+func TestSpanToFlatPointsV2(t *testing.T) {
+	gotPoints, err := dbmodel.SpanToFlatPointsV2(&spanB, "span-flat", logMeasurement, false, hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultPoints, err := dbmodel.SpanToPointsV2(&spanB, spanMeasurement, logMeasurement, false, hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gotPoints) != len(defaultPoints) {
+		t.Fatalf("expected %d points, got %d", len(defaultPoints), len(gotPoints))
+	}
+
+	// Tags and log points are unchanged from the default schema.
+	requireStringsEqual(t, defaultPoints[0].Tags().String(), gotPoints[0].Tags().String(), "flat span point tags differ from default schema")
+	requirePointssEqual(t, defaultPoints[1:], gotPoints[1:], "flat schema log points differ from default schema")
+
+	fields, err := gotPoints[0].Fields()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 2 {
+		t.Fatalf("expected 2 fields, got %d", len(fields))
+	}
+	if duration, found := fields[common.DurationKey]; !found || duration != spanB.Duration.Nanoseconds() {
+		t.Errorf("expected duration field %d, got '%v'", spanB.Duration.Nanoseconds(), duration)
+	}
+	packed, found := fields[common.FlatSpanKey].(string)
+	if !found {
+		t.Fatalf("packed span field not found")
+	}
+	wantPacked := strings.Join([]string{
+		spanB.SpanID.String(),
+		strconv.FormatInt(spanB.Duration.Nanoseconds(), 10),
+		strconv.FormatUint(uint64(spanB.Flags), 10),
+		"other-process-tag-a",
+		spanA.SpanID.String() + ":" + common.ReferenceTypeChildOf,
+		"",
+	}, "\t")
+	requireStringsEqual(t, wantPacked, packed, "packed span field not as expected")
+}
+
+// The flat schema exists to avoid the pivot memory cost at query time; these
+// benchmarks compare the write-side encoding cost of the two schemas.
+
+func BenchmarkSpanToPointsV2(b *testing.B) {
+	logger := hclog.NewNullLogger()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := dbmodel.SpanToPointsV2(&spanB, spanMeasurement, logMeasurement, false, logger); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSpanToFlatPointsV2(b *testing.B) {
+	logger := hclog.NewNullLogger()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := dbmodel.SpanToFlatPointsV2(&spanB, "span-flat", logMeasurement, false, logger); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSpanToSinglePointV2(t *testing.T) {
+	point, err := dbmodel.SpanToSinglePointV2(&spanA, "span-flat", 0, 0, false, hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields, err := point.Fields()
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed, found := fields[common.FlatSpanKey].(string)
+	if !found {
+		t.Fatalf("packed span field not found")
+	}
+	parts := strings.Split(packed, "\t")
+	if len(parts) != 7 {
+		t.Fatalf("expected 7 parts in packed span field, got %d", len(parts))
+	}
+
+	var gotLogs []model.Log
+	if err := gojson.Unmarshal([]byte(parts[6]), &gotLogs); err != nil {
+		t.Fatal(err)
+	}
+	expectedJSON, err := gojson.Marshal(spanA.Logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotJSON, err := gojson.Marshal(gotLogs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireStringsEqual(t, string(expectedJSON), string(gotJSON), "embedded logs did not round-trip")
+}
+
+func TestSpanToSinglePointV2_truncatesLogs(t *testing.T) {
+	full, err := gojson.Marshal(spanA.Logs[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A budget big enough for the first log only.
+	point, err := dbmodel.SpanToSinglePointV2(&spanA, "span-flat", len(full), 0, false, hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields, err := point.Fields()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(fields[common.FlatSpanKey].(string), "\t")
+
+	var gotLogs []model.Log
+	if err := gojson.Unmarshal([]byte(parts[6]), &gotLogs); err != nil {
+		t.Fatal(err)
+	}
+	if len(gotLogs) != 1 {
+		t.Errorf("expected 1 embedded log after truncation, got %d", len(gotLogs))
+	}
+}
+
+func TestLogPayloadRoundTrip(t *testing.T) {
+	small := []byte(`[{"msg":"hi"}]`)
+	if got := dbmodel.EncodeLogPayload(small, 1024); got != string(small) {
+		t.Errorf("expected payload below threshold to stay plaintext, got '%s'", got)
+	}
+
+	big := []byte(`[` + strings.Repeat(`{"msg":"hello hello hello"},`, 100) + `{"msg":"bye"}]`)
+	encoded := dbmodel.EncodeLogPayload(big, 64)
+	if !strings.HasPrefix(encoded, "gz:") {
+		t.Fatalf("expected payload above threshold to be compressed, got '%s'", encoded)
+	}
+	if len(encoded) >= len(big) {
+		t.Errorf("expected compressed payload to be smaller: %d vs %d bytes", len(encoded), len(big))
+	}
+
+	decoded, err := dbmodel.DecodeLogPayload(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireStringsEqual(t, string(big), string(decoded), "log payload did not round-trip")
+
+	if _, err := dbmodel.DecodeLogPayload("gz:banana"); err == nil {
+		t.Error("expected error decoding malformed payload")
+	}
+}
+
+func TestTraceIDStrings(t *testing.T) {
+	short := model.NewTraceID(0, 0xabcd)
+	encodings := dbmodel.TraceIDStrings(short)
+	if len(encodings) != 2 {
+		t.Fatalf("expected both encodings for a zero-high trace ID, got %v", encodings)
+	}
+	if encodings[0] != "000000000000abcd" || encodings[1] != "0000000000000000000000000000abcd" {
+		t.Errorf("unexpected encodings %v", encodings)
+	}
+	for _, encoded := range encodings {
+		decoded, err := model.TraceIDFromString(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded != short {
+			t.Errorf("encoding '%s' decoded to %v, expected %v", encoded, decoded, short)
+		}
+	}
+
+	long := model.NewTraceID(0x1122, 0xabcd)
+	encodings = dbmodel.TraceIDStrings(long)
+	if len(encodings) != 1 || encodings[0] != "0000000000001122000000000000abcd" {
+		t.Errorf("unexpected encodings %v for a 128-bit trace ID", encodings)
+	}
+}
+
+func TestBuildTraceIDQueryOperationNameSubstring(t *testing.T) {
+	q := dbmodel.NewFluxTraceQuery("b", spanMeasurement, logMeasurement, time.Now().Add(-time.Hour))
+	q.OperationName("~get/user.v1")
+	fluxQuery := q.BuildTraceIDQuery()
+	if !strings.Contains(fluxQuery, `r.operation_name =~ /get\/user\.v1/`) {
+		t.Errorf("expected an escaped substring regex on the operation name:\n%s", fluxQuery)
+	}
+
+	q = dbmodel.NewFluxTraceQuery("b", spanMeasurement, logMeasurement, time.Now().Add(-time.Hour))
+	q.OperationName("get-user")
+	fluxQuery = q.BuildTraceIDQuery()
+	if !strings.Contains(fluxQuery, `r.operation_name == "get-user"`) {
+		t.Errorf("expected an exact operation name match:\n%s", fluxQuery)
+	}
+}
+
+func TestBuildTraceQueryMatchesBothTraceIDEncodings(t *testing.T) {
+	short := model.NewTraceID(0, 0xabcd)
+	q := dbmodel.NewFluxTraceQuery("b", spanMeasurement, logMeasurement, time.Now().Add(-time.Hour))
+	fluxQuery := q.BuildTraceQuery([]model.TraceID{short})
+	for _, encoded := range dbmodel.TraceIDStrings(short) {
+		if !strings.Contains(fluxQuery, `"`+encoded+`"`) {
+			t.Errorf("trace query does not match encoding '%s':\n%s", encoded, fluxQuery)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package dbmodel_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/influxdata/flux/ast"
+	"github.com/influxdata/flux/parser"
+	"github.com/influxdata/influxql"
+	"github.com/influxdata/jaeger-influxdb/dbmodel"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+// pathologicalNames are service, operation, and tag values that would break
+// out of a Flux string literal if interpolated unescaped.
+var pathologicalNames = []string{
+	`plain-service`,
+	`with"quote`,
+	`with\backslash`,
+	`trailing\`,
+	"with\nnewline",
+	"with\r\nboth",
+	"with\ttab",
+	`with${interpolation}`,
+	`$dollar{`,
+	`foo" or true or r.x == "`,
+	`"; drop() //`,
+	`\"`,
+	`\${`,
+	`ünïcödé 服务`,
+}
+
+// parseFlux parses src and fails the test if the result contains any error.
+func parseFlux(t *testing.T, src string) *ast.Package {
+	t.Helper()
+	pkg := parser.ParseSource(src)
+	if err := ast.GetError(pkg); err != nil {
+		t.Fatalf("generated Flux does not parse: %v\nsource:\n%s", err, src)
+	}
+	return pkg
+}
+
+// stringLiteralValue parses `x = "<escaped>"` and returns the literal's value,
+// failing if the escaped text parses as anything but a plain string literal.
+func stringLiteralValue(t *testing.T, escaped string) string {
+	t.Helper()
+	pkg := parseFlux(t, `x = "`+escaped+`"`)
+	body := pkg.Files[0].Body
+	if len(body) != 1 {
+		t.Fatalf("expected 1 statement, got %d", len(body))
+	}
+	assignment, ok := body[0].(*ast.VariableAssignment)
+	if !ok {
+		t.Fatalf("expected a variable assignment, got %T", body[0])
+	}
+	literal, ok := assignment.Init.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("escaped value parses as %T, not a string literal", assignment.Init)
+	}
+	return literal.Value
+}
+
+func FuzzEscapeFluxString(f *testing.F) {
+	for _, name := range pathologicalNames {
+		f.Add(name)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		if !utf8.ValidString(value) {
+			t.Skip("Flux strings are UTF-8")
+		}
+		if got := stringLiteralValue(t, dbmodel.EscapeFluxString(value)); got != value {
+			t.Errorf("escaped value did not round-trip through the Flux parser:\ninput:  %q\noutput: %q", value, got)
+		}
+	})
+}
+
+func FuzzBuildTraceIDQuery(f *testing.F) {
+	for _, name := range pathologicalNames {
+		f.Add(name, name, name)
+	}
+	f.Fuzz(func(t *testing.T, service, operation, tagValue string) {
+		if !utf8.ValidString(service) || !utf8.ValidString(operation) || !utf8.ValidString(tagValue) {
+			t.Skip("Flux strings are UTF-8")
+		}
+		q := dbmodel.FluxTraceQueryFromTQP("b", spanMeasurement, logMeasurement, &spanstore.TraceQueryParameters{
+			ServiceName:   service,
+			OperationName: operation,
+			Tags:          map[string]string{"k": tagValue, tagValue: "v"},
+			StartTimeMin:  time.Unix(1550013480, 0),
+			NumTraces:     20,
+		})
+		parseFlux(t, q.BuildTraceIDQuery())
+	})
+}
+
+func FuzzEscapeInfluxQLString(f *testing.F) {
+	for _, name := range pathologicalNames {
+		f.Add(name)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		if !utf8.ValidString(value) {
+			t.Skip("InfluxQL strings are UTF-8")
+		}
+		expr, err := influxql.ParseExpr(`'` + dbmodel.EscapeInfluxQLString(value) + `'`)
+		if err != nil {
+			t.Fatalf("escaped value does not parse: %v\ninput: %q", err, value)
+		}
+		literal, ok := expr.(*influxql.StringLiteral)
+		if !ok {
+			t.Fatalf("escaped value parses as %T, not a string literal", expr)
+		}
+		// The InfluxQL scanner folds carriage returns into newlines, so the
+		// escaper normalizes them the same way.
+		expected := strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(value)
+		if literal.Val != expected {
+			t.Errorf("escaped value did not round-trip through the InfluxQL parser:\ninput:  %q\noutput: %q", value, literal.Val)
+		}
+	})
+}
+
+// parseInfluxQL parses src and fails the test if it does not parse.
+func parseInfluxQL(t *testing.T, src string) {
+	t.Helper()
+	if _, err := influxql.ParseQuery(src); err != nil {
+		t.Fatalf("generated InfluxQL does not parse: %v\nsource:\n%s", err, src)
+	}
+}
+
+func TestEscapedInfluxQLQueriesParse(t *testing.T) {
+	for _, name := range pathologicalNames {
+		q := dbmodel.InfluxQLTraceQueryFromTQP(spanMeasurement, &spanstore.TraceQueryParameters{
+			ServiceName:   name,
+			OperationName: name,
+			Tags:          map[string]string{"k": name, name: "v"},
+			StartTimeMin:  time.Unix(1550013480, 0),
+			StartTimeMax:  time.Unix(1550013490, 0),
+			DurationMin:   time.Millisecond,
+			NumTraces:     20,
+		})
+
+		parseInfluxQL(t, q.BuildTraceIDQuery())
+	}
+}
+
+func TestRegexTagPatternsParse(t *testing.T) {
+	// Delimiter slashes must survive embedding whether or not the pattern
+	// already escapes them; doubling a pre-escaped slash ends the regex
+	// literal early.
+	for _, value := range []string{`~/a\/b/`, `~/a/b/`, `~/^svc-[0-9]+$/`, `~/\\\/x/`} {
+		q := dbmodel.FluxTraceQueryFromTQP("b", spanMeasurement, logMeasurement, &spanstore.TraceQueryParameters{
+			ServiceName:  "svc",
+			Tags:         map[string]string{"k": value},
+			StartTimeMin: time.Unix(1550013480, 0),
+		}).RegexTags()
+		parseFlux(t, q.BuildTraceIDQuery())
+
+		iq := dbmodel.InfluxQLTraceQueryFromTQP(spanMeasurement, &spanstore.TraceQueryParameters{
+			ServiceName:  "svc",
+			Tags:         map[string]string{"k": value},
+			StartTimeMin: time.Unix(1550013480, 0),
+		}).RegexTags()
+		parseInfluxQL(t, iq.BuildTraceIDQuery())
+	}
+}
+
+func TestEscapedQueriesParse(t *testing.T) {
+	for _, name := range pathologicalNames {
+		q := dbmodel.FluxTraceQueryFromTQP("b", spanMeasurement, logMeasurement, &spanstore.TraceQueryParameters{
+			ServiceName:   name,
+			OperationName: name,
+			Tags:          map[string]string{"k": name, name: "v"},
+			StartTimeMin:  time.Unix(1550013480, 0),
+			StartTimeMax:  time.Unix(1550013490, 0),
+			DurationMin:   time.Millisecond,
+			NumTraces:     20,
+		})
+
+		parseFlux(t, q.BuildTraceIDQuery())
+		parseFlux(t, q.BuildTraceQuery([]model.TraceID{traceID}))
+		parseFlux(t, q.BuildFlatTraceQuery([]model.TraceID{traceID}))
+		parseFlux(t, q.BuildSinglePointTraceQuery([]model.TraceID{traceID}))
+		parseFlux(t, fmt.Sprintf("f = (r) => %s", q.TraceIDQueryTemplateData().TagsPredicate))
+	}
+}
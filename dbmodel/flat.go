@@ -0,0 +1,563 @@
+package dbmodel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/influxdata/flux"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/jaeger-influxdb/common"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/pkg/multierror"
+	"github.com/pkg/errors"
+)
+
+// The flat schema stores each span as one row that already carries every
+// column a trace query needs, so whole traces can be read without the Flux
+// pivot() step. pivot materializes each table in memory, which is the
+// dominant memory cost of trace queries on busy InfluxDB instances; the flat
+// schema trades a packed span field for skipping it entirely.
+//
+// Tags are identical to the default schema. The span's remaining attributes
+// (span ID, duration, flags, process tag keys, references, checksum) are
+// packed tab-separated into a single string field, plus a separate numeric
+// duration field so trace ID queries and duration filters work unchanged.
+
+// flatFieldCount is the number of tab-separated parts in the packed span
+// field; single-point spans append one more part holding the embedded logs.
+const (
+	flatFieldCount        = 6
+	singlePointFieldCount = 7
+)
+
+// packFlatSpan packs a span's field attributes into the flat schema's single
+// string field value.
+func packFlatSpan(span *model.Span, checksum bool, logger hclog.Logger) string {
+	var processTagKeys []string
+	for _, tag := range span.Process.Tags {
+		processTagKeys = append(processTagKeys, tag.Key)
+	}
+
+	var references []string
+	for _, spanRef := range span.References {
+		if spanRef.SpanID == 0 {
+			continue
+		}
+
+		var referenceType string
+		switch spanRef.RefType {
+		case model.SpanRefType_CHILD_OF:
+			referenceType = common.ReferenceTypeChildOf
+		case model.SpanRefType_FOLLOWS_FROM:
+			referenceType = common.ReferenceTypeFollowsFrom
+		default:
+			logger.Warn("skipped unrecognized span reference type",
+				"skipped-spanref-id-and-type", fmt.Sprintf("%s:%s", spanRef.SpanID.String(), spanRef.RefType.String()))
+			continue
+		}
+		reference := fmt.Sprintf("%s:%s", spanRef.SpanID.String(), referenceType)
+		if spanRef.TraceID != span.TraceID && spanRef.TraceID != (model.TraceID{}) {
+			// Cross-trace references (async FOLLOWS_FROM links) keep their
+			// trace ID so the link survives the round trip.
+			reference = spanRef.TraceID.String() + ":" + reference
+		}
+		references = append(references, reference)
+	}
+
+	var checksumValue string
+	if checksum {
+		checksumValue = SpanChecksum(span)
+	}
+
+	return strings.Join([]string{
+		span.SpanID.String(),
+		strconv.FormatInt(span.Duration.Nanoseconds(), 10),
+		strconv.FormatUint(uint64(span.Flags), 10),
+		// TODO escape commas
+		strings.Join(processTagKeys, ","),
+		// TODO escape colons and commas
+		strings.Join(references, ","),
+		checksumValue,
+	}, "\t")
+}
+
+// unpackFlatSpan parses a packed flat span field value into span, returning
+// the stored checksum (empty when checksums are disabled). Single-point
+// values carry an extra part holding the span's embedded logs.
+func unpackFlatSpan(span *model.Span, packed string, processTagKeys map[string]struct{}) (string, error) {
+	parts := strings.Split(packed, "\t")
+	if len(parts) != flatFieldCount && len(parts) != singlePointFieldCount {
+		return "", errors.Errorf("expected %d parts in flat span field, got %d", flatFieldCount, len(parts))
+	}
+
+	var err error
+	span.SpanID, err = model.SpanIDFromString(parts[0])
+	if err != nil {
+		return "", err
+	}
+
+	durationNanos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", errors.WithMessagef(err, "invalid duration '%s' in flat span field", parts[1])
+	}
+	span.Duration = time.Duration(durationNanos)
+
+	flags, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return "", errors.WithMessagef(err, "invalid flags '%s' in flat span field", parts[2])
+	}
+	span.Flags = model.Flags(flags)
+
+	if parts[3] != "" {
+		for _, k := range strings.Split(parts[3], ",") {
+			processTagKeys[k] = struct{}{}
+		}
+	}
+
+	if parts[4] != "" {
+		span.References, err = referencesFromString(parts[4])
+		if err != nil {
+			return "", errors.WithMessagef(err, "invalid reference '%s'", parts[4])
+		}
+	}
+
+	if len(parts) == singlePointFieldCount && parts[6] != "" {
+		decoded, err := DecodeLogPayload(parts[6])
+		if err != nil {
+			return "", errors.WithMessage(err, "invalid embedded logs in flat span field")
+		}
+		if err := json.Unmarshal(decoded, &span.Logs); err != nil {
+			return "", errors.WithMessage(err, "invalid embedded logs in flat span field")
+		}
+	}
+
+	return parts[5], nil
+}
+
+// SpanToFlatPointsV2 converts a Jaeger span to InfluxDB v2.x points in the
+// flat (pivot-free) schema. Log points are unchanged from the default schema.
+func SpanToFlatPointsV2(span *model.Span, spanMeasurement, logMeasurement string, checksum bool, logger hclog.Logger) ([]models.Point, error) {
+	var tags models.Tags
+
+	tags.SetString(common.TraceIDKey, span.TraceID.String())
+	tags.SetString(common.ServiceNameKey, span.Process.ServiceName)
+	tags.SetString(common.OperationNameKey, span.OperationName)
+
+	for _, tag := range append(span.Tags, span.Process.Tags...) {
+		key, value, err := keyValueAsStrings(&tag)
+		if err != nil {
+			logger.Warn(err.Error(),
+				"skipped-key-and-type", fmt.Sprintf("%s:%s", tag.Key, tag.VType.String()))
+			continue
+		}
+
+		tags.SetString(key, value)
+	}
+
+	// OTel SDKs set status codes instead of the legacy "error" tag; derive it
+	// so error searches still match these spans.
+	if explicit, derived := errorFromTags(span.Tags); !explicit && derived {
+		tags.SetString(common.ErrorKey, "b:t")
+	}
+
+	fields := models.Fields{
+		common.FlatSpanKey: packFlatSpan(span, checksum, logger),
+		// Duration is also stored as its own field so trace ID queries can
+		// filter and sort without unpacking.
+		common.DurationKey: span.Duration.Nanoseconds(),
+	}
+
+	startTime := mergeTimeAndSpanID(span.StartTime, span.SpanID)
+	spanPoint, err := models.NewPoint(spanMeasurement, tags, fields, startTime)
+	if err != nil {
+		return nil, err
+	}
+	points := append(make([]models.Point, 0, len(span.Logs)+1), spanPoint)
+
+	return append(points, spanLogPointsV2(span, logMeasurement, logger)...), nil
+}
+
+// encodeSpanLogs encodes a span's log entries as JSON for embedding into the
+// packed span field, optionally compressed above compressThreshold bytes.
+// Logs are dropped from the end until the encoding fits maxBytes, so one
+// log-heavy span cannot blow up its point.
+func encodeSpanLogs(span *model.Span, maxBytes, compressThreshold int, logger hclog.Logger) string {
+	if len(span.Logs) == 0 {
+		return ""
+	}
+
+	logs := span.Logs
+	for len(logs) > 0 {
+		encoded, err := json.Marshal(logs)
+		if err != nil {
+			logger.Warn("skipping span logs that failed to encode",
+				common.TraceIDKey, span.TraceID.String(),
+				common.SpanIDKey, span.SpanID.String(),
+				"error", err)
+			return ""
+		}
+		payload := EncodeLogPayload(encoded, compressThreshold)
+		if maxBytes <= 0 || len(payload) <= maxBytes {
+			if len(logs) < len(span.Logs) {
+				logger.Warn("truncated embedded span logs to fit size budget",
+					common.TraceIDKey, span.TraceID.String(),
+					common.SpanIDKey, span.SpanID.String(),
+					"kept", len(logs), "dropped", len(span.Logs)-len(logs))
+			}
+			return payload
+		}
+		logs = logs[:len(logs)-1]
+	}
+
+	return ""
+}
+
+// SpanToSinglePointV2 converts a Jaeger span to exactly one InfluxDB v2.x
+// point, with the span's logs embedded in the packed field rather than
+// written as separate log points. Fewer points per span means lower write
+// amplification, at the cost of capping embedded log size at maxLogBytes.
+// Embedded logs of at least logCompressThreshold bytes are compressed;
+// 0 disables compression.
+func SpanToSinglePointV2(span *model.Span, spanMeasurement string, maxLogBytes, logCompressThreshold int, checksum bool, logger hclog.Logger) (models.Point, error) {
+	var tags models.Tags
+
+	tags.SetString(common.TraceIDKey, span.TraceID.String())
+	tags.SetString(common.ServiceNameKey, span.Process.ServiceName)
+	tags.SetString(common.OperationNameKey, span.OperationName)
+
+	for _, tag := range append(span.Tags, span.Process.Tags...) {
+		key, value, err := keyValueAsStrings(&tag)
+		if err != nil {
+			logger.Warn(err.Error(),
+				"skipped-key-and-type", fmt.Sprintf("%s:%s", tag.Key, tag.VType.String()))
+			continue
+		}
+
+		tags.SetString(key, value)
+	}
+
+	// OTel SDKs set status codes instead of the legacy "error" tag; derive it
+	// so error searches still match these spans.
+	if explicit, derived := errorFromTags(span.Tags); !explicit && derived {
+		tags.SetString(common.ErrorKey, "b:t")
+	}
+
+	fields := models.Fields{
+		common.FlatSpanKey: packFlatSpan(span, checksum, logger) + "\t" + encodeSpanLogs(span, maxLogBytes, logCompressThreshold, logger),
+		// Duration is also stored as its own field so trace ID queries can
+		// filter and sort without unpacking.
+		common.DurationKey: span.Duration.Nanoseconds(),
+	}
+
+	startTime := mergeTimeAndSpanID(span.StartTime, span.SpanID)
+	return models.NewPoint(spanMeasurement, tags, fields, startTime)
+}
+
+// spanFromFlatFluxColReader converts one unpivoted flat schema row to a
+// Jaeger span.
+func spanFromFlatFluxColReader(reader flux.ColReader, rowI int) (*model.Span, error) {
+	span := model.Span{
+		Process: &model.Process{},
+	}
+	processTagKeys := make(map[string]struct{})
+	var checksum string
+	var errs []error
+
+	for colI, col := range reader.Cols() {
+		if isNull(reader, colI, rowI) {
+			continue
+		}
+
+		switch col.Label {
+		case common.MeasurementKey, common.FieldKey:
+			continue
+
+		case common.SpanIDTagKey:
+			// Series key copy of the span ID (collision strategy); the
+			// packed span field is authoritative.
+			continue
+
+		case common.TimeV2Key:
+			span.StartTime = removeSpanIDFromTime(reader.Times(colI).Value(rowI))
+
+		case common.TraceIDKey:
+			var err error
+			span.TraceID, err = model.TraceIDFromString(reader.Strings(colI).ValueString(rowI))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+		case common.ServiceNameKey:
+			span.Process.ServiceName = reader.Strings(colI).ValueString(rowI)
+
+		case common.OperationNameKey:
+			span.OperationName = reader.Strings(colI).ValueString(rowI)
+
+		case common.ValueKey:
+			var err error
+			checksum, err = unpackFlatSpan(&span, reader.Strings(colI).ValueString(rowI), processTagKeys)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+		default:
+			// Assume this is a span tag, which means the value is string type.
+			tag, err := stringsToKeyValue(col.Label, reader.Strings(colI).ValueString(rowI))
+			if err != nil {
+				errs = append(errs, errors.WithMessagef(err, "invalid tag value '%s'", reader.Strings(colI).ValueString(rowI)))
+				continue
+			}
+			span.Tags = append(span.Tags, *tag)
+		}
+	}
+
+	for i := range span.References {
+		if span.References[i].TraceID == (model.TraceID{}) {
+			span.References[i].TraceID = span.TraceID
+		}
+	}
+
+	for i := len(span.Tags) - 1; i >= 0; i-- {
+		if _, found := processTagKeys[span.Tags[i].Key]; found {
+			// Move tag from span to span.Process
+			span.Process.Tags = append(span.Process.Tags, span.Tags[i])
+			span.Tags[i] = span.Tags[len(span.Tags)-1]
+			span.Tags = span.Tags[:len(span.Tags)-1]
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, multierror.Wrap(errs)
+	}
+
+	VerifySpanChecksum(&span, checksum)
+
+	return &span, nil
+}
+
+// traceFromFlatFluxTable converts an unpivoted flat schema table to a Jaeger trace.
+func traceFromFlatFluxTable(table flux.Table) (*model.Trace, error) {
+	var trace model.Trace
+	err := table.Do(func(reader flux.ColReader) error {
+		for rowI := 0; rowI < reader.Len(); rowI++ {
+			span, err := spanFromFlatFluxColReader(reader, rowI)
+			if err != nil {
+				return err
+			}
+			trace.Spans = append(trace.Spans, span)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &trace, nil
+}
+
+// TracesFromFlatFluxResult converts a flux Result to Jaeger traces, where
+// span tables use the flat (pivot-free) schema and log tables remain pivoted.
+func TracesFromFlatFluxResult(resultIterator flux.ResultIterator, spanMeasurement, logMeasurement string, logger hclog.Logger) ([]*model.Trace, error) {
+	var traces []*model.Trace
+	logsByTraceIDSpanID := make(map[model.TraceID]map[model.SpanID][]model.Log)
+
+	for resultIterator.More() {
+		err := resultIterator.Next().Tables().Do(func(table flux.Table) error {
+			measurement, err := getMeasurement(table)
+			if err != nil {
+				return err
+			}
+			switch measurement {
+			case spanMeasurement:
+				trace, err := traceFromFlatFluxTable(table)
+				if err == nil {
+					traces = append(traces, trace)
+				}
+				return err
+
+			case logMeasurement:
+				var traceID model.TraceID
+				if v := table.Key().LabelValue(common.TraceIDKey); v == nil {
+					return errors.Errorf("column '%s' not found in log table key", common.TraceIDKey)
+				} else {
+					traceID, err = model.TraceIDFromString(v.Str())
+					if err != nil {
+						return errors.WithMessage(err, "failed to deserialize '%s' from log table key")
+					}
+				}
+
+				logs, err := logsFromFluxTable(table, nil, logger)
+				if err == nil {
+					logsByTraceIDSpanID[traceID] = logs
+				}
+				return err
+
+			default:
+				return errors.Errorf("don't know what to do with measurement '%s'", measurement)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, trace := range traces {
+		for _, span := range trace.Spans {
+			if logsBySpanID := logsByTraceIDSpanID[span.TraceID]; logsBySpanID != nil {
+				span.Logs = logsBySpanID[span.SpanID]
+			}
+		}
+	}
+
+	return traces, nil
+}
+
+// BuildFlatTraceQuery builds a flux query that returns whole traces from the
+// flat schema. Only the log branch is pivoted; span rows are returned as
+// written, avoiding the pivot memory cost for the bulk of the data.
+func (q *FluxTraceQuery) BuildFlatTraceQuery(traceIDs []model.TraceID) string {
+	var start, stop string
+	start = q.startTimeMin.Add(-1 * time.Hour).UTC().Format(time.RFC3339Nano)
+	if !q.startTimeMax.IsZero() {
+		stop = q.startTimeMax.Add(time.Hour).UTC().Format(time.RFC3339Nano)
+	}
+
+	rangeFn := fmt.Sprintf(`range(start: %s)`, start)
+	if stop != "" {
+		rangeFn = fmt.Sprintf(`range(start: %s, stop: %s)`, start, stop)
+	}
+
+	var traceIDFilters []string
+	for i := range traceIDs {
+		for _, encoded := range TraceIDStrings(traceIDs[i]) {
+			traceIDFilters = append(traceIDFilters, fmt.Sprintf(`r.%s == "%s"`, common.TraceIDKey, encoded))
+		}
+	}
+	traceIDFilter := strings.Join(traceIDFilters, " or ")
+
+	spanStages := []string{
+		fmt.Sprintf(`from(bucket: "%s")`, q.bucket),
+		rangeFn,
+		fmt.Sprintf(`filter(fn: (r) => r.%s == "%s" and r.%s == "%s" and (%s)%s)`,
+			common.MeasurementKey, q.spanMeasurement, common.FieldKey, common.FlatSpanKey, traceIDFilter, q.extraFilterAnd()),
+		fmt.Sprintf(`group(columns: ["%s", "%s"])`, common.MeasurementKey, common.TraceIDKey),
+		`drop(columns: ["_start", "_stop"])`,
+	}
+
+	logStages := []string{
+		fmt.Sprintf(`from(bucket: "%s")`, q.bucket),
+		rangeFn,
+		fmt.Sprintf(`filter(fn: (r) => r.%s == "%s" and (%s)%s)`,
+			common.MeasurementKey, q.logMeasurement, traceIDFilter, q.extraFilterAnd()),
+		fmt.Sprintf(
+			`pivot(rowKey:["%s"], columnKey:["%s"], valueColumn:"%s")`,
+			common.TimeV2Key, common.FieldKey, common.ValueKey),
+		fmt.Sprintf(`group(columns: ["%s", "%s"])`, common.MeasurementKey, common.TraceIDKey),
+		`drop(columns: ["_start", "_stop"])`,
+	}
+
+	if q.maxRows > 0 {
+		limit := fmt.Sprintf(`limit(n: %d)`, q.maxRows)
+		spanStages = append(spanStages, limit)
+		logStages = append(logStages, limit)
+	}
+
+	spans := strings.Join(spanStages, "\n |> ")
+	if q.skipLogs {
+		return spans
+	}
+	logs := strings.Join(logStages, "\n |> ")
+
+	return fmt.Sprintf("spans = %s\n\nlogs = %s\n\nunion(tables: [spans, logs])", spans, logs)
+}
+
+// BuildSinglePointTraceQuery builds a flux query that returns whole traces
+// from the single-point schema. With logs embedded in the packed span field
+// there is no log branch to union in, and still no pivot.
+func (q *FluxTraceQuery) BuildSinglePointTraceQuery(traceIDs []model.TraceID) string {
+	var builder []string
+	builder = append(builder, fmt.Sprintf(`from(bucket: "%s")`, q.bucket))
+
+	if !q.startTimeMax.IsZero() {
+		builder = append(builder,
+			fmt.Sprintf(
+				`range(start: %s, stop: %s)`,
+				q.startTimeMin.Add(-1*time.Hour).UTC().Format(time.RFC3339Nano),
+				q.startTimeMax.Add(time.Hour).UTC().Format(time.RFC3339Nano)))
+	} else {
+		builder = append(builder,
+			fmt.Sprintf(
+				`range(start: %s)`,
+				q.startTimeMin.Add(-1*time.Hour).UTC().Format(time.RFC3339Nano)))
+	}
+
+	var traceIDFilters []string
+	for i := range traceIDs {
+		for _, encoded := range TraceIDStrings(traceIDs[i]) {
+			traceIDFilters = append(traceIDFilters, fmt.Sprintf(`r.%s == "%s"`, common.TraceIDKey, encoded))
+		}
+	}
+
+	builder = append(builder,
+		fmt.Sprintf(`filter(fn: (r) => r.%s == "%s" and r.%s == "%s" and (%s)%s)`,
+			common.MeasurementKey, q.spanMeasurement, common.FieldKey, common.FlatSpanKey, strings.Join(traceIDFilters, " or "), q.extraFilterAnd()),
+		fmt.Sprintf(`group(columns: ["%s", "%s"])`, common.MeasurementKey, common.TraceIDKey),
+		`drop(columns: ["_start", "_stop"])`,
+	)
+
+	if q.maxRows > 0 {
+		builder = append(builder, fmt.Sprintf(`limit(n: %d)`, q.maxRows))
+	}
+
+	return strings.Join(builder, "\n |> ")
+}
+
+// DependencyLinksFromFlatResultV2 converts unpivoted flat schema rows to a
+// dependency graph. Each row carries the service name tag and the packed
+// span field.
+func DependencyLinksFromFlatResultV2(resultIterator flux.ResultIterator) ([]model.DependencyLink, error) {
+	parentByChild := make(map[model.SpanID]model.SpanID)
+	serviceNameBySpanID := make(map[model.SpanID]string)
+	for resultIterator.More() {
+		err := resultIterator.Next().Tables().Do(func(table flux.Table) error {
+			return table.Do(func(reader flux.ColReader) error {
+				valueColI, serviceNameColI := -1, -1
+				for i := range reader.Cols() {
+					switch reader.Cols()[i].Label {
+					case common.ValueKey:
+						valueColI = i
+					case common.ServiceNameKey:
+						serviceNameColI = i
+					}
+				}
+
+				for rowI := 0; rowI < reader.Len(); rowI++ {
+					var span model.Span
+					if _, err := unpackFlatSpan(&span, reader.Strings(valueColI).ValueString(rowI), map[string]struct{}{}); err != nil {
+						return errors.WithMessagef(err, "failed to parse flat span field '%s'", reader.Strings(valueColI).ValueString(rowI))
+					}
+					serviceNameBySpanID[span.SpanID] = reader.Strings(serviceNameColI).ValueString(rowI)
+
+					for _, reference := range span.References {
+						if reference.RefType == model.SpanRefType_CHILD_OF {
+							parentByChild[span.SpanID] = reference.SpanID
+						}
+					}
+				}
+
+				return nil
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return dependencyLinksFromMaps(parentByChild, serviceNameBySpanID), nil
+}
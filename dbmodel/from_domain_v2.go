@@ -12,7 +12,9 @@ import (
 
 // SpanToPointsV2 converts a Jaeger span to InfluxDB v2.x points.
 // One point for the span itself, and one point for each log entry on the span.
-func SpanToPointsV2(span *model.Span, spanMeasurement, logMeasurement string, logger hclog.Logger) ([]models.Point, error) {
+// When checksum is true, an integrity checksum over the span's canonical
+// encoding is stored as an additional field.
+func SpanToPointsV2(span *model.Span, spanMeasurement, logMeasurement string, checksum bool, logger hclog.Logger) ([]models.Point, error) {
 	var tags models.Tags
 
 	tags.SetString(common.TraceIDKey, span.TraceID.String())
@@ -30,12 +32,21 @@ func SpanToPointsV2(span *model.Span, spanMeasurement, logMeasurement string, lo
 		tags.SetString(key, value)
 	}
 
+	// OTel SDKs set status codes instead of the legacy "error" tag; derive it
+	// so error searches still match these spans.
+	if explicit, derived := errorFromTags(span.Tags); !explicit && derived {
+		tags.SetString(common.ErrorKey, "b:t")
+	}
+
 	fields := models.Fields{}
 
 	fields[common.SpanIDKey] = span.SpanID.String()
 	// The 3 least significant digits are always 0. Jaeger uses µs, not ns
 	fields[common.DurationKey] = span.Duration.Nanoseconds()
 	fields[common.FlagsKey] = uint32(span.Flags)
+	if checksum {
+		fields[common.ChecksumKey] = SpanChecksum(span)
+	}
 
 	var processTagKeys []string
 	for _, tag := range span.Process.Tags {
@@ -63,7 +74,13 @@ func SpanToPointsV2(span *model.Span, spanMeasurement, logMeasurement string, lo
 				"skipped-spanref-id-and-type", fmt.Sprintf("%s:%s", spanRef.SpanID.String(), spanRef.RefType.String()))
 			continue
 		}
-		references = append(references, fmt.Sprintf("%s:%s", spanRef.SpanID.String(), referenceType))
+		reference := fmt.Sprintf("%s:%s", spanRef.SpanID.String(), referenceType)
+		if spanRef.TraceID != span.TraceID && spanRef.TraceID != (model.TraceID{}) {
+			// Cross-trace references (async FOLLOWS_FROM links) keep their
+			// trace ID so the link survives the round trip.
+			reference = spanRef.TraceID.String() + ":" + reference
+		}
+		references = append(references, reference)
 	}
 	if len(references) > 0 {
 		// TODO escape colons and commas
@@ -77,6 +94,14 @@ func SpanToPointsV2(span *model.Span, spanMeasurement, logMeasurement string, lo
 	}
 	points := append(make([]models.Point, 0, len(span.Logs)+1), spanPoint)
 
+	return append(points, spanLogPointsV2(span, logMeasurement, logger)...), nil
+}
+
+// spanLogPointsV2 converts a span's log entries to InfluxDB v2.x points,
+// one point per log entry.
+func spanLogPointsV2(span *model.Span, logMeasurement string, logger hclog.Logger) []models.Point {
+	var points []models.Point
+
 	if len(span.Logs) > 0 {
 		var tags models.Tags
 		tags.SetString(common.TraceIDKey, span.TraceID.String())
@@ -116,5 +141,5 @@ func SpanToPointsV2(span *model.Span, spanMeasurement, logMeasurement string, lo
 		}
 	}
 
-	return points, nil
+	return points
 }
@@ -0,0 +1,85 @@
+package dbmodel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Log-heavy traces dominate both storage and query transfer size, so the
+// embedded log payload of a single-point span can optionally be compressed.
+// The wire format is "gz:<uncompressed length>:<base64 deflate stream>"; a
+// payload below the compression threshold is stored as plaintext JSON, which
+// always starts with '[' and so can never collide with the codec prefix.
+// The codec prefix leaves room for alternatives (e.g. zstd) once a suitable
+// library is vendored.
+
+// compressedLogPrefix marks a compressed log payload.
+const compressedLogPrefix = "gz:"
+
+// EncodeLogPayload returns the stored form of an encoded log payload,
+// compressing it when it is at least threshold bytes; threshold <= 0
+// disables compression.
+func EncodeLogPayload(encoded []byte, threshold int) string {
+	if threshold <= 0 || len(encoded) < threshold {
+		return string(encoded)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(encoded); err != nil {
+		// Compression of an in-memory buffer cannot realistically fail;
+		// fall back to plaintext rather than lose the logs.
+		return string(encoded)
+	}
+	if err := zw.Close(); err != nil {
+		return string(encoded)
+	}
+
+	return fmt.Sprintf("%s%d:%s", compressedLogPrefix, len(encoded), base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
+
+// DecodeLogPayload reverses EncodeLogPayload, decompressing the payload when
+// it carries the codec prefix.
+func DecodeLogPayload(payload string) ([]byte, error) {
+	if !strings.HasPrefix(payload, compressedLogPrefix) {
+		return []byte(payload), nil
+	}
+
+	parts := strings.SplitN(payload[len(compressedLogPrefix):], ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("malformed compressed log payload: missing length prefix")
+	}
+	length, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, errors.WithMessagef(err, "malformed compressed log payload length '%s'", parts[0])
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.WithMessage(err, "malformed compressed log payload")
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, errors.WithMessage(err, "malformed compressed log payload")
+	}
+
+	// The length prefix bounds decompression, so a corrupt payload cannot
+	// balloon in memory.
+	decoded, err := ioutil.ReadAll(io.LimitReader(zr, int64(length)+1))
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to decompress log payload")
+	}
+	if len(decoded) != length {
+		return nil, errors.Errorf("compressed log payload length mismatch: stored %d, decompressed %d", length, len(decoded))
+	}
+
+	return decoded, nil
+}
@@ -25,9 +25,11 @@ func (q *InfluxQLLogQuery) BuildLogQuery(traceIDs []model.TraceID) string {
 	var builder []string
 	builder = append(builder, fmt.Sprintf(`select * from %s where`, q.measurement))
 
-	predicates := make([]string, len(traceIDs))
-	for i, traceID := range traceIDs {
-		predicates[i] = fmt.Sprintf(`"%s" = '%s'`, common.TraceIDKey, traceID.String())
+	var predicates []string
+	for _, traceID := range traceIDs {
+		for _, encoded := range TraceIDStrings(traceID) {
+			predicates = append(predicates, fmt.Sprintf(`"%s" = '%s'`, common.TraceIDKey, encoded))
+		}
 	}
 	builder = append(builder,
 		fmt.Sprintf(`%s`, strings.Join(predicates, " or ")),
@@ -0,0 +1,74 @@
+package dbmodel
+
+import (
+	"github.com/jaegertracing/jaeger/model"
+)
+
+// Schema identifies one layout of trace data in an InfluxDB bucket.
+// During a live schema migration a Reader may be configured with more than
+// one Schema, so that traces written under the old layout remain readable
+// for the overlap window.
+type Schema struct {
+	SpanMeasurement string
+	LogMeasurement  string
+
+	// Flat marks the pivot-free layout, where each span point carries a
+	// single packed field so trace queries need no Flux pivot.
+	Flat bool
+
+	// SinglePoint marks the flat layout variant with logs embedded in the
+	// packed span field, so each span is exactly one point.
+	SinglePoint bool
+}
+
+// MergeTraces merges traces that share a trace ID into a single trace,
+// e.g. when parts of one trace were read from two schema layouts.
+// Spans duplicated across layouts are deduplicated by span ID.
+// MergeTraceSpans combines every span of the given traces into one trace,
+// deduplicating by span ID. GetTrace uses it when a single-trace query comes
+// back split into several traces, e.g. when spans straddle measurement or
+// bucket boundaries.
+func MergeTraceSpans(traces []*model.Trace) *model.Trace {
+	merged := &model.Trace{}
+	seen := make(map[model.SpanID]struct{})
+	for _, trace := range traces {
+		for _, span := range trace.Spans {
+			if _, found := seen[span.SpanID]; found {
+				continue
+			}
+			seen[span.SpanID] = struct{}{}
+			merged.Spans = append(merged.Spans, span)
+		}
+	}
+	return merged
+}
+
+func MergeTraces(traces []*model.Trace) []*model.Trace {
+	byTraceID := make(map[model.TraceID]*model.Trace)
+	var merged []*model.Trace
+
+	for _, trace := range traces {
+		if len(trace.Spans) == 0 {
+			continue
+		}
+		traceID := trace.Spans[0].TraceID
+		existing, found := byTraceID[traceID]
+		if !found {
+			byTraceID[traceID] = trace
+			merged = append(merged, trace)
+			continue
+		}
+
+		seen := make(map[model.SpanID]struct{}, len(existing.Spans))
+		for _, span := range existing.Spans {
+			seen[span.SpanID] = struct{}{}
+		}
+		for _, span := range trace.Spans {
+			if _, found := seen[span.SpanID]; !found {
+				existing.Spans = append(existing.Spans, span)
+			}
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,20 @@
+package dbmodel
+
+import (
+	"fmt"
+
+	"github.com/influxdata/flux/ast"
+	"github.com/influxdata/flux/parser"
+	"github.com/pkg/errors"
+)
+
+// ValidateFluxPredicate checks that expr parses as a Flux boolean expression
+// over a filter row r, so that a bad operator-supplied search filter fails
+// at startup instead of breaking every search query.
+func ValidateFluxPredicate(expr string) error {
+	pkg := parser.ParseSource(fmt.Sprintf("f = (r) => %s", expr))
+	if err := ast.GetError(pkg); err != nil {
+		return errors.Wrapf(err, "invalid flux predicate '%s'", expr)
+	}
+	return nil
+}
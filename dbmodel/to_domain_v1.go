@@ -156,8 +156,8 @@ func TraceFromInfluxQLRow(row *models.Row) (*model.Trace, error) {
 		errs = append(errs, errors.New("trace_id tag not found"))
 	}
 
-	timeColI, serviceNameColI, operationNameColI, spanIDColI, durationColI, flagsColI, processTagKeysColI, referencesColI :=
-		-1, -1, -1, -1, -1, -1, -1, -1
+	timeColI, serviceNameColI, operationNameColI, spanIDColI, durationColI, flagsColI, processTagKeysColI, referencesColI, checksumColI :=
+		-1, -1, -1, -1, -1, -1, -1, -1, -1
 	jaegerTagKeysByColI := make(map[int]string)
 
 	for colI, col := range row.Columns {
@@ -178,6 +178,11 @@ func TraceFromInfluxQLRow(row *models.Row) (*model.Trace, error) {
 			processTagKeysColI = colI
 		case common.ReferencesKey:
 			referencesColI = colI
+		case common.ChecksumKey:
+			checksumColI = colI
+		case common.SpanIDTagKey:
+			// Series key copy of the span ID (collision strategy); the
+			// span_id field is authoritative.
 
 		default:
 			jaegerTagKeysByColI[colI] = col
@@ -217,7 +222,9 @@ func TraceFromInfluxQLRow(row *models.Row) (*model.Trace, error) {
 				continue
 			}
 			for i := range references {
-				references[i].TraceID = traceID
+				if references[i].TraceID == (model.TraceID{}) {
+					references[i].TraceID = traceID
+				}
 			}
 		}
 
@@ -287,6 +294,10 @@ func TraceFromInfluxQLRow(row *models.Row) (*model.Trace, error) {
 			Logs:          nil, // Append later, from different measurement
 		}
 
+		if checksumColI != -1 && v[checksumColI] != nil {
+			VerifySpanChecksum(span, v[checksumColI].(string))
+		}
+
 		trace.Spans = append(trace.Spans, span)
 	}
 
@@ -114,6 +114,7 @@ func SpanFromFluxColReader(reader flux.ColReader, rowI int) (*model.Span, error)
 		Process: &model.Process{},
 	}
 	processTagKeys := make(map[string]struct{})
+	var checksum string
 	var errs []error
 
 	for colI, col := range reader.Cols() {
@@ -169,6 +170,14 @@ func SpanFromFluxColReader(reader flux.ColReader, rowI int) (*model.Span, error)
 			}
 			span.References = references
 
+		case common.ChecksumKey:
+			checksum = reader.Strings(colI).ValueString(rowI)
+
+		case common.SpanIDTagKey:
+			// Series key copy of the span ID (collision strategy); the
+			// span_id field is authoritative.
+			continue
+
 		default:
 			// Assume this is a span tag, which means the value is string type.
 			tag, err := stringsToKeyValue(col.Label, reader.Strings(colI).ValueString(rowI))
@@ -181,7 +190,9 @@ func SpanFromFluxColReader(reader flux.ColReader, rowI int) (*model.Span, error)
 	}
 
 	for i := range span.References {
-		span.References[i].TraceID = span.TraceID
+		if span.References[i].TraceID == (model.TraceID{}) {
+			span.References[i].TraceID = span.TraceID
+		}
 	}
 
 	for i := len(span.Tags) - 1; i >= 0; i-- {
@@ -197,6 +208,8 @@ func SpanFromFluxColReader(reader flux.ColReader, rowI int) (*model.Span, error)
 		return nil, multierror.Wrap(errs)
 	}
 
+	VerifySpanChecksum(&span, checksum)
+
 	return &span, nil
 }
 
@@ -228,7 +241,7 @@ func getMeasurement(table flux.Table) (string, error) {
 }
 
 // traceFromFluxTable converts a flux Table to a Jaeger trace.
-func traceFromFluxTable(table flux.Table) (*model.Trace, error) {
+func traceFromFluxTable(table flux.Table, budget *DecodeBudget) (*model.Trace, error) {
 	var trace model.Trace
 	err := table.Do(func(reader flux.ColReader) error {
 		for rowI := 0; rowI < reader.Len(); rowI++ {
@@ -236,19 +249,28 @@ func traceFromFluxTable(table flux.Table) (*model.Trace, error) {
 			if err != nil {
 				return err
 			}
+			if !budget.chargeSpan(span) {
+				return errBudgetExhausted
+			}
 			trace.Spans = append(trace.Spans, span)
 		}
 		return nil
 	})
-	if err != nil {
+	if err != nil && err != errBudgetExhausted {
 		return nil, err
 	}
 
-	return &trace, nil
+	return &trace, err
 }
 
 // TracesFromFluxResult converts a flux Result to Jaeger traces.
 func TracesFromFluxResult(resultIterator flux.ResultIterator, spanMeasurement, logMeasurement string, logger hclog.Logger) ([]*model.Trace, error) {
+	return TracesFromFluxResultWithBudget(resultIterator, spanMeasurement, logMeasurement, nil, logger)
+}
+
+// TracesFromFluxResultWithBudget converts a flux Result to Jaeger traces,
+// stopping early with the traces decoded so far once the budget is spent.
+func TracesFromFluxResultWithBudget(resultIterator flux.ResultIterator, spanMeasurement, logMeasurement string, budget *DecodeBudget, logger hclog.Logger) ([]*model.Trace, error) {
 	var traces []*model.Trace
 	logsByTraceIDSpanID := make(map[model.TraceID]map[model.SpanID][]model.Log)
 
@@ -260,8 +282,8 @@ func TracesFromFluxResult(resultIterator flux.ResultIterator, spanMeasurement, l
 			}
 			switch measurement {
 			case spanMeasurement:
-				trace, err := traceFromFluxTable(table)
-				if err == nil {
+				trace, err := traceFromFluxTable(table, budget)
+				if err == nil || err == errBudgetExhausted {
 					traces = append(traces, trace)
 				}
 				return err
@@ -277,8 +299,8 @@ func TracesFromFluxResult(resultIterator flux.ResultIterator, spanMeasurement, l
 					}
 				}
 
-				logs, err := logsFromFluxTable(table, logger)
-				if err == nil {
+				logs, err := logsFromFluxTable(table, budget, logger)
+				if err == nil || err == errBudgetExhausted {
 					logsByTraceIDSpanID[traceID] = logs
 				}
 				return err
@@ -287,6 +309,11 @@ func TracesFromFluxResult(resultIterator flux.ResultIterator, spanMeasurement, l
 				return errors.Errorf("don't know what to do with measurement '%s'", measurement)
 			}
 		})
+		if err == errBudgetExhausted || budget.Exhausted() {
+			logger.Warn("trace decode memory budget exhausted; returning partial traces",
+				"budget-bytes", budget.MaxBytes, "traces", len(traces))
+			break
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -303,7 +330,7 @@ func TracesFromFluxResult(resultIterator flux.ResultIterator, spanMeasurement, l
 	return traces, nil
 }
 
-func logsFromFluxTable(table flux.Table, logger hclog.Logger) (map[model.SpanID][]model.Log, error) {
+func logsFromFluxTable(table flux.Table, budget *DecodeBudget, logger hclog.Logger) (map[model.SpanID][]model.Log, error) {
 	logsBySpanID := make(map[model.SpanID][]model.Log)
 	var err error
 
@@ -314,10 +341,16 @@ func logsFromFluxTable(table flux.Table, logger hclog.Logger) (map[model.SpanID]
 				logger.Warn("failed to get span log from flux result", "error", err)
 				continue
 			}
+			if !budget.chargeLog(spanLog) {
+				return errBudgetExhausted
+			}
 			logsBySpanID[spanID] = append(logsBySpanID[spanID], *spanLog)
 		}
 		return nil
 	})
+	if err == errBudgetExhausted {
+		return logsBySpanID, err
+	}
 	if err != nil || len(logsBySpanID) < 1 {
 		return nil, err
 	}
@@ -469,6 +502,79 @@ func DependencyLinksFromResultV2(resultIterator flux.ResultIterator) ([]model.De
 		}
 	}
 
+	return dependencyLinksFromMaps(parentByChild, serviceNameBySpanID), nil
+}
+
+// DependencyLinksFromJoinResultV2 converts the result of the server-side
+// dependency join to a dependency graph. Each row already carries one
+// aggregated link: the parent and child service names and the call count.
+func DependencyLinksFromJoinResultV2(resultIterator flux.ResultIterator) ([]model.DependencyLink, error) {
+	var dependencyLinks []model.DependencyLink
+	for resultIterator.More() {
+		err := resultIterator.Next().Tables().Do(func(table flux.Table) error {
+			return table.Do(func(reader flux.ColReader) error {
+				parentColI, childColI, callCountColI := -1, -1, -1
+				for i := range reader.Cols() {
+					switch reader.Cols()[i].Label {
+					case common.DependencyParentKey:
+						parentColI = i
+					case common.DependencyChildKey:
+						childColI = i
+					case common.DependencyCallCountKey:
+						callCountColI = i
+					}
+				}
+				if parentColI < 0 || childColI < 0 || callCountColI < 0 {
+					return errors.New("dependency join result is missing a parent, child or call_count column")
+				}
+
+				for rowI := 0; rowI < reader.Len(); rowI++ {
+					parent := reader.Strings(parentColI).ValueString(rowI)
+					child := reader.Strings(childColI).ValueString(rowI)
+					if parent == child {
+						continue
+					}
+					dependencyLinks = append(dependencyLinks, model.DependencyLink{
+						Parent:    parent,
+						Child:     child,
+						CallCount: uint64(reader.Ints(callCountColI).Value(rowI)),
+					})
+				}
+
+				return nil
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return dependencyLinks, nil
+}
+
+// MergeDependencyLinks combines dependency links from several queries (e.g.
+// one per time sub-window) into one graph, summing call counts per
+// (parent, child) pair.
+func MergeDependencyLinks(linkSets ...[]model.DependencyLink) []model.DependencyLink {
+	byEdge := make(map[string]int)
+	var merged []model.DependencyLink
+	for _, links := range linkSets {
+		for _, link := range links {
+			key := link.Parent + "\x00" + link.Child
+			if i, found := byEdge[key]; found {
+				merged[i].CallCount += link.CallCount
+				continue
+			}
+			byEdge[key] = len(merged)
+			merged = append(merged, link)
+		}
+	}
+	return merged
+}
+
+// dependencyLinksFromMaps aggregates parent/child span relationships into
+// inter-service dependency links.
+func dependencyLinksFromMaps(parentByChild map[model.SpanID]model.SpanID, serviceNameBySpanID map[model.SpanID]string) []model.DependencyLink {
 	m := make(map[string]*model.DependencyLink)
 	for child, parent := range parentByChild {
 		dl := m[child.String()+parent.String()]
@@ -491,5 +597,5 @@ func DependencyLinksFromResultV2(resultIterator flux.ResultIterator) ([]model.De
 		dependencyLinks = append(dependencyLinks, *dl)
 	}
 
-	return dependencyLinks, nil
+	return dependencyLinks
 }
@@ -0,0 +1,201 @@
+package dbmodel
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/influxdata/jaeger-influxdb/common"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/pkg/multierror"
+	"github.com/pkg/errors"
+)
+
+// SQLRow is one row of an InfluxDB 3.x SQL query response, decoded from the
+// JSON lines format; numbers arrive as json.Number.
+type SQLRow map[string]interface{}
+
+// sqlNaiveTimeFormat is the timestamp format the 3.x SQL endpoint uses for
+// the time column: RFC3339 without a zone suffix, implicitly UTC.
+const sqlNaiveTimeFormat = "2006-01-02T15:04:05.999999999"
+
+// parseSQLTime parses the time column of a SQL response row.
+func parseSQLTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case string:
+		if parsed, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			return parsed, nil
+		}
+		return time.ParseInLocation(sqlNaiveTimeFormat, t, time.UTC)
+	case json.Number:
+		nanos, err := t.Int64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, nanos), nil
+	default:
+		return time.Time{}, errors.Errorf("unexpected time column type %T", v)
+	}
+}
+
+// sqlRowString returns the named column as a string; absent or null columns
+// come back empty.
+func sqlRowString(row SQLRow, key string) string {
+	s, _ := row[key].(string)
+	return s
+}
+
+// spanFromFlatSQLRow converts one flat schema SQL row to a Jaeger span.
+// Columns the span does not carry arrive as nulls and are skipped.
+func spanFromFlatSQLRow(row SQLRow) (*model.Span, error) {
+	span := model.Span{
+		Process: &model.Process{},
+	}
+	processTagKeys := make(map[string]struct{})
+	var checksum string
+	var errs []error
+
+	for key, value := range row {
+		if value == nil {
+			continue
+		}
+
+		switch key {
+		case common.DurationKey, common.SpanIDTagKey:
+			// The packed span field is authoritative for both.
+			continue
+
+		case common.TimeV1Key:
+			t, err := parseSQLTime(value)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			span.StartTime = removeSpanIDFromTime(t.UnixNano())
+
+		case common.TraceIDKey:
+			var err error
+			span.TraceID, err = model.TraceIDFromString(value.(string))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+		case common.ServiceNameKey:
+			span.Process.ServiceName = value.(string)
+
+		case common.OperationNameKey:
+			span.OperationName = value.(string)
+
+		case common.FlatSpanKey:
+			var err error
+			checksum, err = unpackFlatSpan(&span, value.(string), processTagKeys)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+		default:
+			// Assume this is a span tag, which means the value is string type.
+			stringValue, ok := value.(string)
+			if !ok {
+				continue
+			}
+			tag, err := stringsToKeyValue(key, stringValue)
+			if err != nil {
+				errs = append(errs, errors.WithMessagef(err, "invalid tag value '%s'", stringValue))
+				continue
+			}
+			span.Tags = append(span.Tags, *tag)
+		}
+	}
+
+	for i := range span.References {
+		if span.References[i].TraceID == (model.TraceID{}) {
+			span.References[i].TraceID = span.TraceID
+		}
+	}
+
+	for i := len(span.Tags) - 1; i >= 0; i-- {
+		if _, found := processTagKeys[span.Tags[i].Key]; found {
+			// Move tag from span to span.Process
+			span.Process.Tags = append(span.Process.Tags, span.Tags[i])
+			span.Tags[i] = span.Tags[len(span.Tags)-1]
+			span.Tags = span.Tags[:len(span.Tags)-1]
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, multierror.Wrap(errs)
+	}
+
+	VerifySpanChecksum(&span, checksum)
+
+	return &span, nil
+}
+
+// TracesFromFlatSQLRows converts flat schema SQL rows to Jaeger traces,
+// grouping spans by trace ID.
+func TracesFromFlatSQLRows(rows []SQLRow) ([]*model.Trace, error) {
+	traceByID := make(map[model.TraceID]*model.Trace)
+	var traces []*model.Trace
+	for _, row := range rows {
+		span, err := spanFromFlatSQLRow(row)
+		if err != nil {
+			return nil, err
+		}
+		trace, found := traceByID[span.TraceID]
+		if !found {
+			trace = &model.Trace{}
+			traceByID[span.TraceID] = trace
+			traces = append(traces, trace)
+		}
+		trace.Spans = append(trace.Spans, span)
+	}
+
+	return traces, nil
+}
+
+// TraceIDsFromSQLRows extracts trace IDs from the rows of a trace ID query.
+func TraceIDsFromSQLRows(rows []SQLRow) ([]model.TraceID, error) {
+	traceIDs := make([]model.TraceID, 0, len(rows))
+	for _, row := range rows {
+		encoded := sqlRowString(row, common.TraceIDKey)
+		if encoded == "" {
+			continue
+		}
+		traceID, err := model.TraceIDFromString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		traceIDs = append(traceIDs, traceID)
+	}
+
+	return traceIDs, nil
+}
+
+// DependencyLinksFromFlatSQLRows converts flat schema SQL rows to a
+// dependency graph. Each row carries the service name and the packed span
+// field.
+func DependencyLinksFromFlatSQLRows(rows []SQLRow) ([]model.DependencyLink, error) {
+	parentByChild := make(map[model.SpanID]model.SpanID)
+	serviceNameBySpanID := make(map[model.SpanID]string)
+	for _, row := range rows {
+		packed := sqlRowString(row, common.FlatSpanKey)
+		if packed == "" {
+			continue
+		}
+		var span model.Span
+		if _, err := unpackFlatSpan(&span, packed, map[string]struct{}{}); err != nil {
+			return nil, errors.WithMessagef(err, "failed to parse flat span field '%s'", packed)
+		}
+		serviceNameBySpanID[span.SpanID] = sqlRowString(row, common.ServiceNameKey)
+
+		for _, reference := range span.References {
+			if reference.RefType == model.SpanRefType_CHILD_OF {
+				parentByChild[span.SpanID] = reference.SpanID
+			}
+		}
+	}
+
+	return dependencyLinksFromMaps(parentByChild, serviceNameBySpanID), nil
+}
@@ -0,0 +1,71 @@
+package dbmodel
+
+import (
+	"github.com/jaegertracing/jaeger/model"
+)
+
+// Tag keys for structural information computed on read; the Jaeger UI
+// renders these like any other span tag.
+const (
+	childSpanCountKey    = "childSpanCount"
+	traceSpanCountKey    = "trace.spanCount"
+	traceDepthKey        = "trace.depth"
+	traceServiceCountKey = "trace.serviceCount"
+)
+
+// ComputeTraceStatistics annotates a reconstructed trace with structural
+// information: a childSpanCount tag on each span with children, and trace
+// totals (span count, depth, distinct services) on each root span.
+func ComputeTraceStatistics(trace *model.Trace) {
+	if len(trace.Spans) == 0 {
+		return
+	}
+
+	childCounts := make(map[model.SpanID]int64, len(trace.Spans))
+	children := make(map[model.SpanID][]*model.Span, len(trace.Spans))
+	services := make(map[string]struct{})
+	var roots []*model.Span
+
+	for _, span := range trace.Spans {
+		if span.Process != nil {
+			services[span.Process.ServiceName] = struct{}{}
+		}
+		if parentSpanID := span.ParentSpanID(); parentSpanID != 0 {
+			childCounts[parentSpanID]++
+			children[parentSpanID] = append(children[parentSpanID], span)
+		} else {
+			roots = append(roots, span)
+		}
+	}
+
+	for _, span := range trace.Spans {
+		if count := childCounts[span.SpanID]; count > 0 {
+			span.Tags = append(span.Tags, model.Int64(childSpanCountKey, count))
+		}
+	}
+
+	for _, root := range roots {
+		root.Tags = append(root.Tags,
+			model.Int64(traceSpanCountKey, int64(len(trace.Spans))),
+			model.Int64(traceDepthKey, traceDepth(root, children, make(map[model.SpanID]struct{}))),
+			model.Int64(traceServiceCountKey, int64(len(services))))
+	}
+}
+
+// traceDepth returns the depth of the span tree rooted at span; a lone root
+// has depth 1. The visited set guards against reference cycles in bad data.
+func traceDepth(span *model.Span, children map[model.SpanID][]*model.Span, visited map[model.SpanID]struct{}) int64 {
+	if _, found := visited[span.SpanID]; found {
+		return 0
+	}
+	visited[span.SpanID] = struct{}{}
+
+	var maxChildDepth int64
+	for _, child := range children[span.SpanID] {
+		if depth := traceDepth(child, children, visited); depth > maxChildDepth {
+			maxChildDepth = depth
+		}
+	}
+
+	return maxChildDepth + 1
+}
@@ -2,6 +2,7 @@ package dbmodel
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
@@ -18,6 +19,10 @@ type FluxTraceQuery struct {
 	durationMin, durationMax        time.Duration
 	tags                            map[string]string
 	numTraces                       int
+	maxRows                         int
+	skipLogs                        bool
+	extraFilter                     string
+	regexTags                       bool
 }
 
 // NewFluxTraceQuery constructs a new FluxTraceQuery object.
@@ -45,6 +50,12 @@ func FluxTraceQueryFromTQP(bucket, spanMeasurement, logMeasurement string, query
 		q.StartTimeMax(query.StartTimeMax)
 	}
 	for k, v := range query.Tags {
+		if k == common.SkipLogsTagKey {
+			if v == "true" {
+				q.SkipLogs()
+			}
+			continue
+		}
 		q.Tag(k, v)
 	}
 	if query.DurationMin > 0 {
@@ -66,7 +77,8 @@ func (q *FluxTraceQuery) ServiceName(serviceName string) *FluxTraceQuery {
 	return q
 }
 
-// OperationName sets the query operation name.
+// OperationName sets the query operation name. A leading "~" requests a
+// substring match instead of equality.
 func (q *FluxTraceQuery) OperationName(operationName string) *FluxTraceQuery {
 	q.tags[common.OperationNameKey] = operationName
 	return q
@@ -78,6 +90,31 @@ func (q *FluxTraceQuery) Tag(k, v string) *FluxTraceQuery {
 	return q
 }
 
+// RegexTags interprets query tag values of the form ~/pattern/ as regular
+// expressions. Patterns are matched unanchored against the stored tag value,
+// which carries a type prefix such as "s:" for strings.
+func (q *FluxTraceQuery) RegexTags() *FluxTraceQuery {
+	q.regexTags = true
+	return q
+}
+
+// ExtraFilter adds an operator-defined Flux boolean expression over r to
+// every query this builder generates, so a shared bucket can be partitioned
+// (e.g. `r.env == "prod"`); validate it with ValidateFluxPredicate first.
+func (q *FluxTraceQuery) ExtraFilter(expr string) *FluxTraceQuery {
+	q.extraFilter = expr
+	return q
+}
+
+// extraFilterAnd returns the extra filter as an " and (...)" suffix for a
+// filter expression, or the empty string when unset.
+func (q *FluxTraceQuery) extraFilterAnd() string {
+	if q.extraFilter == "" {
+		return ""
+	}
+	return fmt.Sprintf(" and (%s)", q.extraFilter)
+}
+
 // StartTimeMax sets the max start time to query.
 func (q *FluxTraceQuery) StartTimeMax(startTimeMax time.Time) *FluxTraceQuery {
 	q.startTimeMax = startTimeMax
@@ -102,6 +139,22 @@ func (q *FluxTraceQuery) NumTraces(numTraces int) *FluxTraceQuery {
 	return q
 }
 
+// SkipLogs omits the log measurement from trace content queries, returning
+// spans without their logs; searches get much cheaper when log volume is
+// high.
+func (q *FluxTraceQuery) SkipLogs() *FluxTraceQuery {
+	q.skipLogs = true
+	return q
+}
+
+// MaxRows caps the rows each result table may return with a server-side
+// limit(), protecting the plugin from runaway result sets. The cap applies
+// per trace, since trace queries group rows by trace ID.
+func (q *FluxTraceQuery) MaxRows(maxRows int) *FluxTraceQuery {
+	q.maxRows = maxRows
+	return q
+}
+
 // BuildTraceQuery builds a flux query that returns whole traces.
 func (q *FluxTraceQuery) BuildTraceQuery(traceIDs []model.TraceID) string {
 	var builder []string
@@ -122,17 +175,23 @@ func (q *FluxTraceQuery) BuildTraceQuery(traceIDs []model.TraceID) string {
 
 	measurementFilters := []string{
 		fmt.Sprintf(`r.%s == "%s"`, common.MeasurementKey, q.spanMeasurement),
-		fmt.Sprintf(`r.%s == "%s"`, common.MeasurementKey, q.logMeasurement),
+	}
+	if !q.skipLogs {
+		measurementFilters = append(measurementFilters,
+			fmt.Sprintf(`r.%s == "%s"`, common.MeasurementKey, q.logMeasurement))
 	}
 
-	traceIDFilters := make([]string, len(traceIDs))
+	// Both stored encodings of each ID are matched; see TraceIDStrings.
+	var traceIDFilters []string
 	for i := range traceIDs {
-		traceIDFilters[i] = fmt.Sprintf(`r.%s == "%s"`, common.TraceIDKey, traceIDs[i].String())
+		for _, encoded := range TraceIDStrings(traceIDs[i]) {
+			traceIDFilters = append(traceIDFilters, fmt.Sprintf(`r.%s == "%s"`, common.TraceIDKey, encoded))
+		}
 	}
 
 	builder = append(builder,
-		fmt.Sprintf("filter(fn: (r) => (%s) and (%s))",
-			strings.Join(measurementFilters, " or "), strings.Join(traceIDFilters, " or ")))
+		fmt.Sprintf("filter(fn: (r) => (%s) and (%s)%s)",
+			strings.Join(measurementFilters, " or "), strings.Join(traceIDFilters, " or "), q.extraFilterAnd()))
 
 	builder = append(builder,
 		fmt.Sprintf(
@@ -142,10 +201,16 @@ func (q *FluxTraceQuery) BuildTraceQuery(traceIDs []model.TraceID) string {
 		`drop(columns: ["_start", "_stop"])`,
 	)
 
+	if q.maxRows > 0 {
+		builder = append(builder, fmt.Sprintf(`limit(n: %d)`, q.maxRows))
+	}
+
 	return strings.Join(builder, "\n |> ")
 }
 
 // BuildTraceIDQuery builds a flux query that returns Trace IDs.
+// Duration predicates are evaluated server-side against each trace's longest
+// span, after the per-trace max() aggregation below.
 func (q *FluxTraceQuery) BuildTraceIDQuery() string {
 	var builder []string
 	builder = append(builder, fmt.Sprintf(`from(bucket: "%s")`, q.bucket))
@@ -168,7 +233,48 @@ func (q *FluxTraceQuery) BuildTraceIDQuery() string {
 		fmt.Sprintf(`r.%s == "%s"`, common.MeasurementKey, q.spanMeasurement),
 		fmt.Sprintf(`r.%s == "%s"`, common.FieldKey, common.DurationKey))
 	for k, v := range q.tags {
-		filters = append(filters, fmt.Sprintf(`r.%s == "%s"`, k, v))
+		// Service and operation names are stored verbatim; other span tag
+		// values carry a type prefix, so each query tag expands to a
+		// disjunction over its possible stored encodings. Multiple query
+		// tags stay ANDed together. Values are escaped, and caller-supplied
+		// tag keys use bracket member access, so neither can inject Flux.
+		if k == common.ServiceNameKey || k == common.OperationNameKey {
+			// A leading "~" on the operation name requests a substring match
+			// instead of equality, so a search can reach one of a large
+			// service's thousands of operations; see Reader.FindOperations.
+			if k == common.OperationNameKey && strings.HasPrefix(v, "~") {
+				filters = append(filters, fmt.Sprintf(`r.%s =~ /%s/`,
+					k, strings.ReplaceAll(regexp.QuoteMeta(v[1:]), "/", "\\/")))
+				continue
+			}
+			filters = append(filters, fmt.Sprintf(`r.%s == "%s"`, k, EscapeFluxString(v)))
+			continue
+		}
+		// error=true is by far the most common search; match it with one
+		// predicate on the indexed error tag (written for every failed span,
+		// including derived OTel/HTTP errors) instead of a disjunction over
+		// the possible value encodings.
+		if k == common.ErrorKey && v == "true" {
+			filters = append(filters, fmt.Sprintf(
+				`(exists r["%s"] and r["%s"] != "b:f" and r["%s"] != "s:false")`,
+				common.ErrorKey, common.ErrorKey, common.ErrorKey))
+			continue
+		}
+		if q.regexTags {
+			if pattern, ok := regexTagPattern(v); ok {
+				filters = append(filters, fmt.Sprintf(`r["%s"] =~ /%s/`, EscapeFluxString(k), pattern))
+				continue
+			}
+		}
+		encodings := queryTagEncodings(v)
+		terms := make([]string, len(encodings))
+		for i, encoded := range encodings {
+			terms[i] = fmt.Sprintf(`r["%s"] == "%s"`, EscapeFluxString(k), EscapeFluxString(encoded))
+		}
+		filters = append(filters, "("+strings.Join(terms, " or ")+")")
+	}
+	if q.extraFilter != "" {
+		filters = append(filters, fmt.Sprintf("(%s)", q.extraFilter))
 	}
 	builder = append(builder,
 		fmt.Sprintf("filter(fn: (r) => %s)", strings.Join(filters, " and ")),
@@ -203,6 +309,8 @@ func (q *FluxTraceQuery) BuildTraceIDQuery() string {
 		builder = append(builder,
 			fmt.Sprintf(`limit(n: %d)`, q.numTraces),
 			fmt.Sprintf(`keep(columns: ["%s"])`, common.TraceIDKey))
+	} else if q.maxRows > 0 {
+		builder = append(builder, fmt.Sprintf(`limit(n: %d)`, q.maxRows))
 	}
 
 	return strings.Join(builder, "\n |> ")
@@ -17,6 +17,7 @@ type InfluxQLTraceQuery struct {
 	durationMin, durationMax   time.Duration
 	tags                       map[string]string
 	numTraces                  int
+	regexTags                  bool
 }
 
 // NewInfluxQLTraceQuery constructs a new InfluxQLTraceQuery
@@ -101,12 +102,40 @@ func (q *InfluxQLTraceQuery) DurationMin(durationMin time.Duration) *InfluxQLTra
 	return q
 }
 
+// RegexTags interprets query tag values of the form ~/pattern/ as regular
+// expressions, as in the Flux builder.
+func (q *InfluxQLTraceQuery) RegexTags() *InfluxQLTraceQuery {
+	q.regexTags = true
+	return q
+}
+
 // NumTraces sets the query max traces threshold.
 func (q *InfluxQLTraceQuery) NumTraces(numTraces int) *InfluxQLTraceQuery {
 	q.numTraces = numTraces
 	return q
 }
 
+// InfluxQL escapes quotes inside string literals and quoted identifiers
+// with a backslash, unlike SQL's quote doubling. Its scanner folds carriage
+// returns into newlines before tokenizing, so carriage returns cannot be
+// represented and are normalized to newlines here.
+var (
+	influxQLStringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\r\n", `\n`, "\r", `\n`, "\n", `\n`)
+	influxQLIdentEscaper  = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r\n", `\n`, "\r", `\n`, "\n", `\n`)
+)
+
+// EscapeInfluxQLString escapes a value for use in a single-quoted InfluxQL
+// string literal.
+func EscapeInfluxQLString(value string) string {
+	return influxQLStringEscaper.Replace(value)
+}
+
+// EscapeInfluxQLIdentifier escapes a name for use in a double-quoted
+// InfluxQL identifier, such as a tag key.
+func EscapeInfluxQLIdentifier(name string) string {
+	return influxQLIdentEscaper.Replace(name)
+}
+
 // BuildTraceIDQuery builds an InfluxQL query that returns Trace IDs.
 func (q *InfluxQLTraceQuery) BuildTraceIDQuery() string {
 	var innerBuilder []string
@@ -114,7 +143,24 @@ func (q *InfluxQLTraceQuery) BuildTraceIDQuery() string {
 
 	var predicates []string
 	for k, v := range q.tags {
-		predicates = append(predicates, fmt.Sprintf(`"%s" = '%s'`, k, v))
+		// As in the Flux builder, span tag values carry a type prefix, so a
+		// query tag expands to a disjunction over its stored encodings.
+		if k == common.ServiceNameKey || k == common.OperationNameKey {
+			predicates = append(predicates, fmt.Sprintf(`"%s" = '%s'`, EscapeInfluxQLIdentifier(k), EscapeInfluxQLString(v)))
+			continue
+		}
+		if q.regexTags {
+			if pattern, ok := regexTagPattern(v); ok {
+				predicates = append(predicates, fmt.Sprintf(`"%s" =~ /%s/`, EscapeInfluxQLIdentifier(k), pattern))
+				continue
+			}
+		}
+		encodings := queryTagEncodings(v)
+		terms := make([]string, len(encodings))
+		for i, encoded := range encodings {
+			terms[i] = fmt.Sprintf(`"%s" = '%s'`, EscapeInfluxQLIdentifier(k), EscapeInfluxQLString(encoded))
+		}
+		predicates = append(predicates, "("+strings.Join(terms, " or ")+")")
 	}
 	if q.durationMin > 0 {
 		predicates = append(predicates,
@@ -163,9 +209,11 @@ func (q *InfluxQLTraceQuery) BuildTraceQuery(traceIDs []model.TraceID) string {
 	var builder []string
 	builder = append(builder, fmt.Sprintf(`select * from %s where`, q.measurement))
 
-	predicates := make([]string, len(traceIDs))
-	for i, traceID := range traceIDs {
-		predicates[i] = fmt.Sprintf(`"%s" = '%s'`, common.TraceIDKey, traceID.String())
+	var predicates []string
+	for _, traceID := range traceIDs {
+		for _, encoded := range TraceIDStrings(traceID) {
+			predicates = append(predicates, fmt.Sprintf(`"%s" = '%s'`, common.TraceIDKey, encoded))
+		}
 	}
 	builder = append(builder,
 		fmt.Sprintf(`%s`, strings.Join(predicates, " or ")),
@@ -0,0 +1,44 @@
+package dbmodel
+
+import (
+	"errors"
+	"time"
+
+	"github.com/influxdata/jaeger-influxdb/common"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+// NormalizeTraceQueryParams validates query parameters and fills zero-valued
+// time bounds from the given default search window, so that query builders
+// never emit a range() with a zero time. The caller's query is not mutated.
+func NormalizeTraceQueryParams(query *spanstore.TraceQueryParameters, defaultSearchWindow time.Duration) (*spanstore.TraceQueryParameters, error) {
+	if query == nil {
+		return nil, errors.New("trace query parameters are nil")
+	}
+	if query.ServiceName == "" {
+		return nil, errors.New("trace query service name is empty")
+	}
+
+	if defaultSearchWindow < 0 {
+		return nil, errors.New("trace query default search window is negative")
+	}
+	if defaultSearchWindow == 0 {
+		defaultSearchWindow = common.DefaultSearchWindow
+	}
+
+	normalized := *query
+	if normalized.StartTimeMax.IsZero() {
+		normalized.StartTimeMax = time.Now()
+	}
+	if normalized.StartTimeMin.IsZero() {
+		normalized.StartTimeMin = normalized.StartTimeMax.Add(-defaultSearchWindow)
+	}
+	if normalized.StartTimeMax.Before(normalized.StartTimeMin) {
+		return nil, errors.New("trace query start time max precedes start time min")
+	}
+	if normalized.DurationMax > 0 && normalized.DurationMin > normalized.DurationMax {
+		return nil, errors.New("trace query duration min exceeds duration max")
+	}
+
+	return &normalized, nil
+}
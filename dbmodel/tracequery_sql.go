@@ -0,0 +1,196 @@
+package dbmodel
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/influxdata/jaeger-influxdb/common"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+// SQLTraceQuery abstracts a SQL query for spans stored in the flat
+// single-point schema on InfluxDB 3.x, where tags and fields are plain
+// table columns.
+type SQLTraceQuery struct {
+	measurement                string
+	startTimeMin, startTimeMax time.Time
+	durationMin, durationMax   time.Duration
+	tags                       map[string]string
+	numTraces                  int
+}
+
+// NewSQLTraceQuery constructs a new SQLTraceQuery
+func NewSQLTraceQuery(measurement string) *SQLTraceQuery {
+	return &SQLTraceQuery{
+		measurement: measurement,
+		tags:        map[string]string{},
+	}
+}
+
+// SQLTraceQueryFromTQP constructs a SQLTraceQuery using parameters in a spanstore.TraceQueryParameters
+func SQLTraceQueryFromTQP(measurement string, query *spanstore.TraceQueryParameters) *SQLTraceQuery {
+	q := NewSQLTraceQuery(measurement)
+
+	if query.ServiceName != "" {
+		q.ServiceName(query.ServiceName)
+	}
+	if query.OperationName != "" {
+		q.OperationName(query.OperationName)
+	}
+	if !query.StartTimeMin.IsZero() {
+		q.StartTimeMin(query.StartTimeMin)
+	}
+	if !query.StartTimeMax.IsZero() {
+		q.StartTimeMax(query.StartTimeMax)
+	}
+	for k, v := range query.Tags {
+		q.Tag(k, v)
+	}
+	if query.DurationMin > 0 {
+		q.DurationMin(query.DurationMin)
+	}
+	if query.DurationMax > 0 {
+		q.DurationMax(query.DurationMax)
+	}
+	if query.NumTraces > 0 {
+		q.NumTraces(query.NumTraces)
+	}
+
+	return q
+}
+
+// ServiceName sets the query service name.
+func (q *SQLTraceQuery) ServiceName(serviceName string) *SQLTraceQuery {
+	q.tags[common.ServiceNameKey] = serviceName
+	return q
+}
+
+// OperationName sets the query operation name.
+func (q *SQLTraceQuery) OperationName(operationName string) *SQLTraceQuery {
+	q.tags[common.OperationNameKey] = operationName
+	return q
+}
+
+// Tag adds a query tag key:value pair.
+func (q *SQLTraceQuery) Tag(k, v string) *SQLTraceQuery {
+	q.tags[k] = v
+	return q
+}
+
+// StartTimeMin sets the min start time to query.
+func (q *SQLTraceQuery) StartTimeMin(startTimeMin time.Time) *SQLTraceQuery {
+	q.startTimeMin = startTimeMin
+	return q
+}
+
+// StartTimeMax sets the max start time to query.
+func (q *SQLTraceQuery) StartTimeMax(startTimeMax time.Time) *SQLTraceQuery {
+	q.startTimeMax = startTimeMax
+	return q
+}
+
+// DurationMax sets the query max duration threshold.
+func (q *SQLTraceQuery) DurationMax(durationMax time.Duration) *SQLTraceQuery {
+	q.durationMax = durationMax
+	return q
+}
+
+// DurationMin sets the query min duration threshold.
+func (q *SQLTraceQuery) DurationMin(durationMin time.Duration) *SQLTraceQuery {
+	q.durationMin = durationMin
+	return q
+}
+
+// NumTraces sets the query max traces threshold.
+func (q *SQLTraceQuery) NumTraces(numTraces int) *SQLTraceQuery {
+	q.numTraces = numTraces
+	return q
+}
+
+// EscapeSQLString escapes a value for use in a single-quoted SQL string
+// literal.
+func EscapeSQLString(value string) string {
+	return strings.Replace(value, "'", "''", -1)
+}
+
+// EscapeSQLIdentifier escapes a name for use in a double-quoted SQL
+// identifier, such as a tag key used as a column name.
+func EscapeSQLIdentifier(name string) string {
+	return strings.Replace(name, `"`, `""`, -1)
+}
+
+func (q *SQLTraceQuery) timePredicates() []string {
+	var predicates []string
+	if !q.startTimeMin.IsZero() {
+		predicates = append(predicates,
+			fmt.Sprintf(`"time" >= '%s'`, q.startTimeMin.UTC().Format(time.RFC3339Nano)))
+	}
+	if !q.startTimeMax.IsZero() {
+		predicates = append(predicates,
+			fmt.Sprintf(`"time" <= '%s'`, q.startTimeMax.UTC().Format(time.RFC3339Nano)))
+	}
+	return predicates
+}
+
+// BuildTraceIDQuery builds a SQL query that returns trace IDs, newest first.
+func (q *SQLTraceQuery) BuildTraceIDQuery() string {
+	// The time range goes into the inner query, unlike the InfluxQL builder,
+	// so the engine can prune partitions before grouping.
+	predicates := q.timePredicates()
+	for k, v := range q.tags {
+		// As in the other builders, span tag values carry a type prefix, so a
+		// query tag expands to a disjunction over its stored encodings.
+		if k == common.ServiceNameKey || k == common.OperationNameKey {
+			predicates = append(predicates, fmt.Sprintf(`"%s" = '%s'`, EscapeSQLIdentifier(k), EscapeSQLString(v)))
+			continue
+		}
+		encodings := queryTagEncodings(v)
+		terms := make([]string, len(encodings))
+		for i, encoded := range encodings {
+			terms[i] = fmt.Sprintf(`"%s" = '%s'`, EscapeSQLIdentifier(k), EscapeSQLString(encoded))
+		}
+		predicates = append(predicates, "("+strings.Join(terms, " OR ")+")")
+	}
+	if q.durationMin > 0 {
+		predicates = append(predicates,
+			fmt.Sprintf(`"%s" >= %d`, common.DurationKey, q.durationMin.Nanoseconds()))
+	}
+	if q.durationMax > 0 {
+		predicates = append(predicates,
+			fmt.Sprintf(`"%s" <= %d`, common.DurationKey, q.durationMax.Nanoseconds()))
+	}
+
+	var builder []string
+	builder = append(builder, fmt.Sprintf(`SELECT "%s", MAX("time") AS "latest" FROM "%s"`,
+		common.TraceIDKey, q.measurement))
+	if len(predicates) > 0 {
+		builder = append(builder, fmt.Sprintf("WHERE %s", strings.Join(predicates, " AND ")))
+	}
+	builder = append(builder, fmt.Sprintf(`GROUP BY "%s" ORDER BY "latest" DESC`, common.TraceIDKey))
+	if q.numTraces > 0 {
+		builder = append(builder, fmt.Sprintf("LIMIT %d", q.numTraces))
+	}
+
+	return strings.Join(builder, " ")
+}
+
+// BuildTraceQuery builds a SQL query that returns whole traces.
+func (q *SQLTraceQuery) BuildTraceQuery(traceIDs []model.TraceID) string {
+	var encodings []string
+	for _, traceID := range traceIDs {
+		for _, encoded := range TraceIDStrings(traceID) {
+			encodings = append(encodings, fmt.Sprintf("'%s'", encoded))
+		}
+	}
+
+	predicates := append(q.timePredicates(),
+		fmt.Sprintf(`"%s" IN (%s)`, common.TraceIDKey, strings.Join(encodings, ", ")))
+
+	return strings.Join([]string{
+		fmt.Sprintf(`SELECT * FROM "%s"`, q.measurement),
+		fmt.Sprintf("WHERE %s", strings.Join(predicates, " AND ")),
+		`ORDER BY "time"`,
+	}, " ")
+}
@@ -0,0 +1,53 @@
+package dbmodel
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TraceIDQueryTemplateData exposes the parameters of one trace ID query to
+// operator-supplied Flux templates replacing BuildTraceIDQuery.
+type TraceIDQueryTemplateData struct {
+	Bucket      string
+	Measurement string
+	// Start and Stop are RFC3339Nano range bounds; Stop is "now()" when the
+	// query is unbounded on the right.
+	Start string
+	Stop  string
+	// TagsPredicate is a Flux boolean expression over r covering the
+	// requested tags, or "true" when the query has none.
+	TagsPredicate string
+	// DurationMinNS/DurationMaxNS bound span duration in nanoseconds; zero
+	// means unbounded.
+	DurationMinNS int64
+	DurationMaxNS int64
+	// NumTraces limits the result; zero means unlimited.
+	NumTraces int
+}
+
+// TraceIDQueryTemplateData returns this query's parameters for rendering an
+// external find-trace-ids template.
+func (q *FluxTraceQuery) TraceIDQueryTemplateData() TraceIDQueryTemplateData {
+	data := TraceIDQueryTemplateData{
+		Bucket:        q.bucket,
+		Measurement:   q.spanMeasurement,
+		Start:         q.startTimeMin.UTC().Format(time.RFC3339Nano),
+		Stop:          "now()",
+		TagsPredicate: "true",
+		DurationMinNS: q.durationMin.Nanoseconds(),
+		DurationMaxNS: q.durationMax.Nanoseconds(),
+		NumTraces:     q.numTraces,
+	}
+	if !q.startTimeMax.IsZero() {
+		data.Stop = q.startTimeMax.UTC().Format(time.RFC3339Nano)
+	}
+	if len(q.tags) > 0 {
+		predicates := make([]string, 0, len(q.tags))
+		for k, v := range q.tags {
+			predicates = append(predicates, fmt.Sprintf(`r["%s"] == "%s"`, EscapeFluxString(k), EscapeFluxString(v)))
+		}
+		data.TagsPredicate = strings.Join(predicates, " and ")
+	}
+	return data
+}
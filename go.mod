@@ -3,12 +3,19 @@ module github.com/influxdata/jaeger-influxdb
 go 1.12
 
 require (
+	github.com/apache/arrow/go/arrow v0.0.0-20191024131854-af6fa24be0db
 	github.com/gogo/googleapis v1.2.0 // indirect
 	github.com/hashicorp/go-hclog v0.9.0
+	github.com/hashicorp/go-plugin v1.0.1
 	github.com/influxdata/flux v0.64.0
 	github.com/influxdata/influxdb v1.5.1-0.20200314001451-7dbc07beda47
 	github.com/influxdata/influxdb1-client v0.0.0-20190402204710-8ff2fc3824fc
+	github.com/influxdata/influxql v0.0.0-20180925231337-1cbfca8e56b6
 	github.com/jaegertracing/jaeger v1.17.1
+	github.com/opentracing/opentracing-go v1.1.0
 	github.com/pkg/errors v0.9.1
 	github.com/spf13/viper v1.6.2
+	github.com/uber/jaeger-lib v2.2.0+incompatible
+	google.golang.org/grpc v1.27.1
+	gopkg.in/yaml.v2 v2.2.8
 )
@@ -0,0 +1,192 @@
+// Package grpcplugin serves the store over the Jaeger storage plugin gRPC
+// protocol, like the upstream plugin/storage/grpc server, but streams
+// GetTrace responses chunk by chunk as spans are decoded when the reader
+// supports it, instead of materializing the whole trace first.
+package grpcplugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-plugin"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/plugin/storage/grpc/shared"
+	"github.com/jaegertracing/jaeger/proto-gen/storage_v1"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"google.golang.org/grpc"
+)
+
+const spanBatchSize = 1000
+
+// SpanStreamer is implemented by readers that can hand spans to a callback
+// as they are decoded, without building the full trace in memory.
+type SpanStreamer interface {
+	StreamSpans(ctx context.Context, traceID model.TraceID, fn func([]*model.Span) error) error
+}
+
+// ContextualDependencyReader is implemented by dependency readers whose
+// GetDependencies honors caller cancellation; the stock
+// dependencystore.Reader interface predates context.
+type ContextualDependencyReader interface {
+	GetDependenciesWithContext(ctx context.Context, endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error)
+}
+
+// Serve serves the store over the plugin protocol, with streaming GetTrace
+// when the store's reader implements SpanStreamer.
+func Serve(store shared.StoragePlugin) {
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: shared.Handshake,
+		VersionedPlugins: map[int]plugin.PluginSet{
+			1: map[string]plugin.Plugin{
+				shared.StoragePluginIdentifier: &storageGRPCPlugin{
+					StorageGRPCPlugin: shared.StorageGRPCPlugin{Impl: store},
+				},
+			},
+		},
+		GRPCServer: plugin.DefaultGRPCServer,
+	})
+}
+
+// storageGRPCPlugin registers the streaming-aware server in place of the
+// stock one; the client side is unchanged.
+type storageGRPCPlugin struct {
+	shared.StorageGRPCPlugin
+}
+
+func (p *storageGRPCPlugin) GRPCServer(broker *plugin.GRPCBroker, s *grpc.Server) error {
+	server := &grpcServer{impl: p.Impl}
+	storage_v1.RegisterSpanReaderPluginServer(s, server)
+	storage_v1.RegisterSpanWriterPluginServer(s, server)
+	storage_v1.RegisterDependenciesReaderPluginServer(s, server)
+	return nil
+}
+
+// grpcServer mirrors the upstream plugin server, except that GetTrace
+// streams chunks as the reader decodes spans.
+type grpcServer struct {
+	impl shared.StoragePlugin
+}
+
+func (s *grpcServer) GetDependencies(ctx context.Context, r *storage_v1.GetDependenciesRequest) (*storage_v1.GetDependenciesResponse, error) {
+	var deps []model.DependencyLink
+	var err error
+	if reader, ok := s.impl.DependencyReader().(ContextualDependencyReader); ok {
+		deps, err = reader.GetDependenciesWithContext(ctx, r.EndTime, r.EndTime.Sub(r.StartTime))
+	} else {
+		deps, err = s.impl.DependencyReader().GetDependencies(r.EndTime, r.EndTime.Sub(r.StartTime))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &storage_v1.GetDependenciesResponse{
+		Dependencies: deps,
+	}, nil
+}
+
+func (s *grpcServer) WriteSpan(ctx context.Context, r *storage_v1.WriteSpanRequest) (*storage_v1.WriteSpanResponse, error) {
+	err := s.impl.SpanWriter().WriteSpan(r.Span)
+	if err != nil {
+		return nil, err
+	}
+	return &storage_v1.WriteSpanResponse{}, nil
+}
+
+// GetTrace streams the spans of one trace. With a SpanStreamer reader, each
+// decoded batch of spans is sent before the next is decoded.
+func (s *grpcServer) GetTrace(r *storage_v1.GetTraceRequest, stream storage_v1.SpanReaderPlugin_GetTraceServer) error {
+	if streamer, ok := s.impl.SpanReader().(SpanStreamer); ok {
+		return streamer.StreamSpans(stream.Context(), r.TraceID, func(spans []*model.Span) error {
+			return sendSpans(spans, stream.Send)
+		})
+	}
+
+	trace, err := s.impl.SpanReader().GetTrace(stream.Context(), r.TraceID)
+	if err != nil {
+		return err
+	}
+	return sendSpans(trace.Spans, stream.Send)
+}
+
+func (s *grpcServer) GetServices(ctx context.Context, r *storage_v1.GetServicesRequest) (*storage_v1.GetServicesResponse, error) {
+	services, err := s.impl.SpanReader().GetServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &storage_v1.GetServicesResponse{
+		Services: services,
+	}, nil
+}
+
+func (s *grpcServer) GetOperations(ctx context.Context, r *storage_v1.GetOperationsRequest) (*storage_v1.GetOperationsResponse, error) {
+	operations, err := s.impl.SpanReader().GetOperations(ctx, spanstore.OperationQueryParameters{
+		ServiceName: r.Service,
+		SpanKind:    r.SpanKind,
+	})
+	if err != nil {
+		return nil, err
+	}
+	grpcOperations := make([]*storage_v1.Operation, len(operations))
+	for i, operation := range operations {
+		grpcOperations[i] = &storage_v1.Operation{
+			Name:     operation.Name,
+			SpanKind: operation.SpanKind,
+		}
+	}
+	return &storage_v1.GetOperationsResponse{
+		Operations: grpcOperations,
+	}, nil
+}
+
+func (s *grpcServer) FindTraces(r *storage_v1.FindTracesRequest, stream storage_v1.SpanReaderPlugin_FindTracesServer) error {
+	traces, err := s.impl.SpanReader().FindTraces(stream.Context(), queryParams(r.Query))
+	if err != nil {
+		return err
+	}
+
+	for _, trace := range traces {
+		if err := sendSpans(trace.Spans, stream.Send); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *grpcServer) FindTraceIDs(ctx context.Context, r *storage_v1.FindTraceIDsRequest) (*storage_v1.FindTraceIDsResponse, error) {
+	traceIDs, err := s.impl.SpanReader().FindTraceIDs(ctx, queryParams(r.Query))
+	if err != nil {
+		return nil, err
+	}
+	return &storage_v1.FindTraceIDsResponse{
+		TraceIDs: traceIDs,
+	}, nil
+}
+
+func queryParams(query *storage_v1.TraceQueryParameters) *spanstore.TraceQueryParameters {
+	return &spanstore.TraceQueryParameters{
+		ServiceName:   query.ServiceName,
+		OperationName: query.OperationName,
+		Tags:          query.Tags,
+		StartTimeMin:  query.StartTimeMin,
+		StartTimeMax:  query.StartTimeMax,
+		DurationMin:   query.DurationMin,
+		DurationMax:   query.DurationMax,
+		NumTraces:     int(query.NumTraces),
+	}
+}
+
+func sendSpans(spans []*model.Span, sendFn func(*storage_v1.SpansResponseChunk) error) error {
+	chunk := make([]model.Span, 0, spanBatchSize)
+	for i := 0; i < len(spans); i += spanBatchSize {
+		chunk = chunk[:0]
+		for j := i; j < len(spans) && j < i+spanBatchSize; j++ {
+			chunk = append(chunk, *spans[j])
+		}
+		if err := sendFn(&storage_v1.SpansResponseChunk{Spans: chunk}); err != nil {
+			return fmt.Errorf("failed to send response chunk: %w", err)
+		}
+	}
+
+	return nil
+}
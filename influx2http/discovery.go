@@ -0,0 +1,114 @@
+package influx2http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Resolver provides the current set of InfluxDB endpoints (host:port).
+// Implementations may refresh the set in the background.
+type Resolver interface {
+	Endpoints() []string
+}
+
+// ResolverFunc adapts a discovery callback to the Resolver interface.
+type ResolverFunc func() []string
+
+// Endpoints returns the endpoints from the callback.
+func (f ResolverFunc) Endpoints() []string {
+	return f()
+}
+
+// SRVResolver resolves InfluxDB endpoints from a DNS SRV record, e.g. for
+// InfluxDB behind a Consul service or a Kubernetes headless service.
+type SRVResolver struct {
+	name string
+
+	mu        sync.RWMutex
+	endpoints []string
+}
+
+// NewSRVResolver resolves the SRV record once synchronously and then
+// refreshes it every refreshInterval (default 30s).
+func NewSRVResolver(name string, refreshInterval time.Duration) (*SRVResolver, error) {
+	r := &SRVResolver{name: name}
+	if err := r.refresh(); err != nil {
+		return nil, err
+	}
+
+	if refreshInterval <= 0 {
+		refreshInterval = 30 * time.Second
+	}
+	go func() {
+		for range time.Tick(refreshInterval) {
+			// Keep the last known endpoints on transient DNS failure.
+			_ = r.refresh()
+		}
+	}()
+
+	return r, nil
+}
+
+func (r *SRVResolver) refresh() error {
+	_, addrs, err := net.LookupSRV("", "", r.name)
+	if err != nil {
+		return err
+	}
+
+	endpoints := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		endpoints = append(endpoints, fmt.Sprintf("%s:%d", strings.TrimSuffix(addr.Target, "."), addr.Port))
+	}
+
+	r.mu.Lock()
+	r.endpoints = endpoints
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Endpoints returns the most recently resolved endpoints.
+func (r *SRVResolver) Endpoints() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.endpoints
+}
+
+// discoveryRoundTripper rewrites each request's host to one of the
+// resolver's endpoints, round-robin, before handing off to the base transport.
+type discoveryRoundTripper struct {
+	base     http.RoundTripper
+	resolver Resolver
+	next     uint64
+}
+
+func (t *discoveryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoints := t.resolver.Endpoints()
+	if len(endpoints) == 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	endpoint := endpoints[int(atomic.AddUint64(&t.next, 1)-1)%len(endpoints)]
+
+	routed := new(http.Request)
+	*routed = *req
+	u := *req.URL
+	u.Host = endpoint
+	routed.URL = &u
+	routed.Host = endpoint
+
+	return t.base.RoundTrip(routed)
+}
+
+// SetEndpointResolver routes all requests made by this package's services
+// through endpoints provided by the resolver. Call once, before any client
+// is created.
+func SetEndpointResolver(resolver Resolver) {
+	defaultTransport = &discoveryRoundTripper{base: defaultTransport, resolver: resolver}
+	skipVerifyTransport = &discoveryRoundTripper{base: skipVerifyTransport, resolver: resolver}
+}
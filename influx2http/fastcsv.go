@@ -0,0 +1,704 @@
+package influx2http
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	stdarrow "github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/bitutil"
+	arrowmemory "github.com/apache/arrow/go/arrow/memory"
+	"github.com/influxdata/flux"
+	"github.com/influxdata/flux/execute"
+	"github.com/influxdata/flux/values"
+)
+
+// decodeFastCSV decodes an annotated-CSV query response into buffered
+// results in a single pass over the raw bytes, with none of the streaming
+// machinery or per-value boxing of the Flux library decoder; on large traces
+// the library decoder dominates CPU. The whole response is buffered in
+// memory, so pair it with MaxResponseBytes. An empty response decodes to
+// io.EOF, matching the library decoder's behavior.
+func decodeFastCSV(r io.Reader) (flux.ResultIterator, error) {
+	d := &fastDecoder{br: bufio.NewReaderSize(r, 64*1024)}
+	if err := d.run(); err != nil {
+		return nil, err
+	}
+	if len(d.results) == 0 {
+		return nil, io.EOF
+	}
+	return &fastResultIterator{results: d.results}, nil
+}
+
+type fastResultIterator struct {
+	results []*fastResult
+	i       int
+}
+
+func (itr *fastResultIterator) More() bool                  { return itr.i < len(itr.results) }
+func (itr *fastResultIterator) Next() flux.Result           { r := itr.results[itr.i]; itr.i++; return r }
+func (itr *fastResultIterator) Release()                    {}
+func (itr *fastResultIterator) Err() error                  { return nil }
+func (itr *fastResultIterator) Statistics() flux.Statistics { return flux.Statistics{} }
+
+type fastResult struct {
+	name   string
+	tables []flux.Table
+}
+
+func (r *fastResult) Name() string               { return r.name }
+func (r *fastResult) Tables() flux.TableIterator { return fastTableIterator(r.tables) }
+
+type fastTableIterator []flux.Table
+
+func (t fastTableIterator) Do(f func(flux.Table) error) error {
+	for _, tbl := range t {
+		if err := f(tbl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fastTable is a fully buffered table backed by arrow arrays; it serves as
+// its own ColReader.
+type fastTable struct {
+	key  flux.GroupKey
+	cols []flux.ColMeta
+	arrs []array.Interface
+	n    int
+}
+
+func (t *fastTable) Key() flux.GroupKey                     { return t.key }
+func (t *fastTable) Cols() []flux.ColMeta                   { return t.cols }
+func (t *fastTable) Do(f func(flux.ColReader) error) error  { return f(t) }
+func (t *fastTable) Done()                                  {}
+func (t *fastTable) Empty() bool                            { return t.n == 0 }
+func (t *fastTable) Len() int                               { return t.n }
+func (t *fastTable) Bools(j int) *array.Boolean             { return t.arrs[j].(*array.Boolean) }
+func (t *fastTable) Ints(j int) *array.Int64                { return t.arrs[j].(*array.Int64) }
+func (t *fastTable) UInts(j int) *array.Uint64              { return t.arrs[j].(*array.Uint64) }
+func (t *fastTable) Floats(j int) *array.Float64            { return t.arrs[j].(*array.Float64) }
+func (t *fastTable) Strings(j int) *array.Binary            { return t.arrs[j].(*array.Binary) }
+func (t *fastTable) Times(j int) *array.Int64               { return t.arrs[j].(*array.Int64) }
+func (t *fastTable) Retain()                                {}
+func (t *fastTable) Release()                               {}
+
+// fastColumn accumulates one column's values directly in arrow buffer
+// layout, so sealing the table is a reinterpreting cast rather than a copy.
+type fastColumn struct {
+	meta    flux.ColMeta
+	n       int
+	bools   []bool
+	ints    []int64
+	uints   []uint64
+	floats  []float64
+	offsets []int32
+	bytes   []byte
+	nulls   []int
+}
+
+func (c *fastColumn) appendNull() {
+	switch c.meta.Type {
+	case flux.TBool:
+		c.bools = append(c.bools, false)
+	case flux.TInt, flux.TTime:
+		c.ints = append(c.ints, 0)
+	case flux.TUInt:
+		c.uints = append(c.uints, 0)
+	case flux.TFloat:
+		c.floats = append(c.floats, 0)
+	default:
+		c.appendBytes(nil)
+		c.nulls = append(c.nulls, c.n)
+		c.n++
+		return
+	}
+	c.nulls = append(c.nulls, c.n)
+	c.n++
+}
+
+func (c *fastColumn) appendBytes(v []byte) {
+	if c.offsets == nil {
+		c.offsets = append(c.offsets, 0)
+	}
+	c.bytes = append(c.bytes, v...)
+	c.offsets = append(c.offsets, int32(len(c.bytes)))
+}
+
+// validity packs the recorded null positions into an arrow bitmap; a nil
+// bitmap means every value is set.
+func (c *fastColumn) validity() *arrowmemory.Buffer {
+	if len(c.nulls) == 0 {
+		return nil
+	}
+	bitmap := make([]byte, (c.n+7)/8)
+	for i := range bitmap {
+		bitmap[i] = 0xff
+	}
+	for _, i := range c.nulls {
+		bitutil.ClearBit(bitmap, i)
+	}
+	return arrowmemory.NewBufferBytes(bitmap)
+}
+
+func (c *fastColumn) array() array.Interface {
+	switch c.meta.Type {
+	case flux.TBool:
+		// Booleans are bitmap-packed; they are rare enough in span queries
+		// that the builder path is fine.
+		var valid []bool
+		if len(c.nulls) > 0 {
+			valid = make([]bool, c.n)
+			for i := range valid {
+				valid[i] = true
+			}
+			for _, i := range c.nulls {
+				valid[i] = false
+			}
+		}
+		b := array.NewBooleanBuilder(arrowmemory.DefaultAllocator)
+		b.AppendValues(c.bools, valid)
+		return b.NewBooleanArray()
+	case flux.TInt, flux.TTime:
+		buf := arrowmemory.NewBufferBytes(stdarrow.Int64Traits.CastToBytes(c.ints))
+		data := array.NewData(stdarrow.PrimitiveTypes.Int64, c.n,
+			[]*arrowmemory.Buffer{c.validity(), buf}, nil, len(c.nulls), 0)
+		return array.NewInt64Data(data)
+	case flux.TUInt:
+		buf := arrowmemory.NewBufferBytes(stdarrow.Uint64Traits.CastToBytes(c.uints))
+		data := array.NewData(stdarrow.PrimitiveTypes.Uint64, c.n,
+			[]*arrowmemory.Buffer{c.validity(), buf}, nil, len(c.nulls), 0)
+		return array.NewUint64Data(data)
+	case flux.TFloat:
+		buf := arrowmemory.NewBufferBytes(stdarrow.Float64Traits.CastToBytes(c.floats))
+		data := array.NewData(stdarrow.PrimitiveTypes.Float64, c.n,
+			[]*arrowmemory.Buffer{c.validity(), buf}, nil, len(c.nulls), 0)
+		return array.NewFloat64Data(data)
+	default:
+		if c.offsets == nil {
+			c.offsets = append(c.offsets, 0)
+		}
+		data := array.NewData(stdarrow.BinaryTypes.String, c.n,
+			[]*arrowmemory.Buffer{
+				c.validity(),
+				arrowmemory.NewBufferBytes(stdarrow.Int32Traits.CastToBytes(c.offsets)),
+				arrowmemory.NewBufferBytes(c.bytes),
+			}, nil, len(c.nulls), 0)
+		return array.NewBinaryData(data)
+	}
+}
+
+// fastDecoder holds the annotation state of the CSV block being decoded.
+type fastDecoder struct {
+	br     *bufio.Reader
+	line   []byte
+	fields [][]byte
+
+	// Per-block annotations, aligned with the header labels (the leading
+	// annotation column is stripped from all of them).
+	datatypes []string
+	groups    []string
+	defaults  []string
+	labels    []string
+	types     []flux.ColType
+
+	resultIdx int
+	tableIdx  int
+
+	results []*fastResult
+
+	// Current table accumulation; cols entries are nil for the result and
+	// table bookkeeping columns, which are not part of the decoded table.
+	key          flux.GroupKey
+	cols         []*fastColumn
+	currentTable string
+}
+
+func (d *fastDecoder) run() error {
+	for {
+		rec, err := d.readRecord()
+		if err == io.EOF {
+			return d.finishTable()
+		}
+		if err != nil {
+			return err
+		}
+		if len(rec) == 0 || (len(rec) == 1 && len(rec[0]) == 0) {
+			// A blank line separates results; the result column already
+			// delimits them, so there is nothing to do.
+			continue
+		}
+		if len(rec[0]) > 0 && rec[0][0] == '#' {
+			if err := d.finishTable(); err != nil {
+				return err
+			}
+			switch string(rec[0][1:]) {
+			case "datatype":
+				d.datatypes = copyFields(rec[1:])
+			case "group":
+				d.groups = copyFields(rec[1:])
+			case "default":
+				d.defaults = copyFields(rec[1:])
+			}
+			// Annotations precede a fresh header row.
+			d.labels = nil
+			continue
+		}
+		if d.labels == nil {
+			if err := d.header(rec[1:]); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.row(rec[1:]); err != nil {
+			return err
+		}
+	}
+}
+
+func copyFields(fields [][]byte) []string {
+	out := make([]string, len(fields))
+	for i, f := range fields {
+		out[i] = string(f)
+	}
+	return out
+}
+
+// header records the column labels of a new table block and locates the
+// result and table bookkeeping columns.
+func (d *fastDecoder) header(fields [][]byte) error {
+	// The server reports a failed query as a table whose first column is
+	// labeled "error"; surface the message from its single data row.
+	if len(fields) > 0 && string(fields[0]) == "error" {
+		rec, err := d.readRecord()
+		if err != nil {
+			return err
+		}
+		if len(rec) > 1 && len(rec[1]) > 0 {
+			return fmt.Errorf("%s", rec[1])
+		}
+		return fmt.Errorf("query returned an error table without a message")
+	}
+
+	if len(fields) != len(d.datatypes) {
+		return fmt.Errorf("annotated CSV header has %d columns, datatype annotation has %d", len(fields), len(d.datatypes))
+	}
+	d.labels = copyFields(fields)
+	d.types = make([]flux.ColType, len(d.labels))
+	d.resultIdx = -1
+	d.tableIdx = -1
+	for i, label := range d.labels {
+		d.types[i] = colType(d.datatypes[i])
+		switch label {
+		case "result":
+			d.resultIdx = i
+		case "table":
+			d.tableIdx = i
+		}
+	}
+	return nil
+}
+
+// row appends one data row, starting a new table when the table number
+// changes and a new result when the result name changes.
+func (d *fastDecoder) row(row [][]byte) error {
+	if len(row) != len(d.labels) {
+		return fmt.Errorf("annotated CSV row has %d columns, header has %d", len(row), len(d.labels))
+	}
+
+	var resultName []byte
+	if d.resultIdx >= 0 {
+		resultName = row[d.resultIdx]
+		if len(resultName) == 0 && d.resultIdx < len(d.defaults) {
+			resultName = []byte(d.defaults[d.resultIdx])
+		}
+	}
+	if len(d.results) == 0 || d.results[len(d.results)-1].name != string(resultName) {
+		if err := d.finishTable(); err != nil {
+			return err
+		}
+		d.results = append(d.results, &fastResult{name: string(resultName)})
+	}
+	if d.cols == nil || (d.tableIdx >= 0 && string(row[d.tableIdx]) != d.currentTable) {
+		if err := d.finishTable(); err != nil {
+			return err
+		}
+		if err := d.startTable(row); err != nil {
+			return err
+		}
+	}
+
+	for i, c := range d.cols {
+		if c == nil {
+			continue
+		}
+		v := row[i]
+		if len(v) == 0 {
+			// The default annotation row may be absent or shorter than the
+			// header; a missing entry means an empty default.
+			var def string
+			if i < len(d.defaults) {
+				def = d.defaults[i]
+			}
+			if def != "" {
+				v = []byte(def)
+			} else {
+				// An empty cell with an empty default is a null, as in the
+				// library decoder.
+				c.appendNull()
+				continue
+			}
+		}
+		if err := appendCell(c, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendCell(c *fastColumn, v []byte) error {
+	switch c.meta.Type {
+	case flux.TBool:
+		c.bools = append(c.bools, string(v) == "true")
+	case flux.TInt:
+		n, err := parseIntBytes(v)
+		if err != nil {
+			return err
+		}
+		c.ints = append(c.ints, n)
+	case flux.TUInt:
+		n, err := strconv.ParseUint(string(v), 10, 64)
+		if err != nil {
+			return err
+		}
+		c.uints = append(c.uints, n)
+	case flux.TFloat:
+		n, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return err
+		}
+		c.floats = append(c.floats, n)
+	case flux.TTime:
+		n, err := parseTimeBytes(v)
+		if err != nil {
+			return err
+		}
+		c.ints = append(c.ints, n)
+	default:
+		c.appendBytes(v)
+	}
+	c.n++
+	return nil
+}
+
+// startTable begins a table whose group key is taken from the group-true
+// columns of its first row.
+func (d *fastDecoder) startTable(row [][]byte) error {
+	var keyCols []flux.ColMeta
+	var keyValues []values.Value
+	for i, label := range d.labels {
+		if i >= len(d.groups) || d.groups[i] != "true" {
+			continue
+		}
+		v, err := keyValue(d.types[i], string(row[i]))
+		if err != nil {
+			return err
+		}
+		keyCols = append(keyCols, flux.ColMeta{Label: label, Type: d.types[i]})
+		keyValues = append(keyValues, v)
+	}
+	d.key = execute.NewGroupKey(keyCols, keyValues)
+
+	d.cols = make([]*fastColumn, len(d.labels))
+	for i, label := range d.labels {
+		if i == d.resultIdx || i == d.tableIdx {
+			continue
+		}
+		d.cols[i] = &fastColumn{meta: flux.ColMeta{Label: label, Type: d.types[i]}}
+	}
+	if d.tableIdx >= 0 {
+		d.currentTable = string(row[d.tableIdx])
+	}
+	return nil
+}
+
+// finishTable seals the table being accumulated, if any, into the current
+// result.
+func (d *fastDecoder) finishTable() error {
+	if d.cols == nil {
+		return nil
+	}
+	table := &fastTable{key: d.key}
+	for _, c := range d.cols {
+		if c == nil {
+			continue
+		}
+		table.cols = append(table.cols, c.meta)
+		table.arrs = append(table.arrs, c.array())
+		table.n = c.n
+	}
+	d.cols = nil
+	d.results[len(d.results)-1].tables = append(d.results[len(d.results)-1].tables, table)
+	return nil
+}
+
+func colType(datatype string) flux.ColType {
+	switch datatype {
+	case "boolean":
+		return flux.TBool
+	case "long":
+		return flux.TInt
+	case "unsignedLong":
+		return flux.TUInt
+	case "double":
+		return flux.TFloat
+	case "string":
+		return flux.TString
+	default:
+		if strings.HasPrefix(datatype, "dateTime") {
+			return flux.TTime
+		}
+		return flux.TString
+	}
+}
+
+func keyValue(typ flux.ColType, v string) (values.Value, error) {
+	switch typ {
+	case flux.TBool:
+		return values.NewBool(v == "true"), nil
+	case flux.TInt:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return values.NewInt(n), nil
+	case flux.TUInt:
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return values.NewUInt(n), nil
+	case flux.TFloat:
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		return values.NewFloat(n), nil
+	case flux.TTime:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, err
+		}
+		return values.NewTime(values.ConvertTime(t)), nil
+	default:
+		return values.NewString(v), nil
+	}
+}
+
+// parseIntBytes parses a decimal integer without allocating; anything
+// unusual falls back to strconv.
+func parseIntBytes(b []byte) (int64, error) {
+	i := 0
+	neg := false
+	if len(b) > 0 && (b[0] == '-' || b[0] == '+') {
+		neg = b[0] == '-'
+		i = 1
+	}
+	if len(b)-i == 0 || len(b)-i > 18 {
+		return strconv.ParseInt(string(b), 10, 64)
+	}
+	var n int64
+	for ; i < len(b); i++ {
+		c := b[i] - '0'
+		if c > 9 {
+			return strconv.ParseInt(string(b), 10, 64)
+		}
+		n = n*10 + int64(c)
+	}
+	if neg {
+		n = -n
+	}
+	return n, nil
+}
+
+// parseTimeBytes parses an RFC3339 timestamp to Unix nanoseconds without
+// allocating; anything unusual falls back to time.Parse.
+func parseTimeBytes(b []byte) (int64, error) {
+	if len(b) < 20 || b[4] != '-' || b[7] != '-' || b[10] != 'T' || b[13] != ':' || b[16] != ':' {
+		return parseTimeSlow(b)
+	}
+	year, ok1 := atoi4(b[0:4])
+	month, ok2 := atoi2(b[5:7])
+	day, ok3 := atoi2(b[8:10])
+	hour, ok4 := atoi2(b[11:13])
+	min, ok5 := atoi2(b[14:16])
+	sec, ok6 := atoi2(b[17:19])
+	if !(ok1 && ok2 && ok3 && ok4 && ok5 && ok6) {
+		return parseTimeSlow(b)
+	}
+
+	i := 19
+	nsec := 0
+	if b[i] == '.' {
+		i++
+		start := i
+		for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+			nsec = nsec*10 + int(b[i]-'0')
+			i++
+		}
+		digits := i - start
+		if digits == 0 || digits > 9 {
+			return parseTimeSlow(b)
+		}
+		for ; digits < 9; digits++ {
+			nsec *= 10
+		}
+	}
+
+	offset := 0
+	switch {
+	case i == len(b)-1 && b[i] == 'Z':
+	case i == len(b)-6 && (b[i] == '+' || b[i] == '-') && b[i+3] == ':':
+		oh, ok1 := atoi2(b[i+1 : i+3])
+		om, ok2 := atoi2(b[i+4 : i+6])
+		if !(ok1 && ok2) {
+			return parseTimeSlow(b)
+		}
+		offset = oh*3600 + om*60
+		if b[i] == '-' {
+			offset = -offset
+		}
+	default:
+		return parseTimeSlow(b)
+	}
+
+	t := time.Date(year, time.Month(month), day, hour, min, sec, nsec, time.UTC)
+	return t.UnixNano() - int64(offset)*int64(time.Second), nil
+}
+
+func parseTimeSlow(b []byte) (int64, error) {
+	t, err := time.Parse(time.RFC3339Nano, string(b))
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixNano(), nil
+}
+
+func atoi2(b []byte) (int, bool) {
+	if b[0] < '0' || b[0] > '9' || b[1] < '0' || b[1] > '9' {
+		return 0, false
+	}
+	return int(b[0]-'0')*10 + int(b[1]-'0'), true
+}
+
+func atoi4(b []byte) (int, bool) {
+	hi, ok1 := atoi2(b[0:2])
+	lo, ok2 := atoi2(b[2:4])
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	return hi*100 + lo, true
+}
+
+// readRecord reads one CSV record into reused buffers, handling quoted
+// fields that contain commas, escaped quotes, and newlines. The returned
+// field slices are only valid until the next call. It returns io.EOF once
+// the input is exhausted.
+func (d *fastDecoder) readRecord() ([][]byte, error) {
+	chunk, err := d.br.ReadSlice('\n')
+	if err == nil && bytes.Count(chunk, quoteByte)%2 == 0 {
+		// The whole record fit in the buffer: slice it in place. The slice
+		// is only valid until the next read, which is fine because the
+		// record is fully consumed before then.
+		d.line = chunk
+		return d.splitFields()
+	}
+
+	d.line = append(d.line[:0:0], chunk...)
+	for {
+		if err == bufio.ErrBufferFull {
+			chunk, err = d.br.ReadSlice('\n')
+			d.line = append(d.line, chunk...)
+			continue
+		}
+		if err == io.EOF {
+			if len(d.line) == 0 {
+				return nil, io.EOF
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// A quoted field can contain the newline; keep reading until the
+		// quotes balance.
+		if bytes.Count(d.line, quoteByte)%2 == 0 {
+			break
+		}
+		chunk, err = d.br.ReadSlice('\n')
+		d.line = append(d.line, chunk...)
+	}
+	return d.splitFields()
+}
+
+var quoteByte = []byte{'"'}
+
+// splitFields slices the current record into fields; quoted fields are
+// unescaped into their own allocations, plain fields alias the record
+// buffer.
+func (d *fastDecoder) splitFields() ([][]byte, error) {
+	line := d.line
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+
+	d.fields = d.fields[:0]
+	for i := 0; ; {
+		if i < len(line) && line[i] == '"' {
+			var field []byte
+			i++
+			for {
+				if i >= len(line) {
+					return nil, fmt.Errorf("unterminated quoted field in annotated CSV")
+				}
+				c := line[i]
+				if c == '"' {
+					if i+1 < len(line) && line[i+1] == '"' {
+						field = append(field, '"')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				field = append(field, c)
+				i++
+			}
+			d.fields = append(d.fields, field)
+			if i >= len(line) {
+				return d.fields, nil
+			}
+			if line[i] != ',' {
+				return nil, fmt.Errorf("unexpected character after quoted field in annotated CSV")
+			}
+			i++
+			continue
+		}
+		j := bytes.IndexByte(line[i:], ',')
+		if j < 0 {
+			d.fields = append(d.fields, line[i:])
+			return d.fields, nil
+		}
+		d.fields = append(d.fields, line[i:i+j])
+		i += j + 1
+	}
+}
@@ -0,0 +1,206 @@
+package influx2http
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/flux"
+	fluxcsv "github.com/influxdata/flux/csv"
+)
+
+const annotatedCSVSample = `#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339,string,string,string,string,long
+#group,false,false,true,true,false,true,true,false,false,false
+#default,_result,,,,,,,,,
+,result,table,_start,_stop,_time,_measurement,trace_id,service_name,operation_name,duration
+,,0,2020-01-01T00:00:00Z,2020-01-02T00:00:00Z,2020-01-01T10:00:00.000000001Z,span,463ac35c9f6413ad48485a3953bb6124,frontend,HTTP GET /dispatch,1000
+,,0,2020-01-01T00:00:00Z,2020-01-02T00:00:00Z,2020-01-01T10:00:00.000000002Z,span,463ac35c9f6413ad48485a3953bb6124,driver,"quoted, ""operation""
+with a newline",2000
+,,1,2020-01-01T00:00:00Z,2020-01-02T00:00:00Z,2020-01-01T10:00:01Z,span,0a5a3953bb6124c9f6413ad48485463a,frontend,,3000
+`
+
+// drainResults flattens every result into comparable lines, so the two
+// decoders can be checked for equivalence.
+func drainResults(itr flux.ResultIterator) ([]string, error) {
+	var out []string
+	for itr.More() {
+		result := itr.Next()
+		out = append(out, "result: "+result.Name())
+		err := result.Tables().Do(func(table flux.Table) error {
+			out = append(out, "key: "+table.Key().String())
+			cols := table.Cols()
+			return table.Do(func(reader flux.ColReader) error {
+				for i := 0; i < reader.Len(); i++ {
+					row := make([]string, len(cols))
+					for j, c := range cols {
+						row[j] = c.Label + "=" + cellString(reader, i, j, c.Type)
+					}
+					out = append(out, strings.Join(row, ","))
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	itr.Release()
+	return out, itr.Err()
+}
+
+func cellString(reader flux.ColReader, i, j int, typ flux.ColType) string {
+	switch typ {
+	case flux.TBool:
+		if reader.Bools(j).IsNull(i) {
+			return "<nil>"
+		}
+		return strconv.FormatBool(reader.Bools(j).Value(i))
+	case flux.TInt:
+		if reader.Ints(j).IsNull(i) {
+			return "<nil>"
+		}
+		return strconv.FormatInt(reader.Ints(j).Value(i), 10)
+	case flux.TUInt:
+		if reader.UInts(j).IsNull(i) {
+			return "<nil>"
+		}
+		return strconv.FormatUint(reader.UInts(j).Value(i), 10)
+	case flux.TFloat:
+		if reader.Floats(j).IsNull(i) {
+			return "<nil>"
+		}
+		return strconv.FormatFloat(reader.Floats(j).Value(i), 'g', -1, 64)
+	case flux.TTime:
+		if reader.Times(j).IsNull(i) {
+			return "<nil>"
+		}
+		return strconv.FormatInt(reader.Times(j).Value(i), 10)
+	default:
+		if reader.Strings(j).IsNull(i) {
+			return "<nil>"
+		}
+		return reader.Strings(j).ValueString(i)
+	}
+}
+
+func TestFastCSVDecoderMatchesFluxDecoder(t *testing.T) {
+	fastItr, err := decodeFastCSV(strings.NewReader(annotatedCSVSample))
+	if err != nil {
+		t.Fatalf("fast decoder failed: %v", err)
+	}
+	got, err := drainResults(fastItr)
+	if err != nil {
+		t.Fatalf("failed to drain fast decoder results: %v", err)
+	}
+
+	fluxItr, err := fluxcsv.NewMultiResultDecoder(fluxcsv.ResultDecoderConfig{}).Decode(
+		&nopCloser{*strings.NewReader(annotatedCSVSample)})
+	if err != nil {
+		t.Fatalf("flux decoder failed: %v", err)
+	}
+	want, err := drainResults(fluxItr)
+	if err != nil {
+		t.Fatalf("failed to drain flux decoder results: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("decoders disagree on line count: fast %d, flux %d\nfast:\n%s\nflux:\n%s",
+			len(got), len(want), strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d differs:\nfast: %s\nflux: %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFastCSVDecoderErrorTable(t *testing.T) {
+	const errorCSV = `#datatype,string,string
+#group,true,true
+#default,,
+,error,reference
+,"unsupported aggregate column type int",897
+`
+	_, err := decodeFastCSV(strings.NewReader(errorCSV))
+	if err == nil {
+		t.Fatal("expected an error from the error table")
+	}
+	if !strings.Contains(err.Error(), "unsupported aggregate column type") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestFastCSVDecoderMissingDefaults(t *testing.T) {
+	// No #default annotation row: an empty cell must decode as a null
+	// rather than panic on the missing defaults entry.
+	const noDefaultsCSV = `#datatype,string,long,string,long
+#group,false,false,true,false
+,result,table,service_name,duration
+,_result,0,frontend,1000
+,_result,0,frontend,
+`
+	itr, err := decodeFastCSV(strings.NewReader(noDefaultsCSV))
+	if err != nil {
+		t.Fatalf("fast decoder failed: %v", err)
+	}
+	lines, err := drainResults(itr)
+	if err != nil {
+		t.Fatalf("failed to drain fast decoder results: %v", err)
+	}
+	last := lines[len(lines)-1]
+	if !strings.Contains(last, "duration=<nil>") {
+		t.Errorf("empty cell without a default did not decode as null: %s", last)
+	}
+}
+
+type nopCloser struct{ strings.Reader }
+
+func (nopCloser) Close() error { return nil }
+
+// benchmarkCSV fabricates a span-query-shaped response: many single-span
+// tables grouped by trace ID.
+func benchmarkCSV(tables, rowsPerTable int) string {
+	var sb strings.Builder
+	sb.WriteString("#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339,string,string,string,string,long\n")
+	sb.WriteString("#group,false,false,true,true,false,true,true,false,false,false\n")
+	sb.WriteString("#default,_result,,,,,,,,,\n")
+	sb.WriteString(",result,table,_start,_stop,_time,_measurement,trace_id,service_name,operation_name,duration\n")
+	for tableI := 0; tableI < tables; tableI++ {
+		for rowI := 0; rowI < rowsPerTable; rowI++ {
+			fmt.Fprintf(&sb, ",,%d,2020-01-01T00:00:00Z,2020-01-02T00:00:00Z,2020-01-01T10:00:%02d.%09dZ,span,%032x,service-%d,operation-%d,%d\n",
+				tableI, rowI%60, tableI, tableI, tableI%10, rowI%20, 1000+rowI)
+		}
+	}
+	return sb.String()
+}
+
+func BenchmarkFastCSVDecoder(b *testing.B) {
+	data := benchmarkCSV(500, 20)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		itr, err := decodeFastCSV(strings.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := drainResults(itr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFluxCSVDecoder(b *testing.B) {
+	data := benchmarkCSV(500, 20)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		itr, err := fluxcsv.NewMultiResultDecoder(fluxcsv.ResultDecoderConfig{}).Decode(&nopCloser{*strings.NewReader(data)})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := drainResults(itr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
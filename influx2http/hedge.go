@@ -0,0 +1,123 @@
+package influx2http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// defaultHedgeDelay is how long the primary endpoint gets to respond before
+// the hedge request is fired, when no delay is configured.
+const defaultHedgeDelay = 100 * time.Millisecond
+
+// hedgeResult carries one race leg's outcome.
+type hedgeResult struct {
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+// cancelBody cancels its leg's context when the response body is closed, so
+// the winning request's resources are released once decoding finishes.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// doHedged issues the request against the primary URL, fires a duplicate
+// against the hedge URL once HedgeDelay elapses without a response (or
+// immediately if the primary fails outright), and returns whichever response
+// arrives first, cancelling the losing leg. Each leg gets its own request
+// from newRequest, so the legs do not share a body reader or context.
+func (s *FluxQueryService) doHedged(ctx context.Context, hc *http.Client, newRequest func(ctx context.Context, u *url.URL) (*http.Request, error), primary, hedge *url.URL) (*http.Response, error) {
+	results := make(chan hedgeResult, 2)
+	issue := func(u *url.URL) {
+		legCtx, cancel := context.WithCancel(ctx)
+		req, err := newRequest(legCtx, u)
+		if err != nil {
+			results <- hedgeResult{err: err, cancel: cancel}
+			return
+		}
+		resp, err := hc.Do(req)
+		results <- hedgeResult{resp: resp, err: err, cancel: cancel}
+	}
+
+	go issue(primary)
+
+	delay := s.HedgeDelay
+	if delay <= 0 {
+		delay = defaultHedgeDelay
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	fireHedge := func() {
+		hedges := atomic.AddUint64(&s.hedges, 1)
+		if s.RetryLogger != nil {
+			s.RetryLogger.Warn("hedging flux query", "delay", delay, "hedges", hedges)
+		}
+		go issue(hedge)
+	}
+
+	outstanding := 1
+	hedged := false
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if !hedged {
+				hedged = true
+				outstanding++
+				fireHedge()
+			}
+		case result := <-results:
+			outstanding--
+			if result.err != nil {
+				result.cancel()
+				if firstErr == nil {
+					firstErr = result.err
+				}
+				if outstanding > 0 {
+					continue
+				}
+				if !hedged {
+					// The primary failed before the hedge fired; the replica
+					// is still worth trying right away.
+					hedged = true
+					outstanding++
+					fireHedge()
+					continue
+				}
+				return nil, firstErr
+			}
+
+			// First response wins; release the losing leg and tie this leg's
+			// context to the response body, which outlives this call.
+			if outstanding > 0 {
+				go drainHedgeLosers(results, outstanding)
+			}
+			result.resp.Body = &cancelBody{ReadCloser: result.resp.Body, cancel: result.cancel}
+			return result.resp, nil
+		}
+	}
+}
+
+// drainHedgeLosers cancels and cleans up the legs that lost the race.
+func drainHedgeLosers(results <-chan hedgeResult, outstanding int) {
+	for i := 0; i < outstanding; i++ {
+		result := <-results
+		result.cancel()
+		if result.resp != nil {
+			result.resp.Body.Close()
+		}
+	}
+}
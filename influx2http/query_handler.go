@@ -8,7 +8,10 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sync/atomic"
+	"time"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/influxdata/flux"
 	"github.com/influxdata/flux/csv"
 	"github.com/influxdata/flux/lang"
@@ -78,6 +81,68 @@ type FluxQueryService struct {
 	Addr               string
 	Token              string
 	InsecureSkipVerify bool
+
+	// MaxResponseBytes fails a query once more than this many response bytes
+	// have been read. The CSV decoder streams from the response body, so this
+	// bounds in-flight memory; zero means unlimited.
+	MaxResponseBytes int64
+
+	// MaxRetries retries transient failures (429 and 5xx responses) up to
+	// this many times with jittered exponential backoff, honoring the
+	// server's Retry-After header; zero disables retries. Each retried
+	// attempt is logged to RetryLogger when one is set.
+	MaxRetries  int
+	RetryLogger hclog.Logger
+
+	// FastDecoder decodes query responses with the hand-rolled annotated-CSV
+	// decoder instead of the Flux library decoder. Responses are buffered
+	// whole rather than streamed, so pair it with MaxResponseBytes.
+	FastDecoder bool
+
+	// HedgeAddr, when set, names a read replica that receives a duplicate of
+	// each query once the primary has gone HedgeDelay without responding.
+	// Whichever endpoint responds first wins and the other request is
+	// cancelled, trimming tail latency when one node stalls. Hedged attempts
+	// are logged to RetryLogger when one is set.
+	HedgeAddr  string
+	HedgeDelay time.Duration
+
+	retries uint64
+	hedges  uint64
+}
+
+// QueryRetries returns how many query attempts have been retried.
+func (s *FluxQueryService) QueryRetries() uint64 {
+	return atomic.LoadUint64(&s.retries)
+}
+
+// HedgedQueries returns how many hedge requests have been fired.
+func (s *FluxQueryService) HedgedQueries() uint64 {
+	return atomic.LoadUint64(&s.hedges)
+}
+
+// limitedBody caps the bytes read from a query response body so one runaway
+// query cannot exhaust plugin memory.
+type limitedBody struct {
+	rc        io.ReadCloser
+	limit     int64
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, fmt.Errorf("flux query response exceeded %d bytes", b.limit)
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.rc.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.rc.Close()
 }
 
 // Query runs a flux query against a influx server and decodes the result
@@ -93,6 +158,15 @@ func (s *FluxQueryService) Query(ctx context.Context, r *query.Request) (flux.Re
 	params.Set(OrgID, r.OrganizationID.String())
 	u.RawQuery = params.Encode()
 
+	var hedgeURL *url.URL
+	if s.HedgeAddr != "" {
+		hedgeURL, err = NewURL(s.HedgeAddr, fluxPath)
+		if err != nil {
+			return nil, tracing.LogError(span, err)
+		}
+		hedgeURL.RawQuery = params.Encode()
+	}
+
 	preq := &query.ProxyRequest{
 		Request: *r,
 		Dialect: csv.DefaultDialect(),
@@ -106,31 +180,83 @@ func (s *FluxQueryService) Query(ctx context.Context, r *query.Request) (flux.Re
 		return nil, tracing.LogError(span, err)
 	}
 
-	hreq, err := http.NewRequest("POST", u.String(), &body)
-	if err != nil {
-		return nil, tracing.LogError(span, err)
+	newRequest := func(ctx context.Context, queryURL *url.URL) (*http.Request, error) {
+		hreq, err := http.NewRequest("POST", queryURL.String(), bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+
+		SetToken(s.Token, hreq)
+
+		hreq.Header.Set("Content-Type", "application/json")
+		hreq.Header.Set("Accept", "text/csv")
+		hreq = hreq.WithContext(ctx)
+		tracing.InjectToHTTPRequest(span, hreq)
+		return hreq, nil
 	}
 
-	SetToken(s.Token, hreq)
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		hc := NewClient(u.Scheme, s.InsecureSkipVerify)
+		if hedgeURL != nil {
+			resp, err = s.doHedged(ctx, hc, newRequest, u, hedgeURL)
+		} else {
+			var hreq *http.Request
+			hreq, err = newRequest(ctx, u)
+			if err != nil {
+				return nil, tracing.LogError(span, err)
+			}
+			resp, err = hc.Do(hreq)
+		}
+		if err != nil {
+			return nil, tracing.LogError(span, err)
+		}
+		// Can't defer resp.Body.Close here because the CSV decoder depends on reading from resp.Body after this function returns.
 
-	hreq.Header.Set("Content-Type", "application/json")
-	hreq.Header.Set("Accept", "text/csv")
-	hreq = hreq.WithContext(ctx)
-	tracing.InjectToHTTPRequest(span, hreq)
+		if isRetryable(resp.StatusCode) && attempt < s.MaxRetries {
+			hint := responseRetryAfter(resp)
+			resp.Body.Close()
+			delay := retryDelay(attempt+1, hint)
+			retries := atomic.AddUint64(&s.retries, 1)
+			if s.RetryLogger != nil {
+				s.RetryLogger.Warn("retrying flux query",
+					"status", resp.StatusCode, "attempt", attempt+1, "delay", delay, "retries", retries)
+			}
+			select {
+			case <-ctx.Done():
+				return nil, tracing.LogError(span, ctx.Err())
+			case <-time.After(delay):
+			}
+			continue
+		}
 
-	hc := NewClient(u.Scheme, s.InsecureSkipVerify)
-	resp, err := hc.Do(hreq)
-	if err != nil {
-		return nil, tracing.LogError(span, err)
+		if err := CheckError(resp); err != nil {
+			return nil, tracing.LogError(span, err)
+		}
+		break
 	}
-	// Can't defer resp.Body.Close here because the CSV decoder depends on reading from resp.Body after this function returns.
 
-	if err := CheckError(resp); err != nil {
-		return nil, tracing.LogError(span, err)
+	rc := resp.Body
+	if s.MaxResponseBytes > 0 {
+		rc = &limitedBody{rc: rc, limit: s.MaxResponseBytes, remaining: s.MaxResponseBytes}
+	}
+
+	if s.FastDecoder {
+		// The fast decoder consumes the whole response up front, so the body
+		// can be closed here instead of by the iterator.
+		itr, err := decodeFastCSV(rc)
+		rc.Close()
+		if err != nil {
+			if err == io.EOF {
+				return nil, err
+			}
+			return nil, tracing.LogError(span, err)
+		}
+		return itr, nil
 	}
 
 	decoder := csv.NewMultiResultDecoder(csv.ResultDecoderConfig{})
-	itr, err := decoder.Decode(resp.Body)
+	itr, err := decoder.Decode(rc)
 	if err != nil {
 		return nil, tracing.LogError(span, err)
 	}
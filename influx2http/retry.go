@@ -0,0 +1,47 @@
+package influx2http
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	retryBaseDelay = 100 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+)
+
+// isRetryable reports whether an HTTP status is worth retrying: rate limits
+// and server-side failures, but not client errors.
+func isRetryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode/100 == 5
+}
+
+// responseRetryAfter parses the Retry-After header (delay-seconds form) of a
+// 429/503 response; zero when absent or unparseable.
+func responseRetryAfter(resp *http.Response) time.Duration {
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// retryDelay returns the jittered exponential backoff before retry attempt
+// (1-based), honoring a server-provided Retry-After hint when it is longer.
+func retryDelay(attempt int, retryAfter time.Duration) time.Duration {
+	delay := retryBaseDelay << uint(attempt-1)
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay)/2+1))
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
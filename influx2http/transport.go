@@ -34,7 +34,7 @@ var defaultTransport http.RoundTripper = &http.Transport{
 // $no_proxy) environment variables.
 // This is the same as http.DefaultTransport but with TLS skip verify.
 //
-var skipVerifyTransport = &http.Transport{
+var skipVerifyTransport http.RoundTripper = &http.Transport{
 	Proxy: http.ProxyFromEnvironment,
 	DialContext: (&net.Dialer{
 		Timeout:   30 * time.Second,
@@ -48,3 +48,59 @@ var skipVerifyTransport = &http.Transport{
 	// This is the value that changes between this and http.DefaultTransport
 	TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 }
+
+// TransportConfig tunes the shared HTTP transport used by every service in
+// this package (queries, writes, org/bucket lookups).
+type TransportConfig struct {
+	// DialTimeout bounds connection establishment. Zero keeps the default (30s).
+	DialTimeout time.Duration
+	// ConnRecycleInterval periodically closes idle connections so new requests
+	// re-dial and pick up DNS changes (e.g. InfluxDB failover behind a DNS
+	// name) without restarting the plugin. Zero disables recycling.
+	ConnRecycleInterval time.Duration
+}
+
+func newTransport(conf TransportConfig, insecureSkipVerify bool) *http.Transport {
+	dialTimeout := conf.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = 30 * time.Second
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+			DualStack: true,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if insecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return transport
+}
+
+// ConfigureTransport replaces the shared transports with tuned ones and, if
+// requested, starts a goroutine that recycles idle connections. Call once,
+// before any client is created.
+func ConfigureTransport(conf TransportConfig) {
+	transport := newTransport(conf, false)
+	insecureTransport := newTransport(conf, true)
+
+	defaultTransport = transport
+	skipVerifyTransport = insecureTransport
+
+	if conf.ConnRecycleInterval > 0 {
+		go func() {
+			for range time.Tick(conf.ConnRecycleInterval) {
+				transport.CloseIdleConnections()
+				insecureTransport.CloseIdleConnections()
+			}
+		}()
+	}
+}
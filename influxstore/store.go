@@ -0,0 +1,93 @@
+// Package influxstore is the embeddable library entry point: a Go service
+// can construct the store from a plain Config struct and use the Jaeger
+// storage interfaces directly, with no CLI flags, viper, or plugin gRPC
+// machinery involved.
+package influxstore
+
+import (
+	"context"
+	"io"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/influxdata/jaeger-influxdb/config"
+	"github.com/influxdata/jaeger-influxdb/storev1"
+	"github.com/influxdata/jaeger-influxdb/storev2"
+	"github.com/influxdata/jaeger-influxdb/storev3"
+	"github.com/jaegertracing/jaeger/plugin/storage/grpc/shared"
+	"github.com/jaegertracing/jaeger/storage/dependencystore"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/pkg/errors"
+)
+
+// Config configures an embedded store. The embedded Configuration carries
+// the same fields as the plugin's config file; a Database selects InfluxDB
+// v1, an Organization/Bucket/Token selects v2, a V3Database selects v3.
+type Config struct {
+	config.Configuration
+
+	// Logger receives the store's diagnostics. Optional; discarded when nil.
+	Logger hclog.Logger
+}
+
+var _ io.Closer = (*Store)(nil)
+
+// Store bundles the reader, writer and dependency reader of one configured
+// backend. Callers must Close it to flush buffered writes.
+type Store struct {
+	store      shared.StoragePlugin
+	closeStore func() error
+}
+
+// New connects to the configured InfluxDB and returns a ready Store.
+func New(ctx context.Context, conf Config) (*Store, error) {
+	logger := conf.Logger
+	if logger == nil {
+		logger = hclog.NewNullLogger()
+	}
+
+	var (
+		store      shared.StoragePlugin
+		closeStore func() error
+		err        error
+	)
+	if conf.V3Database != "" {
+		store, closeStore, err = storev3.NewStore(&conf.Configuration, logger)
+	} else if conf.Database != "" {
+		if err = storev1.Preflight(&conf.Configuration, logger); err != nil {
+			return nil, err
+		}
+		store, closeStore, err = storev1.NewStore(&conf.Configuration, logger)
+	} else if conf.Organization != "" && conf.Bucket != "" && conf.Token != "" {
+		if err = storev2.Preflight(ctx, &conf.Configuration, logger); err != nil {
+			return nil, err
+		}
+		store, closeStore, err = storev2.NewStore(&conf.Configuration, logger)
+	} else {
+		return nil, errors.New("for InfluxDB V1 set database and retention policy; for InfluxDB V2 set organization, bucket and token; for InfluxDB V3 set v3-database and token")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{store: store, closeStore: closeStore}, nil
+}
+
+// SpanReader returns the reader for traces, services and operations.
+func (s *Store) SpanReader() spanstore.Reader {
+	return s.store.SpanReader()
+}
+
+// SpanWriter returns the writer for spans.
+func (s *Store) SpanWriter() spanstore.Writer {
+	return s.store.SpanWriter()
+}
+
+// DependencyReader returns the reader for service dependency links.
+func (s *Store) DependencyReader() dependencystore.Reader {
+	return s.store.DependencyReader()
+}
+
+// Close flushes buffered writes and releases the store's resources.
+func (s *Store) Close() error {
+	return s.closeStore()
+}
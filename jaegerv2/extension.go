@@ -0,0 +1,77 @@
+package jaegerv2
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/influxdata/jaeger-influxdb/storev1"
+	"github.com/influxdata/jaeger-influxdb/storev2"
+	"github.com/jaegertracing/jaeger/plugin/storage/grpc/shared"
+	"github.com/jaegertracing/jaeger/storage/dependencystore"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/pkg/errors"
+)
+
+// Extension is the storage component: Start opens the store, Shutdown
+// closes it, and the accessors expose the Jaeger storage interfaces for
+// the query service and collector pipeline. The Start/Shutdown signatures
+// match the collector's component lifecycle.
+type Extension struct {
+	conf   *Config
+	logger hclog.Logger
+
+	store      shared.StoragePlugin
+	closeStore func() error
+}
+
+// Start opens the configured InfluxDB store. It dispatches on the config
+// the same way the legacy plugin binary does: a database selects InfluxDB
+// v1, an organization/bucket/token selects v2.
+func (e *Extension) Start(ctx context.Context) error {
+	if e.store != nil {
+		return errors.New("influxdb extension already started")
+	}
+
+	var err error
+	if e.conf.Database != "" {
+		if err = storev1.Preflight(&e.conf.Configuration, e.logger); err != nil {
+			return err
+		}
+		e.store, e.closeStore, err = storev1.NewStore(&e.conf.Configuration, e.logger)
+	} else {
+		if err = storev2.Preflight(ctx, &e.conf.Configuration, e.logger); err != nil {
+			return err
+		}
+		e.store, e.closeStore, err = storev2.NewStore(&e.conf.Configuration, e.logger)
+	}
+	return err
+}
+
+// Shutdown closes the store opened by Start.
+func (e *Extension) Shutdown(ctx context.Context) error {
+	if e.closeStore == nil {
+		return nil
+	}
+	return e.closeStore()
+}
+
+// SpanReader returns the store's span reader; valid after Start.
+func (e *Extension) SpanReader() spanstore.Reader {
+	return e.store.SpanReader()
+}
+
+// SpanWriter returns the store's span writer; valid after Start.
+func (e *Extension) SpanWriter() spanstore.Writer {
+	return e.store.SpanWriter()
+}
+
+// DependencyReader returns the store's dependency reader; valid after Start.
+func (e *Extension) DependencyReader() dependencystore.Reader {
+	return e.store.DependencyReader()
+}
+
+// TraceReader returns a streaming tracestore-style reader over the store's
+// span reader; valid after Start.
+func (e *Extension) TraceReader() *TraceReader {
+	return NewTraceReader(e.store.SpanReader())
+}
@@ -0,0 +1,80 @@
+// Package jaegerv2 adapts this store to the jaeger-v2 (OpenTelemetry
+// collector based) storage extension model. The factory, config and
+// component here mirror the collector's factory/config/lifecycle shapes
+// without importing collector packages, so a jaeger-v2 build can register
+// the backend with a few lines of glue instead of spawning the legacy
+// gRPC plugin binary.
+package jaegerv2
+
+import (
+	"github.com/hashicorp/go-hclog"
+	"github.com/influxdata/jaeger-influxdb/config"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// TypeStr is the backend name under which this store is declared in a
+// jaeger-v2 YAML config.
+const TypeStr = "influxdb"
+
+// Config is the YAML config schema of the extension: the same keys as the
+// legacy plugin config file, without the "influxdb." prefix.
+type Config struct {
+	config.Configuration `yaml:",inline"`
+}
+
+// Unmarshal populates the config from a decoded YAML map, as handed to the
+// extension by the collector's confmap machinery.
+func (c *Config) Unmarshal(conf map[string]interface{}) error {
+	v := viper.New()
+	prefixed := make(map[string]interface{}, len(conf))
+	for key, value := range conf {
+		prefixed["influxdb."+key] = value
+	}
+	if err := v.MergeConfigMap(prefixed); err != nil {
+		return errors.Wrap(err, "failed to read influxdb extension config")
+	}
+	c.InitFromViper(v)
+	return nil
+}
+
+// Validate reports config errors before the component starts, matching the
+// checks the legacy plugin performs at startup.
+func (c *Config) Validate() error {
+	if c.Database != "" {
+		return nil
+	}
+	if c.Organization != "" && c.Bucket != "" && c.Token != "" {
+		return nil
+	}
+	return errors.New("for InfluxDB V1 set database and retention policy; for InfluxDB V2 set organization, bucket and token")
+}
+
+// Factory creates the InfluxDB storage extension.
+type Factory struct {
+	logger hclog.Logger
+}
+
+// NewFactory returns a Factory for the InfluxDB storage extension.
+func NewFactory(logger hclog.Logger) *Factory {
+	return &Factory{logger: logger}
+}
+
+// Type returns the component type this factory creates.
+func (f *Factory) Type() string {
+	return TypeStr
+}
+
+// CreateDefaultConfig returns an empty config; all keys are optional until
+// Validate runs.
+func (f *Factory) CreateDefaultConfig() *Config {
+	return &Config{}
+}
+
+// CreateExtension returns an unstarted extension for the given config.
+func (f *Factory) CreateExtension(conf *Config) (*Extension, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return &Extension{conf: conf, logger: f.logger}, nil
+}
@@ -0,0 +1,162 @@
+package jaegerv2
+
+import (
+	"context"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/pkg/errors"
+)
+
+// defaultTraceChunkSize caps the spans in one yielded chunk, so one huge
+// trace does not arrive as a single allocation.
+const defaultTraceChunkSize = 100
+
+// GetTraceParams identifies one trace to fetch, optionally narrowed to the
+// time window the caller knows it lives in; it mirrors the jaeger-v2
+// tracestore parameter shape.
+type GetTraceParams struct {
+	TraceID model.TraceID
+	Start   time.Time
+	End     time.Time
+}
+
+// TraceReader adapts a spanstore.Reader to the jaeger-v2 tracestore reading
+// model: trace results stream to the caller as span chunks instead of
+// returning one fully assembled trace per call. As elsewhere in this
+// package the interface shape is mirrored rather than imported, so the glue
+// in a jaeger-v2 build only converts the span chunks to OTLP; iteration,
+// chunking and time hints are handled here.
+type TraceReader struct {
+	reader    spanstore.Reader
+	chunkSize int
+}
+
+// NewTraceReader returns a TraceReader streaming from the given reader.
+func NewTraceReader(reader spanstore.Reader) *TraceReader {
+	return &TraceReader{
+		reader:    reader,
+		chunkSize: defaultTraceChunkSize,
+	}
+}
+
+// SetChunkSize overrides the maximum spans per yielded chunk.
+func (t *TraceReader) SetChunkSize(n int) {
+	if n > 0 {
+		t.chunkSize = n
+	}
+}
+
+// errStopIteration signals that the consumer returned false from yield; it
+// never escapes this package.
+var errStopIteration = errors.New("iteration stopped")
+
+// spanStreamer is implemented by readers that can stream a trace's spans as
+// they decode, like the v2 reader's StreamSpans.
+type spanStreamer interface {
+	StreamSpans(ctx context.Context, traceID model.TraceID, fn func([]*model.Span) error) error
+}
+
+// timeHintedReader is implemented by readers whose trace lookup can be
+// narrowed to a known time window.
+type timeHintedReader interface {
+	GetTraceWithTimeHints(ctx context.Context, traceID model.TraceID, startTime, endTime time.Time) (*model.Trace, error)
+}
+
+// GetTraces streams the requested traces through yield as chunks of spans,
+// in the order requested. A trace that does not exist yields nothing rather
+// than an error; yield returning false stops the iteration.
+func (t *TraceReader) GetTraces(ctx context.Context, yield func([]*model.Span, error) bool, params ...GetTraceParams) {
+	for _, param := range params {
+		if streamer, ok := t.reader.(spanStreamer); ok {
+			err := streamer.StreamSpans(ctx, param.TraceID, func(spans []*model.Span) error {
+				if !t.yieldChunks(spans, yield) {
+					return errStopIteration
+				}
+				return nil
+			})
+			if err == errStopIteration {
+				return
+			}
+			if err != nil && err != spanstore.ErrTraceNotFound {
+				yield(nil, err)
+				return
+			}
+			continue
+		}
+
+		var trace *model.Trace
+		var err error
+		if hinted, ok := t.reader.(timeHintedReader); ok {
+			trace, err = hinted.GetTraceWithTimeHints(ctx, param.TraceID, param.Start, param.End)
+		} else {
+			trace, err = t.reader.GetTrace(ctx, param.TraceID)
+		}
+		if err == spanstore.ErrTraceNotFound {
+			continue
+		}
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		if !t.yieldChunks(trace.Spans, yield) {
+			return
+		}
+	}
+}
+
+// FindTraces streams matching traces through yield as chunks of spans; each
+// trace's spans arrive contiguously. yield returning false stops the
+// iteration.
+func (t *TraceReader) FindTraces(ctx context.Context, yield func([]*model.Span, error) bool, query *spanstore.TraceQueryParameters) {
+	traces, err := t.reader.FindTraces(ctx, query)
+	if err != nil {
+		yield(nil, err)
+		return
+	}
+	for _, trace := range traces {
+		if !t.yieldChunks(trace.Spans, yield) {
+			return
+		}
+	}
+}
+
+// FindTraceIDs streams the IDs of matching traces through yield. yield
+// returning false stops the iteration.
+func (t *TraceReader) FindTraceIDs(ctx context.Context, yield func([]model.TraceID, error) bool, query *spanstore.TraceQueryParameters) {
+	traceIDs, err := t.reader.FindTraceIDs(ctx, query)
+	if err != nil {
+		yield(nil, err)
+		return
+	}
+	if len(traceIDs) > 0 {
+		yield(traceIDs, nil)
+	}
+}
+
+// GetServices returns all services traced by Jaeger.
+func (t *TraceReader) GetServices(ctx context.Context) ([]string, error) {
+	return t.reader.GetServices(ctx)
+}
+
+// GetOperations returns all operations for a service.
+func (t *TraceReader) GetOperations(ctx context.Context, param spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	return t.reader.GetOperations(ctx, param)
+}
+
+// yieldChunks passes spans to yield in chunks of at most chunkSize,
+// reporting whether iteration should continue.
+func (t *TraceReader) yieldChunks(spans []*model.Span, yield func([]*model.Span, error) bool) bool {
+	for len(spans) > 0 {
+		chunk := spans
+		if len(chunk) > t.chunkSize {
+			chunk = chunk[:t.chunkSize]
+		}
+		spans = spans[len(chunk):]
+		if !yield(chunk, nil) {
+			return false
+		}
+	}
+	return true
+}
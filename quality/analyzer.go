@@ -0,0 +1,198 @@
+package quality
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/jaeger-influxdb/common"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+// tracesPerServicePerRun bounds the sample size of one analysis pass.
+const tracesPerServicePerRun = 50
+
+// PointWriter accepts arbitrary points for the quality measurement.
+type PointWriter interface {
+	WritePoint(point models.Point)
+}
+
+// ServiceScore summarizes the trace quality issues found for one service
+// during one analysis pass.
+type ServiceScore struct {
+	Service            string
+	TracesSampled      int
+	Spans              int
+	MissingParentSpans int
+	ClockSkewSpans     int
+	MaxClockSkew       time.Duration
+	// Score is 1.0 for issue-free traces, decreasing toward 0.0 with the
+	// fraction of spans exhibiting an issue.
+	Score float64
+}
+
+// Analyzer periodically samples recent traces per service, scores their
+// quality (missing parent spans, clock skew), writes the scores to a
+// measurement, and retains the latest scores for querying.
+type Analyzer struct {
+	reader      spanstore.Reader
+	writer      PointWriter
+	measurement string
+	interval    time.Duration
+
+	mu     sync.RWMutex
+	latest map[string]ServiceScore
+
+	stop   chan struct{}
+	stopWG sync.WaitGroup
+
+	logger hclog.Logger
+}
+
+// NewAnalyzer returns a started Analyzer that runs one analysis pass every
+// interval. Call Close to stop it.
+func NewAnalyzer(reader spanstore.Reader, writer PointWriter, measurement string, interval time.Duration, logger hclog.Logger) *Analyzer {
+	a := &Analyzer{
+		reader:      reader,
+		writer:      writer,
+		measurement: measurement,
+		interval:    interval,
+		latest:      make(map[string]ServiceScore),
+		stop:        make(chan struct{}),
+		logger:      logger,
+	}
+
+	a.stopWG.Add(1)
+	go a.run()
+
+	return a
+}
+
+// Close triggers a graceful shutdown
+func (a *Analyzer) Close() error {
+	close(a.stop)
+	a.stopWG.Wait()
+	return nil
+}
+
+// LatestScores returns the scores from the most recent analysis pass.
+func (a *Analyzer) LatestScores() []ServiceScore {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	scores := make([]ServiceScore, 0, len(a.latest))
+	for _, score := range a.latest {
+		scores = append(scores, score)
+	}
+	return scores
+}
+
+func (a *Analyzer) run() {
+	defer a.stopWG.Done()
+
+	t := time.NewTicker(a.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-t.C:
+			if err := a.analyze(context.Background()); err != nil {
+				a.logger.Warn("trace quality analysis failed", "error", err)
+			}
+		}
+	}
+}
+
+func (a *Analyzer) analyze(ctx context.Context) error {
+	services, err := a.reader.GetServices(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, service := range services {
+		traces, err := a.reader.FindTraces(ctx, &spanstore.TraceQueryParameters{
+			ServiceName:  service,
+			StartTimeMin: now.Add(-a.interval),
+			StartTimeMax: now,
+			NumTraces:    tracesPerServicePerRun,
+		})
+		if err != nil {
+			a.logger.Warn("failed to sample traces for quality analysis", "service", service, "error", err)
+			continue
+		}
+
+		score := ServiceScore{Service: service}
+		for _, trace := range traces {
+			scoreTrace(trace, &score)
+		}
+		if score.Spans > 0 {
+			score.Score = 1.0 - float64(score.MissingParentSpans+score.ClockSkewSpans)/float64(score.Spans)
+		}
+
+		a.mu.Lock()
+		a.latest[service] = score
+		a.mu.Unlock()
+
+		a.writeScore(score, now)
+	}
+
+	return nil
+}
+
+// scoreTrace accumulates quality issues of one trace into score.
+func scoreTrace(trace *model.Trace, score *ServiceScore) {
+	score.TracesSampled++
+
+	spansByID := make(map[model.SpanID]*model.Span, len(trace.Spans))
+	for _, span := range trace.Spans {
+		spansByID[span.SpanID] = span
+	}
+
+	for _, span := range trace.Spans {
+		score.Spans++
+
+		parentSpanID := span.ParentSpanID()
+		if parentSpanID == 0 {
+			continue
+		}
+		parent, found := spansByID[parentSpanID]
+		if !found {
+			score.MissingParentSpans++
+			continue
+		}
+		if span.StartTime.Before(parent.StartTime) {
+			score.ClockSkewSpans++
+			if skew := parent.StartTime.Sub(span.StartTime); skew > score.MaxClockSkew {
+				score.MaxClockSkew = skew
+			}
+		}
+	}
+}
+
+func (a *Analyzer) writeScore(score ServiceScore, t time.Time) {
+	tags := models.NewTags(map[string]string{
+		common.ServiceNameKey: score.Service,
+	})
+	fields := models.Fields{
+		"traces_sampled":       int64(score.TracesSampled),
+		"spans":                int64(score.Spans),
+		"missing_parent_spans": int64(score.MissingParentSpans),
+		"clock_skew_spans":     int64(score.ClockSkewSpans),
+		"max_clock_skew_ns":    score.MaxClockSkew.Nanoseconds(),
+		"score":                score.Score,
+	}
+
+	point, err := models.NewPoint(a.measurement, tags, fields, t)
+	if err != nil {
+		a.logger.Warn("failed to create trace quality point", "error", err)
+		return
+	}
+
+	a.writer.WritePoint(point)
+}
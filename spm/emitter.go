@@ -0,0 +1,161 @@
+package spm
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/jaeger-influxdb/common"
+	"github.com/influxdata/jaeger-influxdb/dbmodel"
+	"github.com/jaegertracing/jaeger/model"
+)
+
+// PointWriter accepts arbitrary points for the metrics measurement.
+type PointWriter interface {
+	WritePoint(point models.Point)
+}
+
+// seriesKey identifies one RED metrics series.
+type seriesKey struct {
+	service   string
+	operation string
+}
+
+// seriesWindow accumulates one series' spans over the current window, along
+// with the exemplar trace IDs that make the resulting metrics explorable.
+type seriesWindow struct {
+	count       int64
+	errorCount  int64
+	durationSum time.Duration
+	durationMax time.Duration
+
+	// maxLatencyTraceID is the trace holding the slowest span of the window;
+	// errorTraceID holds the first failed span. Grafana and Jaeger Monitor
+	// use these to jump from a latency spike or error-rate blip straight to
+	// a representative trace.
+	maxLatencyTraceID model.TraceID
+	errorTraceID      model.TraceID
+}
+
+// Emitter aggregates spans observed on the write path into per-service,
+// per-operation RED metrics (request count, error count, duration), flushed
+// as one point per series per window. Aggregation happens in process, so no
+// additional queries hit InfluxDB.
+type Emitter struct {
+	writer      PointWriter
+	measurement string
+	interval    time.Duration
+
+	mu     sync.Mutex
+	series map[seriesKey]*seriesWindow
+
+	stop   chan struct{}
+	stopWG sync.WaitGroup
+
+	logger hclog.Logger
+}
+
+// NewEmitter returns a started Emitter that flushes one metrics point per
+// active series every interval. Call Close to stop it.
+func NewEmitter(writer PointWriter, measurement string, interval time.Duration, logger hclog.Logger) *Emitter {
+	e := &Emitter{
+		writer:      writer,
+		measurement: measurement,
+		interval:    interval,
+		series:      make(map[seriesKey]*seriesWindow),
+		stop:        make(chan struct{}),
+		logger:      logger,
+	}
+
+	e.stopWG.Add(1)
+	go e.run()
+
+	return e
+}
+
+// Close flushes the current window and triggers a graceful shutdown.
+func (e *Emitter) Close() error {
+	close(e.stop)
+	e.stopWG.Wait()
+	e.flush(time.Now())
+	return nil
+}
+
+// Observe accumulates one span into the current window.
+func (e *Emitter) Observe(span *model.Span) {
+	key := seriesKey{service: span.Process.ServiceName, operation: span.OperationName}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	window, found := e.series[key]
+	if !found {
+		window = &seriesWindow{}
+		e.series[key] = window
+	}
+
+	window.count++
+	window.durationSum += span.Duration
+	if span.Duration > window.durationMax {
+		window.durationMax = span.Duration
+		window.maxLatencyTraceID = span.TraceID
+	}
+	if dbmodel.IsErrorSpan(span) {
+		window.errorCount++
+		if window.errorTraceID == (model.TraceID{}) {
+			window.errorTraceID = span.TraceID
+		}
+	}
+}
+
+func (e *Emitter) run() {
+	defer e.stopWG.Done()
+
+	t := time.NewTicker(e.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case now := <-t.C:
+			e.flush(now)
+		}
+	}
+}
+
+// flush writes one point per active series and resets the window.
+func (e *Emitter) flush(now time.Time) {
+	e.mu.Lock()
+	series := e.series
+	e.series = make(map[seriesKey]*seriesWindow)
+	e.mu.Unlock()
+
+	for key, window := range series {
+		tags := models.NewTags(map[string]string{
+			common.ServiceNameKey:   key.service,
+			common.OperationNameKey: key.operation,
+		})
+		fields := models.Fields{
+			"count":           window.count,
+			"error_count":     window.errorCount,
+			"duration_sum_ns": window.durationSum.Nanoseconds(),
+			"duration_max_ns": window.durationMax.Nanoseconds(),
+		}
+		if window.maxLatencyTraceID != (model.TraceID{}) {
+			fields["exemplar_trace_id"] = window.maxLatencyTraceID.String()
+		}
+		if window.errorTraceID != (model.TraceID{}) {
+			fields["error_exemplar_trace_id"] = window.errorTraceID.String()
+		}
+
+		point, err := models.NewPoint(e.measurement, tags, fields, now)
+		if err != nil {
+			e.logger.Warn("failed to create span metrics point", "error", err)
+			continue
+		}
+
+		e.writer.WritePoint(point)
+	}
+}
@@ -0,0 +1,233 @@
+package spm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/influxdata/flux"
+	"github.com/influxdata/jaeger-influxdb/dbmodel"
+)
+
+// Metrics source names, as accepted by the span-metrics-source option.
+const (
+	// SourceSpans serves metrics from the span-derived aggregates the
+	// Emitter writes.
+	SourceSpans = "spans"
+	// SourceOtel serves metrics from the calls and duration measurements
+	// written by the influxdb-observability OTel metrics exporter, for
+	// users who already collect RED metrics in InfluxDB.
+	SourceOtel = "otel"
+)
+
+// FluxQuerier executes one Flux query; storev2.Reader satisfies it.
+type FluxQuerier interface {
+	QueryFlux(ctx context.Context, fluxQuery string) (flux.ResultIterator, error)
+}
+
+// MetricPoint is one timestamped value of a RED metric series.
+type MetricPoint struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// Reader serves the RED metrics behind the Jaeger Monitor tab, either from
+// the span-derived metrics measurement or from otel2influx metrics.
+type Reader struct {
+	querier     FluxQuerier
+	bucket      string
+	measurement string
+	otelSource  bool
+
+	logger hclog.Logger
+}
+
+// NewReader returns a metrics reader sourcing from the span-derived metrics
+// measurement; call SetOtelMetricsSource to source from otel2influx metrics
+// instead.
+func NewReader(querier FluxQuerier, bucket, measurement string, logger hclog.Logger) *Reader {
+	return &Reader{
+		querier:     querier,
+		bucket:      bucket,
+		measurement: measurement,
+		logger:      logger,
+	}
+}
+
+// SetOtelMetricsSource switches the reader to the calls and duration
+// measurements written by the influxdb-observability metrics exporter.
+func (r *Reader) SetOtelMetricsSource() {
+	r.otelSource = true
+}
+
+// Span-derived queries read the windowed sums the Emitter writes.
+const (
+	queryCallRateFlux = `
+from(bucket: "%s")
+ |> range(start: %s, stop: %s)
+ |> filter(fn: (r) => r._measurement == "%s" and r._field == "count" and r.service_name == "%s")
+ |> group()
+ |> aggregateWindow(every: %s, fn: sum, createEmpty: false)
+ |> map(fn: (r) => ({_time: r._time, _value: float(v: r._value) / %f}))
+`
+
+	queryErrorRateFlux = `
+from(bucket: "%s")
+ |> range(start: %s, stop: %s)
+ |> filter(fn: (r) => r._measurement == "%s" and (r._field == "count" or r._field == "error_count") and r.service_name == "%s")
+ |> group(columns: ["_field"])
+ |> aggregateWindow(every: %s, fn: sum, createEmpty: false)
+ |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")
+ |> map(fn: (r) => ({_time: r._time, _value: float(v: r.error_count) / float(v: r.count)}))
+ |> group()
+`
+
+	// The span-derived measurement stores sums, not histograms, so latency
+	// is served as the windowed mean regardless of the requested quantile.
+	queryLatencyFlux = `
+from(bucket: "%s")
+ |> range(start: %s, stop: %s)
+ |> filter(fn: (r) => r._measurement == "%s" and (r._field == "count" or r._field == "duration_sum_ns") and r.service_name == "%s")
+ |> group(columns: ["_field"])
+ |> aggregateWindow(every: %s, fn: sum, createEmpty: false)
+ |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")
+ |> map(fn: (r) => ({_time: r._time, _value: float(v: r.duration_sum_ns) / float(v: r.count) / 1000000.0}))
+ |> group()
+`
+)
+
+// otel2influx queries read the Prometheus-style calls counter and duration
+// histogram, keyed by the OTel service.name tag.
+const (
+	queryOtelCallRateFlux = `
+from(bucket: "%s")
+ |> range(start: %s, stop: %s)
+ |> filter(fn: (r) => r._measurement == "calls" and r._field == "count" and r["service.name"] == "%s")
+ |> derivative(unit: 1s, nonNegative: true)
+ |> group()
+ |> aggregateWindow(every: %s, fn: mean, createEmpty: false)
+`
+
+	queryOtelErrorRateFlux = `
+data = from(bucket: "%s")
+ |> range(start: %s, stop: %s)
+ |> filter(fn: (r) => r._measurement == "calls" and r._field == "count" and r["service.name"] == "%s")
+ |> derivative(unit: 1s, nonNegative: true)
+all = data
+ |> group()
+ |> aggregateWindow(every: %s, fn: sum, createEmpty: false)
+errors = data
+ |> filter(fn: (r) => r["status.code"] == "STATUS_CODE_ERROR")
+ |> group()
+ |> aggregateWindow(every: %s, fn: sum, createEmpty: false)
+join(tables: {all: all, errors: errors}, on: ["_time"])
+ |> map(fn: (r) => ({_time: r._time, _value: r._value_errors / r._value_all}))
+ |> group()
+`
+
+	queryOtelLatencyFlux = `
+from(bucket: "%s")
+ |> range(start: %s, stop: %s)
+ |> filter(fn: (r) => r._measurement == "duration" and r._field == "count" and r["service.name"] == "%s")
+ |> group(columns: ["le"])
+ |> aggregateWindow(every: %s, fn: sum, createEmpty: false)
+ |> group(columns: ["_time"])
+ |> histogramQuantile(quantile: %f, countColumn: "_value", upperBoundColumn: "le")
+ |> group()
+`
+)
+
+// GetCallRates returns the request rate (calls per second) for a service.
+func (r *Reader) GetCallRates(ctx context.Context, service string, endTs time.Time, lookback, step time.Duration) ([]MetricPoint, error) {
+	r.logger.Debug("GetCallRates called")
+
+	start, stop := timeRange(endTs, lookback)
+	var q string
+	if r.otelSource {
+		q = fmt.Sprintf(queryOtelCallRateFlux, r.bucket, start, stop, dbmodel.EscapeFluxString(service), step.String())
+	} else {
+		q = fmt.Sprintf(queryCallRateFlux, r.bucket, start, stop, r.measurement, dbmodel.EscapeFluxString(service), step.String(), step.Seconds())
+	}
+
+	return r.metricPoints(ctx, q)
+}
+
+// GetErrorRates returns the fraction of failed requests for a service.
+func (r *Reader) GetErrorRates(ctx context.Context, service string, endTs time.Time, lookback, step time.Duration) ([]MetricPoint, error) {
+	r.logger.Debug("GetErrorRates called")
+
+	start, stop := timeRange(endTs, lookback)
+	var q string
+	if r.otelSource {
+		q = fmt.Sprintf(queryOtelErrorRateFlux, r.bucket, start, stop, dbmodel.EscapeFluxString(service), step.String(), step.String())
+	} else {
+		q = fmt.Sprintf(queryErrorRateFlux, r.bucket, start, stop, r.measurement, dbmodel.EscapeFluxString(service), step.String())
+	}
+
+	return r.metricPoints(ctx, q)
+}
+
+// GetLatencies returns request latency in milliseconds for a service. With
+// the otel source the requested quantile is computed from the duration
+// histogram; the span-derived source stores only sums, so the windowed mean
+// is returned instead.
+func (r *Reader) GetLatencies(ctx context.Context, service string, quantile float64, endTs time.Time, lookback, step time.Duration) ([]MetricPoint, error) {
+	r.logger.Debug("GetLatencies called")
+
+	start, stop := timeRange(endTs, lookback)
+	var q string
+	if r.otelSource {
+		q = fmt.Sprintf(queryOtelLatencyFlux, r.bucket, start, stop, dbmodel.EscapeFluxString(service), step.String(), quantile)
+	} else {
+		q = fmt.Sprintf(queryLatencyFlux, r.bucket, start, stop, r.measurement, dbmodel.EscapeFluxString(service), step.String())
+	}
+
+	return r.metricPoints(ctx, q)
+}
+
+// metricPoints runs one Flux query and decodes _time/_value rows.
+func (r *Reader) metricPoints(ctx context.Context, fluxQuery string) ([]MetricPoint, error) {
+	resultIterator, err := r.querier.QueryFlux(ctx, fluxQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []MetricPoint
+	for resultIterator.More() {
+		err = resultIterator.Next().Tables().Do(func(table flux.Table) error {
+			return table.Do(func(reader flux.ColReader) error {
+				timeColI, valueColI := -1, -1
+				for i, col := range reader.Cols() {
+					switch col.Label {
+					case "_time":
+						timeColI = i
+					case "_value":
+						valueColI = i
+					}
+				}
+				if timeColI < 0 || valueColI < 0 {
+					return nil
+				}
+				for rowI := 0; rowI < reader.Len(); rowI++ {
+					points = append(points, MetricPoint{
+						Timestamp: time.Unix(0, int64(reader.Times(timeColI).Value(rowI))),
+						Value:     reader.Floats(valueColI).Value(rowI),
+					})
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return points, nil
+}
+
+// timeRange formats a lookback window as Flux range bounds.
+func timeRange(endTs time.Time, lookback time.Duration) (start, stop string) {
+	return endTs.Add(-1 * lookback).UTC().Format(time.RFC3339Nano),
+		endTs.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,98 @@
+package storev1
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/influxdata/influxdb1-client"
+	"github.com/influxdata/influxdb1-client/models"
+	"github.com/influxdata/jaeger-influxdb/config"
+	"github.com/pkg/errors"
+)
+
+// preflightScratchMeasurement receives the preflight sample write; it is
+// separate from the span measurements so a misbehaving check never pollutes
+// trace data.
+const preflightScratchMeasurement = "jaeger-influxdb-preflight"
+
+// Preflight runs startup diagnostics against InfluxDB v1.x: ping, auth
+// check, database lookup, a sample query and a sample write to a scratch
+// measurement. Each check logs pass or fail with a remediation hint; an error
+// is returned if any check fails. Most support issues are misconfiguration
+// that this catches instantly.
+func Preflight(conf *config.Configuration, logger hclog.Logger) error {
+	u, err := url.ParseRequestURI(conf.Host)
+	if err != nil {
+		return errors.Wrap(err, "invalid influxdb.host")
+	}
+	influxClient, err := client.NewClient(client.Config{
+		URL:       *u,
+		Username:  conf.Username,
+		Password:  conf.Password,
+		Timeout:   5 * time.Second,
+		UnsafeSsl: conf.UnsafeSsl,
+	})
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+
+	check := func(name, hint string, run func() error) {
+		if err := run(); err != nil {
+			failed++
+			logger.Error("preflight check failed", "check", name, "error", err, "hint", hint)
+			return
+		}
+		logger.Warn("preflight check passed", "check", name)
+	}
+
+	check("ping", "verify influxdb.host is reachable from this process", func() error {
+		_, _, err := influxClient.Ping()
+		return err
+	})
+
+	check("database", "verify influxdb.database exists and the credentials can read it", func() error {
+		response, err := influxClient.Query(client.Query{
+			Command:  fmt.Sprintf("SHOW RETENTION POLICIES ON %q", conf.Database),
+			Database: conf.Database,
+		})
+		if err != nil {
+			return err
+		}
+		return response.Error()
+	})
+
+	check("query", "verify influxdb.username and influxdb.password have query permission", func() error {
+		response, err := influxClient.Query(client.Query{
+			Command:  "SHOW MEASUREMENTS LIMIT 1",
+			Database: conf.Database,
+		})
+		if err != nil {
+			return err
+		}
+		return response.Error()
+	})
+
+	check("write", "verify the credentials have write permission for the database", func() error {
+		point, err := models.NewPoint(preflightScratchMeasurement, nil, models.Fields{"v": true}, time.Now())
+		if err != nil {
+			return err
+		}
+		response, err := influxClient.WriteLineProtocol(point.String(), conf.Database, conf.RetentionPolicy, "ns", "any")
+		if err != nil {
+			return err
+		}
+		if response != nil && response.Err != nil {
+			return response.Err
+		}
+		return nil
+	})
+
+	if failed > 0 {
+		return errors.Errorf("%d preflight check(s) failed", failed)
+	}
+	return nil
+}
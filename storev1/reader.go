@@ -25,10 +25,38 @@ type Reader struct {
 	spanMetaMeasurement string
 	logMeasurement      string
 	defaultLookback     time.Duration
+	adjusters           []dbmodel.Adjuster
+	regexTags           bool
+	logQueries          bool
+	timeouts            common.QueryTimeouts
 
 	logger hclog.Logger
 }
 
+// SetAdjusters configures the post-processing pipeline applied to every
+// trace returned by GetTrace and FindTraces.
+func (r *Reader) SetAdjusters(adjusters []dbmodel.Adjuster) {
+	r.adjusters = adjusters
+}
+
+// SetRegexTags interprets query tag values of the form ~/pattern/ as regular
+// expressions in trace searches.
+func (r *Reader) SetRegexTags() {
+	r.regexTags = true
+}
+
+// SetLogQueries includes the full generated query text in the debug-level
+// query log; off by default because query text can contain tag values.
+func (r *Reader) SetLogQueries() {
+	r.logQueries = true
+}
+
+// SetQueryTimeouts bounds each reader operation with its own context
+// deadline; zero durations leave the corresponding operation unbounded.
+func (r *Reader) SetQueryTimeouts(timeouts common.QueryTimeouts) {
+	r.timeouts = timeouts
+}
+
 // NewReader returns a new SpanReader for InfluxDB v1.x.
 func NewReader(client *client.Client, database, retentionPolicy, spanMeasurement, spanMetaMeasurement, logMeasurement string, defaultLookback time.Duration, logger hclog.Logger) *Reader {
 	return &Reader{
@@ -44,7 +72,11 @@ func NewReader(client *client.Client, database, retentionPolicy, spanMeasurement
 }
 
 func (r *Reader) query(ctx context.Context, influxQLQuery string) (*client.Response, error) {
-	r.logger.Warn(influxQLQuery)
+	if r.logQueries {
+		r.logger.Debug("executing influxql query", "database", r.database, "query", influxQLQuery)
+	} else {
+		r.logger.Debug("executing influxql query", "database", r.database)
+	}
 	q := client.Query{
 		Command:         influxQLQuery,
 		Database:        r.database,
@@ -66,6 +98,9 @@ var queryGetServicesInfluxQL = fmt.Sprintf(`SHOW TAG VALUES FROM "%%s" WITH KEY
 
 // GetServices returns all services traced by Jaeger
 func (r *Reader) GetServices(ctx context.Context) ([]string, error) {
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.GetServices)
+	defer cancel()
+
 	response, err := r.query(ctx, fmt.Sprintf(queryGetServicesInfluxQL, r.spanMetaMeasurement))
 	if err != nil {
 		return nil, err
@@ -97,7 +132,12 @@ var queryGetOperationsInfluxQL = fmt.Sprintf(`SHOW TAG VALUES FROM "%%s" WITH KE
 
 // GetOperations returns all operations for a specific service traced by Jaeger
 func (r *Reader) GetOperations(ctx context.Context, param spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
-	response, err := r.query(ctx, fmt.Sprintf(queryGetOperationsInfluxQL, r.spanMetaMeasurement, param.ServiceName))
+	response, err := r.query(ctx, fmt.Sprintf(queryGetOperationsInfluxQL, r.spanMetaMeasurement, dbmodel.EscapeInfluxQLString(param.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	kinds, err := r.operationKinds(ctx, param.ServiceName)
 	if err != nil {
 		return nil, err
 	}
@@ -116,10 +156,25 @@ func (r *Reader) GetOperations(ctx context.Context, param spanstore.OperationQue
 				}
 			}
 			for _, v := range row.Values {
-				operations = append(operations, spanstore.Operation{
-					Name:     v[valueColI].(string),
-					SpanKind: param.SpanKind,
-				})
+				operation := v[valueColI].(string)
+				operationKinds := kinds[operation]
+				if len(operationKinds) == 0 {
+					// Spans written before kinds were recorded; only visible
+					// when the caller does not filter by kind.
+					if param.SpanKind == "" {
+						operations = append(operations, spanstore.Operation{Name: operation})
+					}
+					continue
+				}
+				for _, kind := range operationKinds {
+					if param.SpanKind != "" && kind != param.SpanKind {
+						continue
+					}
+					operations = append(operations, spanstore.Operation{
+						Name:     operation,
+						SpanKind: kind,
+					})
+				}
 			}
 		}
 	}
@@ -127,8 +182,41 @@ func (r *Reader) GetOperations(ctx context.Context, param spanstore.OperationQue
 	return operations, nil
 }
 
+var queryOperationKindsInfluxQL = fmt.Sprintf(`SELECT LAST("v") FROM "%%s" WHERE "%s" = '%%s' GROUP BY "%s", "%s"`,
+	common.ServiceNameKey, common.OperationNameKey, common.SpanKindTagKey)
+
+// operationKinds returns the span kinds recorded for each of a service's
+// operations. Operations written before the span_kind meta tag existed are
+// absent from the result.
+func (r *Reader) operationKinds(ctx context.Context, service string) (map[string][]string, error) {
+	response, err := r.query(ctx, fmt.Sprintf(queryOperationKindsInfluxQL, r.spanMetaMeasurement, dbmodel.EscapeInfluxQLString(service)))
+	if err != nil {
+		return nil, err
+	}
+
+	kinds := make(map[string][]string)
+	for _, result := range response.Results {
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		for _, row := range result.Series {
+			operation := row.Tags[common.OperationNameKey]
+			kind := row.Tags[common.SpanKindTagKey]
+			if operation == "" || kind == "" {
+				continue
+			}
+			kinds[operation] = append(kinds[operation], kind)
+		}
+	}
+
+	return kinds, nil
+}
+
 // FindTraces retrieve traces that match the traceQuery
 func (r *Reader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.FindTraces)
+	defer cancel()
+
 	traceIDs, err := r.FindTraceIDs(ctx, query)
 	if err != nil {
 		return nil, err
@@ -173,12 +261,22 @@ func (r *Reader) FindTraces(ctx context.Context, query *spanstore.TraceQueryPara
 		return nil, err
 	}
 
+	for _, trace := range traces {
+		dbmodel.ComputeTraceStatistics(trace)
+		for _, adjust := range r.adjusters {
+			adjust(trace)
+		}
+	}
+
 	return traces, nil
 }
 
 // GetTrace takes a traceID and returns a Trace associated with that traceID
 func (r *Reader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
-	r.logger.Warn("GetTrace called")
+	r.logger.Debug("GetTrace called")
+
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.GetTrace)
+	defer cancel()
 
 	response, err := r.query(ctx, dbmodel.NewInfluxQLTraceQuery(r.spanMeasurement).BuildTraceQuery([]model.TraceID{traceID}))
 	if err != nil {
@@ -193,7 +291,10 @@ func (r *Reader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Tr
 		return nil, spanstore.ErrTraceNotFound
 	}
 	if len(traces) > 1 {
-		panic("more than one trace returned, expected exactly one; bug in query?")
+		// Spans straddling measurement boundaries can come back as separate
+		// traces; combine them rather than failing the lookup.
+		r.logger.Warn("GetTrace returned more than one trace; merging", "traces", len(traces))
+		traces = []*model.Trace{dbmodel.MergeTraceSpans(traces)}
 	}
 
 	response, err = r.query(ctx, dbmodel.NewInfluxQLLogQuery(r.logMeasurement).BuildLogQuery([]model.TraceID{traceID}))
@@ -206,12 +307,29 @@ func (r *Reader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Tr
 		return nil, err
 	}
 
+	dbmodel.ComputeTraceStatistics(traces[0])
+	for _, adjust := range r.adjusters {
+		adjust(traces[0])
+	}
+
 	return traces[0], nil
 }
 
 // FindTraceIDs retrieve traceIDs that match the traceQuery
 func (r *Reader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
-	response, err := r.query(ctx, dbmodel.InfluxQLTraceQueryFromTQP(r.spanMeasurement, query).BuildTraceIDQuery())
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.FindTraceIDs)
+	defer cancel()
+
+	query, err := dbmodel.NormalizeTraceQueryParams(query, r.defaultLookback)
+	if err != nil {
+		return nil, err
+	}
+
+	q := dbmodel.InfluxQLTraceQueryFromTQP(r.spanMeasurement, query)
+	if r.regexTags {
+		q.RegexTags()
+	}
+	response, err := r.query(ctx, q.BuildTraceIDQuery())
 	if err != nil {
 		return nil, err
 	}
@@ -222,12 +340,34 @@ func (r *Reader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryPa
 // We don't use duration, just need span_id,service_name where references is null.
 const getDependenciesQueryInfluxQL = `select "span_id", "service_name", "references", "duration" from %s where time > now() - %s`
 
-// GetDependencies returns all inter-service dependencies
+// GetDependencies returns all inter-service dependencies. The
+// dependencystore.Reader interface predates context; callers that have one
+// should use GetDependenciesWithContext instead.
 func (r *Reader) GetDependencies(endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
-	response, err := r.query(context.Background(), fmt.Sprintf(getDependenciesQueryInfluxQL, r.spanMeasurement, lookback.String()))
+	return r.GetDependenciesWithContext(context.Background(), endTs, lookback)
+}
+
+// GetDependenciesWithContext is GetDependencies honoring the caller's context.
+func (r *Reader) GetDependenciesWithContext(ctx context.Context, endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.GetDependencies)
+	defer cancel()
+
+	response, err := r.query(ctx, fmt.Sprintf(getDependenciesQueryInfluxQL, r.spanMeasurement, lookback.String()))
 	if err != nil {
 		return nil, err
 	}
 
 	return dbmodel.DependencyLinksFromResultV1(response)
 }
+
+// GetDependencyPaths returns the transitive caller and callee paths through
+// the given service, each path bounded by maxDepth hops.
+func (r *Reader) GetDependencyPaths(endTs time.Time, lookback time.Duration, service string, maxDepth int) (upstream, downstream []dbmodel.DependencyPath, err error) {
+	links, err := r.GetDependencies(endTs, lookback)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dbmodel.UpstreamDependencyPaths(links, service, maxDepth),
+		dbmodel.DownstreamDependencyPaths(links, service, maxDepth), nil
+}
@@ -1,3 +1,7 @@
+// Package storev1 implements the Jaeger storage interfaces against InfluxDB
+// v1.x using InfluxQL exclusively — no query here requires Flux, so the
+// plugin works on a stock 1.8 deployment with flux-enabled = false. The
+// Flux-based implementation lives in storev2.
 package storev1
 
 import (
@@ -8,11 +12,14 @@ import (
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/influxdata/influxdb1-client"
+	"github.com/influxdata/jaeger-influxdb/canary"
 	"github.com/influxdata/jaeger-influxdb/common"
 	"github.com/influxdata/jaeger-influxdb/config"
+	"github.com/influxdata/jaeger-influxdb/dbmodel"
 	"github.com/jaegertracing/jaeger/plugin/storage/grpc/shared"
 	"github.com/jaegertracing/jaeger/storage/dependencystore"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/pkg/errors"
 )
 
 var (
@@ -21,8 +28,14 @@ var (
 )
 
 type Store struct {
-	reader *Reader
-	writer *Writer
+	reader        *Reader
+	spanReader    spanstore.Reader
+	writer        *Writer
+	spanWriter    spanstore.Writer
+	depReader     dependencystore.Reader
+	staleReader   *common.StaleMetadataReader
+	metadataCache *common.MetadataCachingReader
+	canary        *canary.Canary
 }
 
 func NewStore(conf *config.Configuration, logger hclog.Logger) (*Store, func() error, error) {
@@ -46,27 +59,178 @@ func NewStore(conf *config.Configuration, logger hclog.Logger) (*Store, func() e
 	}
 
 	reader := NewReader(influxClient, conf.Database, conf.RetentionPolicy, common.DefaultSpanMeasurement, common.DefaultSpanMetaMeasurement, common.DefaultLogMeasurement, conf.DefaultLookback, logger)
+	if len(conf.Adjusters) > 0 {
+		adjusters, err := dbmodel.NewAdjusterPipeline(conf.Adjusters, conf.ClockSkewMaxAdjust)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader.SetAdjusters(adjusters)
+	}
+	if conf.RegexTags {
+		reader.SetRegexTags()
+	}
+	if conf.LogQueries {
+		reader.SetLogQueries()
+	}
+	reader.SetQueryTimeouts(common.QueryTimeouts{
+		GetTrace:        conf.GetTraceTimeout,
+		FindTraceIDs:    conf.FindTraceIDsTimeout,
+		FindTraces:      conf.FindTracesTimeout,
+		GetServices:     conf.GetServicesTimeout,
+		GetDependencies: conf.GetDependenciesTimeout,
+	})
 	writer := NewWriter(influxClient, conf.Database, conf.RetentionPolicy, common.DefaultSpanMeasurement, common.DefaultSpanMetaMeasurement, common.DefaultLogMeasurement, logger)
+	writer.SetChecksums(conf.SpanChecksums)
+	writer.SetFlushPolicy(conf.WriteFlushPoints, conf.WriteFlushInterval)
+	if conf.WriteQueueSize > 0 {
+		switch conf.WriteQueuePolicy {
+		case "", common.QueuePolicyBlock, common.QueuePolicyDropNew, common.QueuePolicyDropOld:
+		default:
+			return nil, nil, errors.Errorf("unrecognized write-queue-policy '%s'", conf.WriteQueuePolicy)
+		}
+		writer.SetWriteQueue(common.NewWriteQueue(conf.WriteQueueSize, conf.WriteQueuePolicy))
+	}
+	if conf.WALDir != "" {
+		wal, err := common.NewWriteWAL(conf.WALDir, conf.WALSegmentBytes, conf.WALMaxBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		writer.SetWAL(wal)
+	}
+	switch conf.CollisionStrategy {
+	case "", common.CollisionStrategyJitter:
+	case common.CollisionStrategySpanIDTag:
+		writer.SetCollisionStrategy(conf.CollisionStrategy)
+	default:
+		return nil, nil, errors.Errorf("unrecognized collision-strategy '%s'", conf.CollisionStrategy)
+	}
+	if conf.CollisionDetectionCacheSize > 0 {
+		writer.SetCollisionDetector(common.NewCollisionDetector(conf.CollisionDetectionCacheSize))
+	}
+	if conf.WriteRateLimit > 0 {
+		writer.SetRateLimiter(common.NewWriteRateLimiter(conf.WriteRateLimit, conf.WriteRateBurst))
+	}
+	if conf.WriteQuotaPointsPerDay > 0 || conf.WriteQuotaBytesPerDay > 0 {
+		writer.SetWriteQuota(common.NewWriteQuota(conf.WriteQuotaPointsPerDay, conf.WriteQuotaBytesPerDay, conf.WriteQuotaSampleRate))
+	}
+	if conf.DedupeCacheSize > 0 {
+		writer.SetDeduper(common.NewWriteDeduper(conf.DedupeCacheSize))
+	}
+	if conf.WriteLagThreshold > 0 {
+		writer.SetLagWatchdog(common.NewWriteLagWatchdog(conf.WriteLagThreshold, logger))
+	}
+	if conf.WriteBackpressure {
+		writer.SetPacer(common.NewWritePacer())
+	}
 	store := &Store{
-		reader: reader,
-		writer: writer,
+		reader:     reader,
+		spanReader: reader,
+		writer:     writer,
+		spanWriter: writer,
+		depReader:  reader,
+	}
+	if conf.StaleMetadataFallback {
+		staleReader := common.NewStaleMetadataReader(reader, logger)
+		if conf.MetadataSnapshotFile != "" {
+			interval := conf.MetadataSnapshotInterval
+			if interval <= 0 {
+				interval = common.DefaultMetadataSnapshotInterval
+			}
+			staleReader.PersistSnapshots(conf.MetadataSnapshotFile, interval)
+		}
+		if conf.MetadataRefreshInterval > 0 {
+			staleReader.RefreshInBackground(conf.MetadataRefreshInterval)
+		}
+		store.spanReader = staleReader
+		store.depReader = staleReader
+		store.staleReader = staleReader
+	}
+	// The decryptor sits beneath the caches so a cached trace is decrypted
+	// exactly once before the caches share it; decryptTrace mutates spans in
+	// place, and the caches hand the same trace to concurrent callers.
+	if conf.EncryptionKey != "" && len(conf.EncryptTags) > 0 {
+		keyProvider, err := common.NewStaticKeyProvider(conf.EncryptionKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		tagCipher, err := common.NewTagCipher(keyProvider, conf.EncryptTags)
+		if err != nil {
+			return nil, nil, err
+		}
+		store.spanWriter = common.NewEncryptingWriter(store.spanWriter, tagCipher)
+		store.spanReader = common.NewDecryptingReader(store.spanReader, tagCipher)
+	}
+	if conf.SearchCacheTTL > 0 {
+		store.spanReader = common.NewSearchCachingReader(store.spanReader, conf.SearchCacheTTL)
+	}
+	if conf.TraceCacheTTL > 0 {
+		traceCache := common.NewTraceCachingReader(store.spanReader, conf.TraceCacheTTL, conf.TraceCacheMaxBytes)
+		if conf.TraceCacheNegativeTTL > 0 {
+			traceCache.SetNegativeTTL(conf.TraceCacheNegativeTTL)
+		}
+		store.spanReader = traceCache
+	}
+	if conf.MetadataCacheTTL > 0 {
+		metadataCache := common.NewMetadataCachingReader(store.spanReader, conf.MetadataCacheTTL, conf.MetadataCacheSize)
+		if conf.MetadataWarmInterval > 0 {
+			metadataCache.WarmInBackground(conf.MetadataWarmInterval, logger)
+		}
+		store.spanReader = metadataCache
+		store.metadataCache = metadataCache
+	}
+	if conf.AccessPolicyFile != "" {
+		policy, err := common.LoadAccessPolicy(conf.AccessPolicyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		store.spanReader = common.NewAuthorizedReader(store.spanReader, policy)
+	}
+	if conf.AuditLog {
+		store.spanReader = common.NewAuditedReader(store.spanReader, logger)
+	}
+	if conf.CanaryInterval > 0 {
+		store.canary = canary.NewCanary(reader, store.spanWriter, conf.CanaryInterval, logger)
 	}
 
 	return store, store.Close, nil
 }
 
 func (s *Store) Close() error {
+	if s.canary != nil {
+		if err := s.canary.Close(); err != nil {
+			return err
+		}
+	}
+	if s.staleReader != nil {
+		if err := s.staleReader.Close(); err != nil {
+			return err
+		}
+	}
+	if s.metadataCache != nil {
+		if err := s.metadataCache.Close(); err != nil {
+			return err
+		}
+	}
 	return s.writer.Close()
 }
 
+// FlushMetadataCaches discards the named metadata cache ("services",
+// "operations", "dependencies", or "all"); no-op unless the stale metadata
+// fallback is enabled.
+func (s *Store) FlushMetadataCaches(name string) {
+	if s.staleReader != nil {
+		s.staleReader.Flush(name)
+	}
+}
+
 func (s *Store) SpanReader() spanstore.Reader {
-	return s.reader
+	return s.spanReader
 }
 
 func (s *Store) SpanWriter() spanstore.Writer {
-	return s.writer
+	return s.spanWriter
 }
 
 func (s *Store) DependencyReader() dependencystore.Reader {
-	return s.reader
+	return s.depReader
 }
@@ -3,7 +3,9 @@ package storev1
 import (
 	"bytes"
 	"io"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
@@ -33,8 +35,24 @@ type Writer struct {
 	// Points as line protocol
 	writeCh chan string
 	writeWG sync.WaitGroup
+	queue   *common.WriteQueue
+	queueWG sync.WaitGroup
 
-	metaCache *common.WriterMetaCache
+	wal           *common.WriteWAL
+	walWG         sync.WaitGroup
+	flushFailures uint64
+
+	metaCache         *common.WriterMetaCache
+	collisionStrategy string
+	collisionDetector *common.CollisionDetector
+	rateLimiter       *common.WriteRateLimiter
+	quota             *common.WriteQuota
+	deduper           *common.WriteDeduper
+	lagWatchdog       *common.WriteLagWatchdog
+	pacer             *common.WritePacer
+	checksums         bool
+	flushPoints       int
+	flushInterval     time.Duration
 
 	logger hclog.Logger
 }
@@ -49,8 +67,10 @@ func NewWriter(client *client.Client, database, retentionPolicy, spanMeasurement
 		spanMetaMeasurement: spanMetaMeasurement,
 		logMeasurement:      logMeasurement,
 
-		writeCh:   make(chan string),
-		metaCache: common.NewWriterMetaCache(common.MetaCacheInterval),
+		writeCh:       make(chan string),
+		metaCache:     common.NewWriterMetaCache(common.MetaCacheInterval),
+		flushPoints:   common.MaxFlushPoints,
+		flushInterval: common.MaxFlushInterval,
 
 		logger: logger,
 	}
@@ -67,27 +87,195 @@ func NewWriter(client *client.Client, database, retentionPolicy, spanMeasurement
 
 // Close triggers a graceful shutdown
 func (w *Writer) Close() error {
+	// A replay still in flight must finish submitting before the channels
+	// close under it.
+	w.walWG.Wait()
+	if w.queue != nil {
+		w.queue.Close()
+		w.queueWG.Wait()
+	}
 	close(w.writeCh)
 	w.writeWG.Wait()
+	if w.wal != nil {
+		if atomic.LoadUint64(&w.flushFailures) == 0 {
+			// Every point reached InfluxDB; nothing to replay next run.
+			if err := w.wal.Truncate(); err != nil {
+				w.logger.Warn("failed to truncate write-ahead log", "error", err)
+			}
+		}
+		return w.wal.Close()
+	}
 	return nil
 }
 
+// SetRateLimiter applies a per-service rate limit to incoming spans.
+func (w *Writer) SetRateLimiter(rateLimiter *common.WriteRateLimiter) {
+	w.rateLimiter = rateLimiter
+}
+
+// SetWriteQuota enforces a daily point/byte quota for this destination database.
+func (w *Writer) SetWriteQuota(quota *common.WriteQuota) {
+	w.quota = quota
+}
+
+// SetChecksums stores an integrity checksum field on each span point.
+func (w *Writer) SetChecksums(checksums bool) {
+	w.checksums = checksums
+}
+
+// SetDeduper suppresses recently written duplicate spans.
+func (w *Writer) SetDeduper(deduper *common.WriteDeduper) {
+	w.deduper = deduper
+}
+
+// SetCollisionStrategy selects how span timestamp collisions are avoided;
+// see the common.CollisionStrategy constants.
+func (w *Writer) SetCollisionStrategy(strategy string) {
+	w.collisionStrategy = strategy
+}
+
+// SetCollisionDetector counts span points that overwrite an earlier span's
+// point in the same series and nanosecond.
+func (w *Writer) SetCollisionDetector(detector *common.CollisionDetector) {
+	w.collisionDetector = detector
+}
+
+// SetLagWatchdog tracks the delta between span end timestamps and write time.
+func (w *Writer) SetLagWatchdog(lagWatchdog *common.WriteLagWatchdog) {
+	w.lagWatchdog = lagWatchdog
+}
+
+// SetPacer slows batch submission in response to server backpressure signals.
+func (w *Writer) SetPacer(pacer *common.WritePacer) {
+	w.pacer = pacer
+}
+
+// SetFlushPolicy overrides when buffered points are flushed to InfluxDB: a
+// batch is written once it holds points points or once interval has passed
+// since its first point, whichever comes first. Zero keeps the corresponding
+// default. Call before the first span is written.
+func (w *Writer) SetFlushPolicy(points int, interval time.Duration) {
+	if points > 0 {
+		w.flushPoints = points
+	}
+	if interval > 0 {
+		w.flushInterval = interval
+	}
+}
+
+// SetWriteQueue bounds the points buffered ahead of the batching flusher;
+// see common.WriteQueue for the full-queue policies. Call before the first
+// span is written.
+func (w *Writer) SetWriteQueue(queue *common.WriteQueue) {
+	w.queue = queue
+	w.queueWG.Add(1)
+	go func() {
+		defer w.queueWG.Done()
+		queue.Drain(func(line string) { w.writeCh <- line })
+	}()
+}
+
+// SetWAL persists each submitted point to the given write-ahead log before
+// it is queued, and replays what the log already holds, so points buffered
+// by an earlier run survive a plugin restart or a short InfluxDB outage.
+// Replayed points that were already written overwrite themselves harmlessly.
+// Call before the first span is written.
+func (w *Writer) SetWAL(wal *common.WriteWAL) {
+	w.wal = wal
+	w.walWG.Add(1)
+	go func() {
+		defer w.walWG.Done()
+		if err := wal.Replay(w.submit); err != nil {
+			w.logger.Warn("failed to replay write-ahead log", "error", err)
+		}
+	}()
+}
+
+// enqueuePoint submits one point's line protocol for batching, subject to
+// the write quota when one is configured.
+func (w *Writer) enqueuePoint(line string) {
+	if w.quota != nil && !w.quota.Allow(len(line), time.Now()) {
+		if dropped := w.quota.DroppedPoints(); dropped == 1 || dropped%1000 == 0 {
+			w.logger.Warn("write quota exceeded; dropping points", "dropped", dropped)
+		}
+		return
+	}
+	w.submit(line)
+}
+
+// submit hands one point to the flusher, through the write-ahead log and
+// the bounded queue when they are configured.
+func (w *Writer) submit(line string) {
+	if w.wal != nil {
+		if err := w.wal.Append(line); err != nil {
+			w.logger.Warn("failed to append to write-ahead log", "error", err)
+		}
+	}
+	if w.queue != nil {
+		if !w.queue.Push(line) {
+			if dropped := w.queue.Dropped(); dropped == 1 || dropped%1000 == 0 {
+				w.logger.Warn("write queue full; dropping points",
+					"dropped", dropped, "depth", w.queue.Depth())
+			}
+		}
+		return
+	}
+	w.writeCh <- line
+}
+
 // WriteSpan saves the span into Cassandra
 func (w *Writer) WriteSpan(span *model.Span) error {
-	points, err := dbmodel.SpanToPointsV1(span, w.spanMeasurement, w.logMeasurement, w.logger)
+	if w.lagWatchdog != nil {
+		w.lagWatchdog.Observe(span.StartTime.Add(span.Duration), time.Now())
+	}
+
+	if w.rateLimiter != nil && !w.rateLimiter.Allow(span.Process.ServiceName, time.Now()) {
+		if dropped := w.rateLimiter.Dropped(span.Process.ServiceName); dropped == 1 || dropped%1000 == 0 {
+			w.logger.Warn("rate limited span writes", "service", span.Process.ServiceName, "dropped", dropped)
+		}
+		return nil
+	}
+
+	if w.deduper != nil && w.deduper.Seen(span.TraceID.String()+":"+span.SpanID.String(), dbmodel.SpanChecksum(span)) {
+		if suppressed := w.deduper.SuppressedDuplicates(); suppressed == 1 || suppressed%1000 == 0 {
+			w.logger.Warn("suppressed duplicate span writes", "suppressed", suppressed)
+		}
+		return nil
+	}
+
+	points, err := dbmodel.SpanToPointsV1(span, w.spanMeasurement, w.logMeasurement, w.checksums, w.logger)
 	if err != nil {
 		return err
 	}
 
+	if w.collisionStrategy == common.CollisionStrategySpanIDTag {
+		points[0].AddTag(common.SpanIDTagKey, span.SpanID.String())
+	}
+	if w.collisionDetector != nil {
+		key := string(points[0].Key()) + "@" + strconv.FormatInt(points[0].UnixNano(), 10)
+		if w.collisionDetector.Observe(key, span.SpanID.String()) {
+			if collisions := w.collisionDetector.Collisions(); collisions == 1 || collisions%1000 == 0 {
+				w.logger.Warn("span timestamp collision: an earlier span's point was overwritten",
+					"service", span.Process.ServiceName, "collisions", collisions)
+			}
+		}
+	}
+
 	for _, point := range points {
-		w.writeCh <- point.String()
+		w.enqueuePoint(point.String())
 	}
 
-	if w.metaCache.ShouldWrite(span.Process.ServiceName, span.OperationName, span.StartTime) {
+	// The span kind is part of the meta cache key, so one operation served
+	// under several kinds yields one meta point per kind.
+	kind := dbmodel.SpanKind(span)
+	if w.metaCache.ShouldWrite(span.Process.ServiceName, span.OperationName+"|"+kind, span.StartTime) {
 		tags := models.NewTags(map[string]string{
 			common.ServiceNameKey:   span.Process.ServiceName,
 			common.OperationNameKey: span.OperationName,
 		})
+		if kind != "" {
+			tags.SetString(common.SpanKindTagKey, kind)
+		}
 		fields := models.Fields{
 			"v": true,
 		}
@@ -96,14 +284,14 @@ func (w *Writer) WriteSpan(span *model.Span) error {
 			return errors.Wrap(err, "failed to create meta point")
 		}
 
-		w.writeCh <- point.String()
+		w.enqueuePoint(point.String())
 	}
 
 	return nil
 }
 
 func (w *Writer) batchAndWrite() {
-	batch := make([]string, 0, common.MaxFlushPoints)
+	batch := make([]string, 0, w.flushPoints)
 	var t <-chan time.Time
 
 	for {
@@ -117,12 +305,12 @@ func (w *Writer) batchAndWrite() {
 			}
 
 			if t == nil {
-				t = time.After(common.MaxFlushInterval)
+				t = time.After(w.flushInterval)
 			}
 
 			batch = append(batch, point)
 
-			if len(batch) == cap(batch) {
+			if len(batch) >= w.flushPoints {
 				w.writeBatch(batch)
 				batch = batch[:0]
 				t = nil
@@ -143,12 +331,27 @@ func (w *Writer) writeBatch(batch []string) {
 		_, _ = buf.WriteRune('\n')
 	}
 
+	if w.pacer != nil {
+		if delay := w.pacer.Delay(); delay > 0 {
+			if paced := w.pacer.PacedBatches(); paced == 1 || paced%1000 == 0 {
+				w.logger.Warn("pacing batch writes due to server backpressure", "delay", delay, "paced", paced)
+			}
+			time.Sleep(delay)
+		}
+	}
+
+	started := time.Now()
 	response, err := w.client.WriteLineProtocol(buf.String(), w.database, w.retentionPolicy, "ns", "any")
+	if w.pacer != nil {
+		w.pacer.ObserveWrite(time.Since(started), err != nil || (response != nil && response.Err != nil))
+	}
 	if err != nil {
+		atomic.AddUint64(&w.flushFailures, 1)
 		w.logger.Warn("failed to write batch", "error", err)
 		return
 	}
 	if response != nil && response.Err != nil {
+		atomic.AddUint64(&w.flushFailures, 1)
 		w.logger.Warn("failed to write batch", "error", response.Err)
 		return
 	}
@@ -0,0 +1,52 @@
+package storev2
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// CheckHealth verifies the reader's path to InfluxDB end to end: the server
+// answers a ping, the bucket still exists and the token may read it, and a
+// trivial Flux query executes. It is cheap enough to back a readiness
+// endpoint, so revoked tokens and deleted buckets surface there instead of
+// at the first real query.
+func (r *Reader) CheckHealth(ctx context.Context) error {
+	host := r.fluxQueryService.Addr
+	token := r.fluxQueryService.Token
+
+	req, err := http.NewRequest(http.MethodGet, host+"/ping", nil)
+	if err != nil {
+		return errors.Wrap(err, "ping check failed")
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "ping check failed")
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("ping check failed: unexpected status %d", resp.StatusCode)
+	}
+
+	if _, err := findBucketID(ctx, host, token, r.orgID, r.bucket); err != nil {
+		return errors.Wrap(err, "bucket check failed")
+	}
+
+	fluxQuery := fmt.Sprintf(`from(bucket:%q) |> range(start:-1m) |> limit(n:1)`, r.bucket)
+	resultIterator, err := r.query(ctx, fluxQuery)
+	if err != nil {
+		// io.EOF signals an empty result, not a failure.
+		if err == io.EOF {
+			return nil
+		}
+		return errors.Wrap(err, "query check failed")
+	}
+	defer resultIterator.Release()
+	for resultIterator.More() {
+		resultIterator.Next()
+	}
+	return errors.Wrap(resultIterator.Err(), "query check failed")
+}
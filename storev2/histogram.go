@@ -0,0 +1,129 @@
+package storev2
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/influxdata/flux"
+	"github.com/influxdata/jaeger-influxdb/common"
+	"github.com/influxdata/jaeger-influxdb/dbmodel"
+)
+
+// DurationHistogramBucket counts spans whose duration is at or below
+// UpperBound. Counts are cumulative; the final bucket is unbounded and
+// therefore holds the total.
+type DurationHistogramBucket struct {
+	UpperBound time.Duration
+	Count      int64
+}
+
+// DurationHistogram summarizes the span duration distribution of one service
+// (and optionally one operation) over a time window.
+type DurationHistogram struct {
+	Buckets []DurationHistogramBucket
+	P50     time.Duration
+	P95     time.Duration
+	P99     time.Duration
+}
+
+// queryDurationHistogramFlux computes a logarithmic duration histogram and
+// duration percentiles server-side, in a single Flux query with one yield
+// per statistic. Bins start at 1ms and double for 30 buckets.
+const queryDurationHistogramFlux = `
+data = from(bucket: "%s")
+ |> range(start: %s, stop: %s)
+ |> filter(fn: (r) => r._measurement == "%s" and r._field == "%s")
+ |> filter(fn: (r) => %s)
+ |> group()
+ |> toFloat()
+data
+ |> histogram(bins: logarithmicBins(start: 1000000.0, factor: 2.0, count: 30, infinity: true), normalize: false)
+ |> yield(name: "histogram")
+data |> quantile(q: 0.50, method: "estimate_tdigest") |> yield(name: "p50")
+data |> quantile(q: 0.95, method: "estimate_tdigest") |> yield(name: "p95")
+data |> quantile(q: 0.99, method: "estimate_tdigest") |> yield(name: "p99")
+`
+
+// GetDurationHistogram returns the duration distribution of spans for a
+// service — narrowed to one operation when operation is non-empty — computed
+// in Flux, so latency widgets need not download every trace. Only the
+// primary schema is aggregated, as with dependencies.
+func (r *Reader) GetDurationHistogram(ctx context.Context, service, operation string, startTime, endTime time.Time) (*DurationHistogram, error) {
+	r.logger.Debug("GetDurationHistogram called")
+
+	predicate := fmt.Sprintf(`r.%s == "%s"`, common.ServiceNameKey, dbmodel.EscapeFluxString(service))
+	if operation != "" {
+		predicate += fmt.Sprintf(` and r.%s == "%s"`, common.OperationNameKey, dbmodel.EscapeFluxString(operation))
+	}
+
+	q := fmt.Sprintf(queryDurationHistogramFlux,
+		r.bucket,
+		startTime.UTC().Format(time.RFC3339Nano), endTime.UTC().Format(time.RFC3339Nano),
+		r.schemas[0].SpanMeasurement, common.DurationKey, predicate)
+
+	resultIterator, err := r.query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	histogram := &DurationHistogram{}
+	for resultIterator.More() {
+		result := resultIterator.Next()
+		name := result.Name()
+		err = result.Tables().Do(func(table flux.Table) error {
+			return table.Do(func(reader flux.ColReader) error {
+				switch name {
+				case "histogram":
+					leI := columnIndex(reader, "le")
+					valueI := columnIndex(reader, common.ValueKey)
+					if leI < 0 || valueI < 0 {
+						return nil
+					}
+					for rowI := 0; rowI < reader.Len(); rowI++ {
+						le := reader.Floats(leI).Value(rowI)
+						upperBound := time.Duration(math.MaxInt64)
+						if !math.IsInf(le, 1) {
+							upperBound = time.Duration(le)
+						}
+						histogram.Buckets = append(histogram.Buckets, DurationHistogramBucket{
+							UpperBound: upperBound,
+							Count:      int64(reader.Floats(valueI).Value(rowI)),
+						})
+					}
+				case "p50", "p95", "p99":
+					valueI := columnIndex(reader, common.ValueKey)
+					if valueI < 0 || reader.Len() == 0 {
+						return nil
+					}
+					quantile := time.Duration(reader.Floats(valueI).Value(0))
+					switch name {
+					case "p50":
+						histogram.P50 = quantile
+					case "p95":
+						histogram.P95 = quantile
+					case "p99":
+						histogram.P99 = quantile
+					}
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return histogram, nil
+}
+
+// columnIndex returns the index of the column with the given label, or -1.
+func columnIndex(reader flux.ColReader, label string) int {
+	for colI, col := range reader.Cols() {
+		if col.Label == label {
+			return colI
+		}
+	}
+	return -1
+}
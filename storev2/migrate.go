@@ -0,0 +1,222 @@
+package storev2
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/influxdata/flux"
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/jaeger-influxdb/common"
+	"github.com/influxdata/jaeger-influxdb/config"
+	"github.com/influxdata/jaeger-influxdb/influx2http"
+	"github.com/pkg/errors"
+)
+
+// Migrator rewrites historical trace data from one measurement (schema
+// layout) to another, in time-chunked batches so that a migration over a
+// long retention period can be throttled and resumed.
+type Migrator struct {
+	reader          *Reader
+	writeService    *influx2http.WriteService
+	orgID, bucketID influxdb.ID
+	bucket          string
+	fromMeasurement string
+	toMeasurement   string
+	chunkInterval   time.Duration
+	throttle        time.Duration
+
+	logger hclog.Logger
+}
+
+// NewMigrator returns a Migrator that copies points from fromMeasurement to
+// toMeasurement in chunks of chunkInterval, sleeping throttle between chunks.
+func NewMigrator(conf *config.Configuration, fromMeasurement, toMeasurement string, chunkInterval, throttle time.Duration, logger hclog.Logger) (*Migrator, error) {
+	orgID, err := findOrgID(context.TODO(), conf.Host, conf.Token, conf.Organization)
+	if err != nil {
+		return nil, err
+	}
+
+	bucketID, err := findBucketID(context.TODO(), conf.Host, conf.Token, orgID, conf.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	fluxQueryService := &influx2http.FluxQueryService{
+		Addr:  conf.Host,
+		Token: conf.Token,
+	}
+	reader := NewReader(fluxQueryService, orgID, conf.Bucket, common.DefaultSpanMeasurement, common.DefaultSpanMetaMeasurement, common.DefaultLogMeasurement, conf.DefaultLookback, logger)
+
+	writeService := &influx2http.WriteService{
+		Addr:      conf.Host,
+		Token:     conf.Token,
+		Precision: "ns",
+	}
+
+	return &Migrator{
+		reader:          reader,
+		writeService:    writeService,
+		orgID:           orgID,
+		bucketID:        bucketID,
+		bucket:          conf.Bucket,
+		fromMeasurement: fromMeasurement,
+		toMeasurement:   toMeasurement,
+		chunkInterval:   chunkInterval,
+		throttle:        throttle,
+		logger:          logger,
+	}, nil
+}
+
+// Run migrates points with timestamps in [start, end), one chunk at a time,
+// reporting progress after each chunk. On failure the error names the chunk
+// start time, so the operator can resume by passing it as the new start.
+func (m *Migrator) Run(ctx context.Context, start, end time.Time) error {
+	for chunkStart := start; chunkStart.Before(end); chunkStart = chunkStart.Add(m.chunkInterval) {
+		chunkEnd := chunkStart.Add(m.chunkInterval)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+
+		quantity, err := m.migrateChunk(ctx, chunkStart, chunkEnd)
+		if err != nil {
+			return errors.WithMessagef(err, "migration failed; resume with start time %s", chunkStart.UTC().Format(time.RFC3339Nano))
+		}
+		m.logger.Warn("migrated chunk",
+			"start", chunkStart.UTC().Format(time.RFC3339Nano),
+			"stop", chunkEnd.UTC().Format(time.RFC3339Nano),
+			"points", quantity,
+			"remaining", end.Sub(chunkEnd).String())
+
+		if m.throttle > 0 {
+			time.Sleep(m.throttle)
+		}
+	}
+
+	return nil
+}
+
+const migrateChunkQueryFlux = `from(bucket: "%s")
+ |> range(start: %s, stop: %s)
+ |> filter(fn: (r) => r.%s == "%s")`
+
+func (m *Migrator) migrateChunk(ctx context.Context, start, end time.Time) (int, error) {
+	q := fmt.Sprintf(migrateChunkQueryFlux,
+		m.bucket,
+		start.UTC().Format(time.RFC3339Nano), end.UTC().Format(time.RFC3339Nano),
+		common.MeasurementKey, m.fromMeasurement)
+
+	result, err := m.reader.query(ctx, q)
+	if err != nil {
+		if err == io.EOF {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var points models.Points
+	for result.More() {
+		err = result.Next().Tables().Do(func(table flux.Table) error {
+			tablePoints, err := m.pointsFromFluxTable(table)
+			if err != nil {
+				return err
+			}
+			points = append(points, tablePoints...)
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if len(points) == 0 {
+		return 0, nil
+	}
+
+	return len(points), m.writePoints(ctx, points)
+}
+
+// pointsFromFluxTable re-encodes raw (non-pivoted) rows as points under the
+// destination measurement. Group key string columns become tags, and each
+// row's _field/_value pair becomes the single field of one point.
+func (m *Migrator) pointsFromFluxTable(table flux.Table) (models.Points, error) {
+	var points models.Points
+
+	err := table.Do(func(reader flux.ColReader) error {
+		timeColI, fieldColI, valueColI := -1, -1, -1
+		tagColIs := make([]int, 0, len(reader.Cols()))
+		for colI, col := range reader.Cols() {
+			switch col.Label {
+			case common.TimeV2Key:
+				timeColI = colI
+			case common.FieldKey:
+				fieldColI = colI
+			case common.ValueKey:
+				valueColI = colI
+			case common.MeasurementKey, "_start", "_stop":
+				// Dropped; the measurement is replaced and range bounds are not data.
+			default:
+				if table.Key().HasCol(col.Label) && col.Type == flux.TString {
+					tagColIs = append(tagColIs, colI)
+				}
+			}
+		}
+		if timeColI == -1 || fieldColI == -1 || valueColI == -1 {
+			return errors.New("expected raw flux rows with _time, _field and _value columns")
+		}
+
+		for rowI := 0; rowI < reader.Len(); rowI++ {
+			var tags models.Tags
+			for _, colI := range tagColIs {
+				if reader.Strings(colI).IsNull(rowI) {
+					continue
+				}
+				tags.SetString(reader.Cols()[colI].Label, reader.Strings(colI).ValueString(rowI))
+			}
+
+			fields := models.Fields{}
+			fieldKey := reader.Strings(fieldColI).ValueString(rowI)
+			switch reader.Cols()[valueColI].Type {
+			case flux.TBool:
+				fields[fieldKey] = reader.Bools(valueColI).Value(rowI)
+			case flux.TInt:
+				fields[fieldKey] = reader.Ints(valueColI).Value(rowI)
+			case flux.TUInt:
+				fields[fieldKey] = reader.UInts(valueColI).Value(rowI)
+			case flux.TFloat:
+				fields[fieldKey] = reader.Floats(valueColI).Value(rowI)
+			case flux.TString:
+				fields[fieldKey] = reader.Strings(valueColI).ValueString(rowI)
+			default:
+				return errors.Errorf("unsupported value type for field '%s'", fieldKey)
+			}
+
+			point, err := models.NewPoint(m.toMeasurement, tags, fields, time.Unix(0, reader.Times(timeColI).Value(rowI)))
+			if err != nil {
+				return err
+			}
+			points = append(points, point)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return points, nil
+}
+
+func (m *Migrator) writePoints(ctx context.Context, points models.Points) error {
+	buf := bytes.NewBuffer([]byte{})
+	for _, point := range points {
+		_, _ = buf.WriteString(point.String())
+		_, _ = buf.WriteRune('\n')
+	}
+
+	return m.writeService.Write(ctx, m.orgID, m.bucketID, buf)
+}
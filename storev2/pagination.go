@@ -0,0 +1,76 @@
+package storev2
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/pkg/errors"
+)
+
+// FindTracesPaged is FindTraces with continuation: pass an empty token for
+// the first page and the returned token for each page after that. The token
+// encodes the earliest trace start time of the previous page, so paging
+// re-runs the search over a shrinking time window instead of one huge query.
+// An empty returned token means the last page was reached. Page size is
+// query.NumTraces.
+func (r *Reader) FindTracesPaged(ctx context.Context, query *spanstore.TraceQueryParameters, pageToken string) ([]*model.Trace, string, error) {
+	r.logger.Debug("FindTracesPaged called")
+
+	if pageToken != "" {
+		startTimeMax, err := decodePageToken(pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		paged := *query
+		paged.StartTimeMax = startTimeMax
+		query = &paged
+	}
+
+	traces, err := r.FindTraces(ctx, query)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// A short page means the window is exhausted; otherwise the next page
+	// resumes just before the earliest trace returned. Trace IDs are found
+	// newest first, so the earliest start time bounds what has been seen.
+	if len(traces) == 0 || query.NumTraces <= 0 || len(traces) < query.NumTraces {
+		return traces, "", nil
+	}
+
+	earliest := time.Time{}
+	for _, trace := range traces {
+		for i := range trace.Spans {
+			if earliest.IsZero() || trace.Spans[i].StartTime.Before(earliest) {
+				earliest = trace.Spans[i].StartTime
+			}
+		}
+	}
+	if earliest.IsZero() || !earliest.After(query.StartTimeMin) {
+		return traces, "", nil
+	}
+
+	return traces, encodePageToken(earliest.Add(-1 * time.Nanosecond)), nil
+}
+
+// encodePageToken packs a start time bound into an opaque token.
+func encodePageToken(t time.Time) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(t.UnixNano(), 10)))
+}
+
+// decodePageToken unpacks a token produced by encodePageToken.
+func decodePageToken(token string) (time.Time, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "invalid page token")
+	}
+	nanos, err := strconv.ParseInt(string(decoded), 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "invalid page token")
+	}
+	return time.Unix(0, nanos), nil
+}
@@ -0,0 +1,112 @@
+package storev2
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/influxdata/flux/lang"
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/query"
+	"github.com/influxdata/jaeger-influxdb/config"
+	"github.com/influxdata/jaeger-influxdb/influx2http"
+	"github.com/pkg/errors"
+)
+
+// preflightScratchMeasurement receives the preflight sample write; it is
+// separate from the span measurements so a misbehaving check never pollutes
+// trace data.
+const preflightScratchMeasurement = "jaeger-influxdb-preflight"
+
+// Preflight runs startup diagnostics against InfluxDB v2.x: ping, auth
+// check, bucket lookup, a sample Flux query and a sample write to a scratch
+// measurement. Each check logs pass or fail with a remediation hint; an error
+// is returned if any check fails. Most support issues are misconfiguration
+// that this catches instantly.
+func Preflight(ctx context.Context, conf *config.Configuration, logger hclog.Logger) error {
+	failed := 0
+
+	check := func(name, hint string, run func() error) {
+		if err := run(); err != nil {
+			failed++
+			logger.Error("preflight check failed", "check", name, "error", err, "hint", hint)
+			return
+		}
+		logger.Warn("preflight check passed", "check", name)
+	}
+
+	check("ping", "verify influxdb.host is reachable from this process", func() error {
+		req, err := http.NewRequest(http.MethodGet, conf.Host+"/ping", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return errors.Errorf("unexpected ping status %d", resp.StatusCode)
+		}
+		return nil
+	})
+
+	var orgID influxdb.ID
+	check("auth", "verify influxdb.token is valid and influxdb.organization exists", func() error {
+		var err error
+		orgID, err = findOrgID(ctx, conf.Host, conf.Token, conf.Organization)
+		return err
+	})
+	if failed > 0 {
+		// The remaining checks need a valid org; report what we have.
+		return errors.Errorf("%d preflight check(s) failed", failed)
+	}
+
+	var bucketID influxdb.ID
+	check("bucket", "verify influxdb.bucket exists and the token can read it", func() error {
+		var err error
+		bucketID, err = findBucketID(ctx, conf.Host, conf.Token, orgID, conf.Bucket)
+		return err
+	})
+
+	check("query", "verify the token has query permission for the organization", func() error {
+		fluxQueryService := &influx2http.FluxQueryService{
+			Addr:  conf.Host,
+			Token: conf.Token,
+		}
+		resultIterator, err := fluxQueryService.Query(ctx, &query.Request{
+			OrganizationID: orgID,
+			Compiler:       lang.FluxCompiler{Query: fmt.Sprintf(`from(bucket:%q) |> range(start:-1m) |> limit(n:1)`, conf.Bucket)},
+		})
+		if err != nil {
+			return err
+		}
+		defer resultIterator.Release()
+		for resultIterator.More() {
+			resultIterator.Next()
+		}
+		return resultIterator.Err()
+	})
+
+	check("write", "verify the token has write permission for the bucket", func() error {
+		writeService := &influx2http.WriteService{
+			Addr:      conf.Host,
+			Token:     conf.Token,
+			Precision: "ns",
+		}
+		point, err := models.NewPoint(preflightScratchMeasurement, nil, models.Fields{"v": true}, time.Now())
+		if err != nil {
+			return err
+		}
+		return writeService.Write(ctx, orgID, bucketID, bytes.NewBufferString(point.String()))
+	})
+
+	if failed > 0 {
+		return errors.Errorf("%d preflight check(s) failed", failed)
+	}
+	return nil
+}
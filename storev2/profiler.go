@@ -0,0 +1,115 @@
+package storev2
+
+import (
+	"time"
+
+	"github.com/influxdata/flux"
+	"github.com/influxdata/jaeger-influxdb/common"
+	"github.com/uber/jaeger-lib/metrics"
+)
+
+// profilerHeader enables the server-side Flux query profiler; its report
+// comes back as an extra result alongside the query's own.
+const profilerHeader = "import \"profiler\"\noption profiler.enabledProfilers = [\"query\"]\n\n"
+
+// profilerResultName is the name under which the server returns the
+// profiler's report.
+const profilerResultName = "_profiler"
+
+// readerMetrics exports one reader operation's statistics: its end-to-end
+// latency, failures (timeouts counted separately), the spans it decoded, and
+// the profiler's scanned-data and timing figures when profiling is enabled.
+type readerMetrics struct {
+	Latency       metrics.Timer   `metric:"latency"`
+	Errors        metrics.Counter `metric:"errors"`
+	Timeouts      metrics.Counter `metric:"timeouts"`
+	SpansDecoded  metrics.Counter `metric:"spans_decoded"`
+	ScannedValues metrics.Counter `metric:"flux_scanned_values"`
+	ScannedBytes  metrics.Counter `metric:"flux_scanned_bytes"`
+	PlanTime      metrics.Timer   `metric:"flux_plan_time"`
+	ExecuteTime   metrics.Timer   `metric:"flux_execute_time"`
+}
+
+// operationMetrics returns the cached metrics tagged with operation,
+// creating them on first use; nil when no metrics factory is configured.
+func (r *Reader) operationMetrics(operation string) *readerMetrics {
+	if r.metricsFactory == nil {
+		return nil
+	}
+	r.opMetricsMu.Lock()
+	defer r.opMetricsMu.Unlock()
+	if r.opMetrics == nil {
+		r.opMetrics = make(map[string]*readerMetrics)
+	}
+	m, ok := r.opMetrics[operation]
+	if !ok {
+		m = &readerMetrics{}
+		metrics.MustInit(m, r.metricsFactory, map[string]string{"operation": operation})
+		r.opMetrics[operation] = m
+	}
+	return m
+}
+
+// profileIterator strips the profiler's report out of a query result before
+// the decoders see it, recording the report into the request's QueryStats.
+type profileIterator struct {
+	flux.ResultIterator
+	stats   *common.QueryStats
+	pending flux.Result
+}
+
+func (itr *profileIterator) More() bool {
+	if itr.pending != nil {
+		return true
+	}
+	for itr.ResultIterator.More() {
+		result := itr.ResultIterator.Next()
+		if result.Name() != profilerResultName {
+			itr.pending = result
+			return true
+		}
+		itr.recordProfile(result)
+	}
+	return false
+}
+
+func (itr *profileIterator) Next() flux.Result {
+	if !itr.More() {
+		panic("no more results")
+	}
+	result := itr.pending
+	itr.pending = nil
+	return result
+}
+
+// recordProfile parses one profiler report into the request's stats. Report
+// columns of interest: the values and bytes the storage engine scanned, and
+// the planning and execution durations in nanoseconds.
+func (itr *profileIterator) recordProfile(result flux.Result) {
+	_ = result.Tables().Do(func(tbl flux.Table) error {
+		cols := tbl.Cols()
+		return tbl.Do(func(cr flux.ColReader) error {
+			for row := 0; row < cr.Len(); row++ {
+				var scannedValues, scannedBytes, planNS, executeNS int64
+				for j, col := range cols {
+					if col.Type != flux.TInt {
+						continue
+					}
+					switch col.Label {
+					case "influxdb/scanned-values":
+						scannedValues = cr.Ints(j).Value(row)
+					case "influxdb/scanned-bytes":
+						scannedBytes = cr.Ints(j).Value(row)
+					case "PlanDuration":
+						planNS = cr.Ints(j).Value(row)
+					case "ExecuteDuration":
+						executeNS = cr.Ints(j).Value(row)
+					}
+				}
+				itr.stats.ObserveProfile(scannedValues, scannedBytes,
+					time.Duration(planNS), time.Duration(executeNS))
+			}
+			return nil
+		})
+	})
+}
@@ -4,6 +4,10 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
@@ -17,6 +21,9 @@ import (
 	"github.com/influxdata/jaeger-influxdb/influx2http"
 	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pkg/errors"
+	"github.com/uber/jaeger-lib/metrics"
 )
 
 var _ spanstore.Reader = (*Reader)(nil)
@@ -26,11 +33,50 @@ type Reader struct {
 	fluxQueryService    *influx2http.FluxQueryService
 	orgID               influxdb.ID
 	bucket              string
+	archiveBucket       string
+	coldBuckets         []string
+	federated           []*Reader
 	spanMeasurement     string
 	spanMetaMeasurement string
 	logMeasurement      string
 	defaultLookback     time.Duration
 
+	// schemas are the measurement layouts to query; the primary schema first,
+	// followed by any legacy schemas registered via AddSchema.
+	schemas []dbmodel.Schema
+
+	maxTraceIDsPerQuery     int
+	maxRowsPerQuery         int
+	maxServices             int
+	metaQueryLookback       time.Duration
+	rowCapHits              uint64
+	fetchConcurrency        int
+	maxQueryWindow          time.Duration
+	maxLookback             time.Duration
+	readConsistencyDelay    time.Duration
+	getTraceRetryDelay      time.Duration
+	dependencyQueryChunk    time.Duration
+	slowQueryThreshold      time.Duration
+	retentionNanos          int64
+	traceMemoryBudget       int64
+	templates               *QueryTemplates
+	searchFilter            string
+	regexTags               bool
+	logQueries              bool
+	tagQueriesWithRequestID bool
+	skipSearchLogs          bool
+	profiling               bool
+	metricsFactory          metrics.Factory
+	opMetrics               map[string]*readerMetrics
+	opMetricsMu             sync.Mutex
+	timeouts                common.QueryTimeouts
+	breaker                 *common.CircuitBreaker
+	querySem                chan struct{}
+	queuedQueries           uint64
+	adjusters               []dbmodel.Adjuster
+
+	tagValuesTruncations uint64
+
 	resultDecoder *csv.ResultDecoder
 
 	logger hclog.Logger
@@ -47,18 +93,438 @@ func NewReader(fluxQueryService *influx2http.FluxQueryService, orgID influxdb.ID
 		spanMetaMeasurement: spanMetaMeasurement,
 		logMeasurement:      logMeasurement,
 		defaultLookback:     defaultLookback,
+		schemas: []dbmodel.Schema{
+			{SpanMeasurement: spanMeasurement, LogMeasurement: logMeasurement},
+		},
+		maxTraceIDsPerQuery: common.DefaultMaxTraceIDsPerQuery,
 		logger:              logger,
 	}
 }
 
-func (r *Reader) query(ctx context.Context, fluxQuery string) (flux.ResultIterator, error) {
-	r.logger.Warn(fluxQuery)
+// SetMaxTraceIDsPerQuery overrides the number of trace IDs packed into a
+// single Flux trace query before the ID list is split across queries.
+func (r *Reader) SetMaxTraceIDsPerQuery(maxTraceIDsPerQuery int) {
+	if maxTraceIDsPerQuery > 0 {
+		r.maxTraceIDsPerQuery = maxTraceIDsPerQuery
+	}
+}
+
+// SetMaxRowsPerQuery caps the rows each result table of a generated Flux
+// query may return, via a server-side limit(), protecting the plugin from
+// runaway result sets; a warning is logged when the cap is hit.
+func (r *Reader) SetMaxRowsPerQuery(n int) {
+	if n > 0 {
+		r.maxRowsPerQuery = n
+	}
+}
+
+// SetMaxServices caps the service listing at n names, applied server-side
+// inside the Flux query so an oversized fleet never decodes in full.
+func (r *Reader) SetMaxServices(n int) {
+	if n > 0 {
+		r.maxServices = n
+	}
+}
+
+// SetMetaQueryLookback bounds service and operation discovery queries to
+// the given lookback so they only scan recent shards; the services and
+// operations a deployment emits rarely change, and an unbounded tagValues
+// scan over all retained data is needlessly expensive.
+func (r *Reader) SetMetaQueryLookback(lookback time.Duration) {
+	if lookback > 0 {
+		r.metaQueryLookback = lookback
+	}
+}
+
+// SetFetchConcurrency fetches trace ID chunks with up to n concurrent Flux
+// queries, so large searches are not bound by one query at a time.
+func (r *Reader) SetFetchConcurrency(n int) {
+	if n > 0 {
+		r.fetchConcurrency = n
+	}
+}
+
+// SetMaxQueryWindow bounds the time range of a single trace ID query; longer
+// search windows are executed as a sequence of bounded sub-range queries so
+// that no single Flux query exceeds the server's query timeout.
+func (r *Reader) SetMaxQueryWindow(maxQueryWindow time.Duration) {
+	if maxQueryWindow > 0 {
+		r.maxQueryWindow = maxQueryWindow
+	}
+}
+
+// SetDependencyQueryChunk splits the dependency query's time window into
+// sub-windows of at most chunk, executed concurrently, so week-long lookbacks
+// are not one monolithic Flux query. References that straddle a sub-window
+// boundary fall outside the per-window join and are not counted.
+func (r *Reader) SetDependencyQueryChunk(chunk time.Duration) {
+	if chunk > 0 {
+		r.dependencyQueryChunk = chunk
+	}
+}
+
+// SetSkipSearchLogs omits the log measurement when FindTraces fetches its
+// matching traces, returning spans without logs; searches get much cheaper
+// and GetTrace still returns full logs. A search tagged skip-logs=true or
+// skip-logs=false overrides this default for one query.
+func (r *Reader) SetSkipSearchLogs() {
+	r.skipSearchLogs = true
+}
+
+// skipLogsForQuery reports whether span logs should be omitted for this
+// search: the reserved skip-logs search tag overrides the reader default.
+func (r *Reader) skipLogsForQuery(query *spanstore.TraceQueryParameters) bool {
+	if v, ok := query.Tags[common.SkipLogsTagKey]; ok {
+		return v == "true"
+	}
+	return r.skipSearchLogs
+}
+
+// SetLogQueries includes the full generated query text in the debug-level
+// query log; off by default because query text can contain tag values.
+func (r *Reader) SetLogQueries() {
+	r.logQueries = true
+}
+
+// SetTagQueriesWithRequestID prefixes each generated query with a comment
+// carrying the incoming request's trace context, so server-side query logs
+// can be tied back to the Jaeger request that caused them. Only queries made
+// on behalf of a traced request are tagged.
+func (r *Reader) SetTagQueriesWithRequestID() {
+	r.tagQueriesWithRequestID = true
+}
+
+// SetProfiling enables the server-side Flux query profiler on every query.
+// The profiler's scanned-data and plan-timing statistics are folded into the
+// per-operation statistics log and exported through SetMetricsFactory.
+func (r *Reader) SetProfiling() {
+	r.profiling = true
+}
+
+// SetMetricsFactory exports per-operation reader metrics (latency, error and
+// timeout counts, spans decoded) through the given factory, tagged by reader
+// operation. With SetProfiling the profiler's scanned-data and plan-timing
+// statistics are exported too.
+func (r *Reader) SetMetricsFactory(factory metrics.Factory) {
+	r.metricsFactory = factory
+}
+
+// SetSlowQueryThreshold logs any Flux query that takes longer than threshold
+// end to end, including its text, duration, and result row count, so
+// operators can spot pathological searches.
+func (r *Reader) SetSlowQueryThreshold(threshold time.Duration) {
+	if threshold > 0 {
+		r.slowQueryThreshold = threshold
+	}
+}
+
+// SetMaxLookback lets GetTrace widen its search window progressively beyond
+// the default lookback, up to this bound (typically the bucket's retention),
+// before concluding a trace does not exist.
+func (r *Reader) SetMaxLookback(maxLookback time.Duration) {
+	if maxLookback > 0 {
+		r.maxLookback = maxLookback
+	}
+}
+
+// SetReadConsistencyDelay excludes the last delay from search windows, so a
+// search does not return traces whose spans are still being written; spans
+// become queryable in InfluxDB shortly after ingest, not instantly. An
+// explicit StartTimeMax older than the delay is left untouched.
+func (r *Reader) SetReadConsistencyDelay(delay time.Duration) {
+	if delay > 0 {
+		r.readConsistencyDelay = delay
+	}
+}
+
+// SetGetTraceRetryDelay retries a not-found GetTrace once after the given
+// delay, absorbing the ingest-to-queryable gap when a trace is opened
+// immediately after being written.
+func (r *Reader) SetGetTraceRetryDelay(delay time.Duration) {
+	if delay > 0 {
+		r.getTraceRetryDelay = delay
+	}
+}
+
+// SetRetention records the bucket's retention period, so query time ranges
+// can be clamped to data that still exists. Safe to call concurrently with
+// queries; the store refreshes it periodically.
+func (r *Reader) SetRetention(retention time.Duration) {
+	atomic.StoreInt64(&r.retentionNanos, int64(retention))
+}
+
+// clampToRetention raises start to the bucket's retention boundary; data
+// before it has been expired, so scanning for it only wastes server work.
+func (r *Reader) clampToRetention(start time.Time) time.Time {
+	retention := time.Duration(atomic.LoadInt64(&r.retentionNanos))
+	if retention <= 0 {
+		return start
+	}
+	oldest := time.Now().Add(-retention)
+	if start.Before(oldest) {
+		r.logger.Warn("query start predates the bucket's retention; clamping",
+			"start", start, "retention", retention)
+		return oldest
+	}
+	return start
+}
+
+// SetTraceMemoryBudget bounds the bytes of spans and logs decoded from one
+// trace query; results that would exceed it come back truncated with a
+// warning instead of exhausting the process.
+func (r *Reader) SetTraceMemoryBudget(budget int64) {
+	r.traceMemoryBudget = budget
+}
+
+// SetQueryTemplates replaces built-in Flux queries with the loaded
+// operator-supplied templates.
+func (r *Reader) SetQueryTemplates(templates *QueryTemplates) {
+	r.templates = templates
+}
+
+// SetAdjusters configures the post-processing pipeline applied to every
+// trace returned by GetTrace and FindTraces.
+func (r *Reader) SetAdjusters(adjusters []dbmodel.Adjuster) {
+	r.adjusters = adjusters
+}
+
+// SetSearchFilter injects an operator-defined Flux predicate fragment into
+// every span query — searches and trace fetches alike — e.g. to partition a
+// shared bucket per deployment; validate it with dbmodel.ValidateFluxPredicate
+// first.
+func (r *Reader) SetSearchFilter(expr string) {
+	r.searchFilter = expr
+}
+
+// SetRegexTags interprets query tag values of the form ~/pattern/ as regular
+// expressions in trace searches.
+func (r *Reader) SetRegexTags() {
+	r.regexTags = true
+}
+
+// SetQueryTimeouts bounds each reader operation with its own context
+// deadline; zero durations leave the corresponding operation unbounded.
+func (r *Reader) SetQueryTimeouts(timeouts common.QueryTimeouts) {
+	r.timeouts = timeouts
+}
+
+// SetCircuitBreaker fails queries fast through the given breaker while
+// InfluxDB is unresponsive, instead of waiting out each query's timeout.
+func (r *Reader) SetCircuitBreaker(breaker *common.CircuitBreaker) {
+	r.breaker = breaker
+}
+
+// SetArchiveBucket retries trace lookups that miss the primary bucket in
+// the given archive bucket, so long-retention archived traces opened from
+// old links still resolve.
+func (r *Reader) SetArchiveBucket(bucket string) {
+	r.archiveBucket = bucket
+}
+
+// SetColdBuckets unions query results with the given long-retention buckets
+// (e.g. a downsampled cold tier) whenever the requested time range reaches
+// past the primary bucket's retention.
+func (r *Reader) SetColdBuckets(buckets []string) {
+	r.coldBuckets = buckets
+}
+
+// AddFederatedReader fans FindTraceIDs and GetServices out to reader —
+// typically one per additional (org, bucket, token) read target — merging its
+// results with the primary org's, for teams that write traces into separate
+// orgs but share one Jaeger UI. GetTrace and the span fetches behind
+// FindTraces still consult the primary org only.
+func (r *Reader) AddFederatedReader(reader *Reader) {
+	r.federated = append(r.federated, reader)
+}
+
+// searchBuckets returns the buckets a query starting at start must cover:
+// the primary bucket, plus the cold buckets once start predates the primary
+// bucket's retention (or when that retention is unknown).
+func (r *Reader) searchBuckets(start time.Time) []string {
+	buckets := []string{r.bucket}
+	if len(r.coldBuckets) == 0 {
+		return buckets
+	}
+	retention := time.Duration(atomic.LoadInt64(&r.retentionNanos))
+	if retention > 0 && !start.Before(time.Now().Add(-retention)) {
+		return buckets
+	}
+	return append(buckets, r.coldBuckets...)
+}
+
+// SetMaxConcurrentQueries caps the Flux queries in flight at once; excess
+// queries queue until a slot frees or their context expires, so a burst of
+// UI searches cannot overload a small InfluxDB instance.
+func (r *Reader) SetMaxConcurrentQueries(n int) {
+	if n > 0 {
+		r.querySem = make(chan struct{}, n)
+	}
+}
+
+// decodeBudget returns a fresh per-query budget, or nil when unbounded.
+func (r *Reader) decodeBudget() *dbmodel.DecodeBudget {
+	if r.traceMemoryBudget <= 0 {
+		return nil
+	}
+	return &dbmodel.DecodeBudget{MaxBytes: r.traceMemoryBudget}
+}
+
+// AddSchema registers an additional (e.g. pre-migration) measurement layout
+// to query alongside the primary schema, so that history written under an
+// old layout stays readable while a schema migration is in progress.
+func (r *Reader) AddSchema(spanMeasurement, logMeasurement string) {
+	r.schemas = append(r.schemas, dbmodel.Schema{
+		SpanMeasurement: spanMeasurement,
+		LogMeasurement:  logMeasurement,
+	})
+}
+
+// SetFlatSpanMeasurement makes the flat (pivot-free) schema under the given
+// measurement the primary layout; the default schema is demoted to a legacy
+// schema so spans written before the switch stay readable.
+func (r *Reader) SetFlatSpanMeasurement(spanMeasurement string) {
+	r.schemas = append([]dbmodel.Schema{
+		{SpanMeasurement: spanMeasurement, LogMeasurement: r.logMeasurement, Flat: true},
+	}, r.schemas...)
+}
+
+// SetSinglePointSpans marks the primary flat schema as single-point: logs
+// are embedded in the packed span field, so trace queries skip the log
+// measurement entirely. Requires SetFlatSpanMeasurement first.
+func (r *Reader) SetSinglePointSpans() {
+	if r.schemas[0].Flat {
+		r.schemas[0].SinglePoint = true
+	}
+}
+
+func (r *Reader) query(ctx context.Context, fluxQuery string) (itr flux.ResultIterator, err error) {
+	span, ctx := r.startClientSpan(ctx)
+	if span != nil {
+		defer func() {
+			// io.EOF signals an empty result, not a failure.
+			if err != nil && err != io.EOF {
+				ext.Error.Set(span, true)
+			}
+			span.Finish()
+		}()
+		if r.tagQueriesWithRequestID {
+			if id := spanRequestID(span); id != "" {
+				fluxQuery = "// request-id=" + id + "\n" + fluxQuery
+			}
+		}
+	}
+
+	if r.profiling {
+		fluxQuery = profilerHeader + fluxQuery
+	}
+
+	if r.logQueries {
+		r.logger.Debug("executing flux query", "org", r.orgID.String(), "bucket", r.bucket, "query", fluxQuery)
+	} else {
+		r.logger.Debug("executing flux query", "org", r.orgID.String(), "bucket", r.bucket)
+	}
+
+	if r.breaker != nil && !r.breaker.Allow(time.Now()) {
+		if fastFailures := r.breaker.FastFailures(); fastFailures == 1 || fastFailures%1000 == 0 {
+			r.logger.Warn("circuit breaker open; failing query fast", "fastFailures", fastFailures)
+		}
+		return nil, errors.New("InfluxDB circuit breaker is open")
+	}
+
+	if r.querySem != nil {
+		select {
+		case r.querySem <- struct{}{}:
+		default:
+			queued := atomic.AddUint64(&r.queuedQueries, 1)
+			if queued == 1 || queued%1000 == 0 {
+				r.logger.Warn("query concurrency limit reached; queuing query", "queued", queued)
+			}
+			select {
+			case r.querySem <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		defer func() { <-r.querySem }()
+	}
+
 	request := &query.Request{
 		OrganizationID: r.orgID,
 		Compiler:       lang.FluxCompiler{Query: fluxQuery},
 	}
 
-	return r.fluxQueryService.Query(ctx, request)
+	started := time.Now()
+	resultIterator, err := r.fluxQueryService.Query(ctx, request)
+	common.QueryStatsFromContext(ctx).ObserveQuery(time.Since(started))
+	if r.breaker != nil {
+		// io.EOF signals an empty result, not a server failure.
+		r.breaker.Observe(err != nil && err != io.EOF, time.Now())
+	}
+	if err == nil && r.profiling {
+		resultIterator = &profileIterator{
+			ResultIterator: resultIterator,
+			stats:          common.QueryStatsFromContext(ctx),
+		}
+	}
+	if err == nil && r.maxRowsPerQuery > 0 {
+		resultIterator = &rowCapIterator{
+			ResultIterator: resultIterator,
+			cap:            r.maxRowsPerQuery,
+			logger:         r.logger,
+			hits:           &r.rowCapHits,
+		}
+	}
+	if err == nil && r.slowQueryThreshold > 0 {
+		resultIterator = &slowQueryIterator{
+			ResultIterator: resultIterator,
+			logger:         r.logger,
+			fluxQuery:      fluxQuery,
+			threshold:      r.slowQueryThreshold,
+			started:        started,
+		}
+	}
+	return resultIterator, err
+}
+
+// QueryFlux exposes the reader's Flux query path to auxiliary readers, such
+// as the SPM metrics reader.
+func (r *Reader) QueryFlux(ctx context.Context, fluxQuery string) (flux.ResultIterator, error) {
+	return r.query(ctx, fluxQuery)
+}
+
+// statsContext ensures query statistics are collected for one reader call,
+// either into stats the caller attached or into a fresh set that is logged
+// by the returned func. The func records the operation's latency, outcome
+// and decode statistics into the per-operation metrics; pass it the
+// operation's final error.
+func (r *Reader) statsContext(ctx context.Context, operation string) (context.Context, func(error)) {
+	stats := common.QueryStatsFromContext(ctx)
+	if stats == nil {
+		stats = &common.QueryStats{}
+		ctx = common.ContextWithQueryStats(ctx, stats)
+	}
+	started := time.Now()
+	return ctx, func(err error) {
+		r.logger.Debug(operation+" statistics", stats.LogKV()...)
+		m := r.operationMetrics(operation)
+		if m == nil {
+			return
+		}
+		m.Latency.Record(time.Since(started))
+		switch {
+		case err == nil || err == spanstore.ErrTraceNotFound:
+			// An absent trace is a normal outcome, not a backend failure.
+		case err == context.DeadlineExceeded || errors.Cause(err) == context.DeadlineExceeded:
+			m.Timeouts.Inc(1)
+		default:
+			m.Errors.Inc(1)
+		}
+		m.SpansDecoded.Inc(stats.SpansDecoded())
+		m.ScannedValues.Inc(stats.ScannedValues())
+		m.ScannedBytes.Inc(stats.ScannedBytes())
+		m.PlanTime.Record(stats.PlanTime())
+		m.ExecuteTime.Record(stats.ExecuteTime())
+	}
 }
 
 const queryGetServicesFlux = `
@@ -66,23 +532,44 @@ import "influxdata/influxdb/v1"
 v1.measurementTagValues(bucket: "%s", measurement: "%s", tag: "%s")
 `
 
-// GetServices returns all services traced by Jaeger
-func (r *Reader) GetServices(ctx context.Context) ([]string, error) {
-	r.logger.Warn("GetServices called")
+// queryGetServicesLookbackFlux bounds service discovery to recent shards.
+// v1.measurementTagValues takes no range, so the underlying tagValues is
+// called directly.
+const queryGetServicesLookbackFlux = `
+import "influxdata/influxdb/v1"
+v1.tagValues(bucket: "%s", tag: "%s", predicate: (r) => r._measurement == "%s", start: %s)
+`
+
+// queryServicesLimitFlux caps the service listing server-side; sorting first
+// makes the cap deterministic rather than keeping an arbitrary subset.
+const queryServicesLimitFlux = ` |> sort(columns: ["_value"])
+ |> limit(n: %d)
+`
+
+// queryDistinctTagValuesFlux is the full-scan fallback when a tagValues
+// response hits the server's result limit: slower, but complete.
+const queryDistinctTagValuesFlux = `
+from(bucket: "%s")
+ |> range(start: %s)
+ |> filter(fn: (r) => %s)
+ |> keep(columns: ["%s"])
+ |> group()
+ |> distinct(column: "%s")
+`
 
-	resultIterator, err := r.query(ctx, fmt.Sprintf(queryGetServicesFlux, r.bucket, r.spanMetaMeasurement, common.ServiceNameKey))
+// distinctTagValues runs fluxQuery and returns the first column of each row.
+func (r *Reader) distinctTagValues(ctx context.Context, fluxQuery string) ([]string, error) {
+	resultIterator, err := r.query(ctx, fluxQuery)
 	if err != nil {
-		if err == io.EOF {
-			err = nil
-		}
 		return nil, err
 	}
-	var services []string
+
+	var values []string
 	for resultIterator.More() {
 		err = resultIterator.Next().Tables().Do(func(table flux.Table) error {
 			return table.Do(func(reader flux.ColReader) error {
 				for rowI := 0; rowI < reader.Len(); rowI++ {
-					services = append(services, reader.Strings(0).ValueString(rowI))
+					values = append(values, reader.Strings(0).ValueString(rowI))
 				}
 				return nil
 			})
@@ -92,54 +579,262 @@ func (r *Reader) GetServices(ctx context.Context) ([]string, error) {
 		}
 	}
 
+	return values, nil
+}
+
+// tagValuesWithFallback detects a truncated tagValues response (the result
+// filled the server's limit) and pages in the remainder with a full scan of
+// the measurement, so the set returned is always complete.
+func (r *Reader) tagValuesWithFallback(ctx context.Context, values []string, predicate, tag string) ([]string, error) {
+	if len(values) < common.TagValuesLimit {
+		return values, nil
+	}
+
+	truncations := atomic.AddUint64(&r.tagValuesTruncations, 1)
+	r.logger.Warn("tagValues response hit the result limit; falling back to a full scan",
+		"tag", tag, "truncations", truncations)
+
+	start := time.Now().Add(-r.defaultLookback).UTC().Format(time.RFC3339Nano)
+	fallback, err := r.distinctTagValues(ctx,
+		fmt.Sprintf(queryDistinctTagValuesFlux, r.bucket, start, predicate, tag, tag))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return append(values, fallback...), nil
+}
+
+// TagValuesTruncations returns how many tagValues responses hit the
+// server's result limit and required the full-scan fallback.
+func (r *Reader) TagValuesTruncations() uint64 {
+	return atomic.LoadUint64(&r.tagValuesTruncations)
+}
+
+// GetServices returns the services traced by Jaeger, sorted alphabetically
+// and deduped across schemas and federated orgs. SetMaxServices caps the
+// listing.
+func (r *Reader) GetServices(ctx context.Context) (services []string, err error) {
+	r.logger.Debug("GetServices called")
+
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.GetServices)
+	defer cancel()
+	ctx, finish := r.statsContext(ctx, "GetServices")
+	defer func() { finish(err) }()
+
+	// The primary schema indexes services in the meta measurement; legacy
+	// schemas predate it, so their span measurements are queried directly.
+	measurements := []string{r.spanMetaMeasurement}
+	for _, schema := range r.schemas[1:] {
+		measurements = append(measurements, schema.SpanMeasurement)
+	}
+
+	seen := make(map[string]struct{})
+	addServices := func(values []string) {
+		for _, service := range values {
+			if _, found := seen[service]; !found {
+				seen[service] = struct{}{}
+				services = append(services, service)
+			}
+		}
+	}
+	for _, measurement := range measurements {
+		q := fmt.Sprintf(queryGetServicesFlux, r.bucket, measurement, common.ServiceNameKey)
+		if r.metaQueryLookback > 0 {
+			q = fmt.Sprintf(queryGetServicesLookbackFlux, r.bucket, common.ServiceNameKey, measurement,
+				time.Now().Add(-r.metaQueryLookback).UTC().Format(time.RFC3339Nano))
+		}
+		if r.maxServices > 0 {
+			q += fmt.Sprintf(queryServicesLimitFlux, r.maxServices)
+		}
+		if r.templates != nil && r.templates.getServices != nil {
+			var err error
+			q, err = renderTemplate(r.templates.getServices, servicesTemplateData{
+				Bucket:      r.bucket,
+				Measurement: measurement,
+				Tag:         common.ServiceNameKey,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		values, err := r.distinctTagValues(ctx, q)
+		if err != nil {
+			if err == io.EOF {
+				continue
+			}
+			return nil, err
+		}
+		values, err = r.tagValuesWithFallback(ctx, values,
+			fmt.Sprintf(`r._measurement == "%s"`, measurement), common.ServiceNameKey)
+		if err != nil {
+			return nil, err
+		}
+		addServices(values)
+	}
+
+	// Federated orgs contribute their services too; one unreachable org
+	// degrades the listing rather than failing it.
+	for _, federated := range r.federated {
+		federatedServices, err := federated.GetServices(ctx)
+		if err != nil {
+			r.logger.Warn("federated GetServices failed", "error", err)
+			continue
+		}
+		addServices(federatedServices)
+	}
+
+	// Each source is capped and sorted individually; the union needs both
+	// applied again.
+	sort.Strings(services)
+	if r.maxServices > 0 && len(services) > r.maxServices {
+		services = services[:r.maxServices]
+	}
+
 	return services, nil
 }
 
 const queryGetOperationsFlux = `
 import "influxdata/influxdb/v1"
-v1.tagValues(bucket:"%s", tag:"%s", predicate: (r) => r._measurement=="%s" and r.%s=="%s")
+v1.tagValues(bucket:"%s", tag:"%s", predicate: (r) => r._measurement=="%s" and r.%s=="%s"%s)
 `
 
+// metaQueryStart returns the tagValues start argument bounding discovery
+// queries to the configured lookback, or the empty string to keep the
+// library default.
+func (r *Reader) metaQueryStart() string {
+	if r.metaQueryLookback <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(", start: %s", time.Now().Add(-r.metaQueryLookback).UTC().Format(time.RFC3339Nano))
+}
+
 // GetOperations returns all operations for a specific service traced by Jaeger
-func (r *Reader) GetOperations(ctx context.Context, param spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
-	r.logger.Warn("GetOperations called")
+func (r *Reader) GetOperations(ctx context.Context, param spanstore.OperationQueryParameters) (operations []spanstore.Operation, err error) {
+	ctx, finish := r.statsContext(ctx, "GetOperations")
+	defer func() { finish(err) }()
+	r.logger.Debug("GetOperations called")
 
-	q := fmt.Sprintf(queryGetOperationsFlux, r.bucket, common.OperationNameKey, r.spanMetaMeasurement, common.ServiceNameKey, param.ServiceName)
-	resultIterator, err := r.query(ctx, q)
+	q := fmt.Sprintf(queryGetOperationsFlux, r.bucket, common.OperationNameKey, r.spanMetaMeasurement, common.ServiceNameKey, dbmodel.EscapeFluxString(param.ServiceName), r.metaQueryStart())
+	if r.templates != nil && r.templates.getOperations != nil {
+		var err error
+		q, err = renderTemplate(r.templates.getOperations, operationsTemplateData{
+			Bucket:         r.bucket,
+			Tag:            common.OperationNameKey,
+			Measurement:    r.spanMetaMeasurement,
+			ServiceNameKey: common.ServiceNameKey,
+			ServiceName:    param.ServiceName,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	values, err := r.distinctTagValues(ctx, q)
 	if err != nil {
 		if err == io.EOF {
 			err = nil
 		}
 		return nil, err
 	}
+	values, err = r.tagValuesWithFallback(ctx, values,
+		fmt.Sprintf(`r._measurement == "%s" and r.%s == "%s"`, r.spanMetaMeasurement, common.ServiceNameKey, dbmodel.EscapeFluxString(param.ServiceName)),
+		common.OperationNameKey)
+	if err != nil {
+		return nil, err
+	}
 
-	var operations []spanstore.Operation
-	for resultIterator.More() {
-		err = resultIterator.Next().Tables().Do(func(table flux.Table) error {
-			return table.Do(func(reader flux.ColReader) error {
-				for rowI := 0; rowI < reader.Len(); rowI++ {
-					operations = append(operations, spanstore.Operation{
-						Name:     reader.Strings(0).ValueString(rowI),
-						SpanKind: param.SpanKind,
-					})
-				}
-				return nil
+	return r.operationsWithKinds(ctx, param, values)
+}
+
+// queryFindOperationsFlux lists a service's operation names whose value
+// contains a substring, filtered server-side.
+const queryFindOperationsFlux = `
+import "strings"
+import "influxdata/influxdb/v1"
+v1.tagValues(bucket:"%s", tag:"%s", predicate: (r) => r._measurement=="%s" and r.%s=="%s"%s)
+ |> filter(fn: (r) => strings.containsStr(v: r._value, substr: "%s"))
+`
+
+// FindOperations returns the service's operations whose name contains
+// substring. Large services record thousands of operations, and the
+// exact-match listing from GetOperations is unwieldy for them; searches can
+// get the same behavior with a "~substring" operation name.
+func (r *Reader) FindOperations(ctx context.Context, param spanstore.OperationQueryParameters, substring string) ([]spanstore.Operation, error) {
+	r.logger.Debug("FindOperations called")
+
+	q := fmt.Sprintf(queryFindOperationsFlux,
+		r.bucket, common.OperationNameKey, r.spanMetaMeasurement,
+		common.ServiceNameKey, dbmodel.EscapeFluxString(param.ServiceName),
+		r.metaQueryStart(), dbmodel.EscapeFluxString(substring))
+	values, err := r.distinctTagValues(ctx, q)
+	if err != nil {
+		if err == io.EOF {
+			err = nil
+		}
+		return nil, err
+	}
+
+	return r.operationsWithKinds(ctx, param, values)
+}
+
+// operationsWithKinds pairs each operation name with its recorded span
+// kinds, filtered by the query's kind, in the shape GetOperations returns.
+func (r *Reader) operationsWithKinds(ctx context.Context, param spanstore.OperationQueryParameters, values []string) ([]spanstore.Operation, error) {
+	kinds, err := r.operationKinds(ctx, param.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	operations := make([]spanstore.Operation, 0, len(values))
+	seen := make(map[string]struct{}, len(values))
+	for _, operation := range values {
+		if _, found := seen[operation]; found {
+			continue
+		}
+		seen[operation] = struct{}{}
+		operationKinds := kinds[operation]
+		if len(operationKinds) == 0 {
+			// Spans written before kinds were recorded; only visible when the
+			// caller does not filter by kind.
+			if param.SpanKind == "" {
+				operations = append(operations, spanstore.Operation{Name: operation})
+			}
+			continue
+		}
+		for _, kind := range operationKinds {
+			if param.SpanKind != "" && kind != param.SpanKind {
+				continue
+			}
+			operations = append(operations, spanstore.Operation{
+				Name:     operation,
+				SpanKind: kind,
 			})
-		})
-		if err != nil {
-			return nil, err
 		}
 	}
 
 	return operations, nil
 }
 
-// GetTrace takes a traceID and returns a Trace associated with that traceID
-func (r *Reader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
-	r.logger.Warn("GetTrace called")
+// queryOperationKindsFlux returns distinct "operation:kind" pairs recorded
+// in the span meta measurement.
+const queryOperationKindsFlux = `
+from(bucket: "%s")
+ |> range(start: %s)
+ |> filter(fn: (r) => r._measurement == "%s" and r.%s == "%s" and exists r.%s)
+ |> keep(columns: ["%s", "%s"])
+ |> group()
+ |> map(fn: (r) => ({_value: r.%s + ":" + r.%s}))
+ |> distinct(column: "_value")
+`
 
-	result, err := r.query(ctx,
-		dbmodel.NewFluxTraceQuery(r.bucket, r.spanMeasurement, r.logMeasurement, time.Now().Add(r.defaultLookback)).BuildTraceQuery([]model.TraceID{traceID}))
+// operationKinds returns the span kinds recorded for each of a service's
+// operations. Operations written before the span_kind meta tag existed are
+// absent from the result.
+func (r *Reader) operationKinds(ctx context.Context, service string) (map[string][]string, error) {
+	start := time.Now().Add(-r.defaultLookback).UTC().Format(time.RFC3339Nano)
+	values, err := r.distinctTagValues(ctx, fmt.Sprintf(queryOperationKindsFlux,
+		r.bucket, start, r.spanMetaMeasurement, common.ServiceNameKey, dbmodel.EscapeFluxString(service), common.SpanKindTagKey,
+		common.OperationNameKey, common.SpanKindTagKey,
+		common.OperationNameKey, common.SpanKindTagKey))
 	if err != nil {
 		if err == io.EOF {
 			err = nil
@@ -147,23 +842,310 @@ func (r *Reader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Tr
 		return nil, err
 	}
 
-	traces, err := dbmodel.TracesFromFluxResult(result, r.spanMeasurement, r.logMeasurement, r.logger)
+	kinds := make(map[string][]string)
+	for _, value := range values {
+		// Operation names may contain colons; the kind follows the last one.
+		i := strings.LastIndex(value, ":")
+		if i < 0 {
+			continue
+		}
+		operation, kind := value[:i], value[i+1:]
+		kinds[operation] = append(kinds[operation], kind)
+	}
+
+	return kinds, nil
+}
+
+// queryLinkedTraceIDsFlux finds traces whose spans carry a reference to the
+// given trace in the references field.
+const queryLinkedTraceIDsFlux = `
+import "strings"
+from(bucket: "%s")
+ |> range(start: %s, stop: %s)
+ |> filter(fn: (r) => r._measurement == "%s" and r._field == "%s")
+ |> filter(fn: (r) => strings.containsStr(v: r._value, substr: "%s") and r.%s != "%s")
+ |> keep(columns: ["%s"])
+ |> group()
+ |> distinct(column: "%s")
+`
+
+// FindLinkedTraceIDs returns the IDs of traces containing spans that
+// reference the given trace — or, when spanID is nonzero, that span
+// specifically — through cross-trace ChildOf/FollowsFrom references, so
+// async message chains can be followed across trace boundaries.
+func (r *Reader) FindLinkedTraceIDs(ctx context.Context, traceID model.TraceID, spanID model.SpanID, endTs time.Time, lookback time.Duration) ([]model.TraceID, error) {
+	r.logger.Debug("FindLinkedTraceIDs called")
+
+	// Cross-trace references are stored as "traceID:spanID:refType"; only
+	// the primary schema is searched, as with dependency aggregation.
+	needle := traceID.String() + ":"
+	if spanID != 0 {
+		needle += spanID.String() + ":"
+	}
+	field := common.ReferencesKey
+	if r.schemas[0].Flat {
+		field = common.FlatSpanKey
+	}
+
+	start := endTs.Add(-1 * lookback).UTC().Format(time.RFC3339Nano)
+	stop := endTs.UTC().Format(time.RFC3339Nano)
+	values, err := r.distinctTagValues(ctx, fmt.Sprintf(queryLinkedTraceIDsFlux,
+		r.bucket, start, stop, r.schemas[0].SpanMeasurement, field,
+		needle, common.TraceIDKey, traceID.String(),
+		common.TraceIDKey, common.TraceIDKey))
+	if err != nil {
+		if err == io.EOF {
+			err = nil
+		}
+		return nil, err
+	}
+
+	traceIDs := make([]model.TraceID, 0, len(values))
+	for _, value := range values {
+		linked, err := model.TraceIDFromString(value)
+		if err != nil {
+			return nil, err
+		}
+		traceIDs = append(traceIDs, linked)
+	}
+
+	return traceIDs, nil
+}
+
+// tracesFromSchemas executes a trace query against each configured schema in
+// each given bucket, and merges traces that are split across layouts or
+// buckets.
+func (r *Reader) tracesFromSchemas(ctx context.Context, buckets []string, buildQuery func(bucket string, schema dbmodel.Schema) string) ([]*model.Trace, error) {
+	var traces []*model.Trace
+	budget := r.decodeBudget()
+	for _, bucket := range buckets {
+		for _, schema := range r.schemas {
+			result, err := r.query(ctx, buildQuery(bucket, schema))
+			if err != nil {
+				if err == io.EOF {
+					continue
+				}
+				return nil, err
+			}
+			var schemaTraces []*model.Trace
+			decodeStarted := time.Now()
+			if schema.Flat {
+				schemaTraces, err = dbmodel.TracesFromFlatFluxResult(result, schema.SpanMeasurement, schema.LogMeasurement, r.logger)
+			} else {
+				schemaTraces, err = dbmodel.TracesFromFluxResultWithBudget(result, schema.SpanMeasurement, schema.LogMeasurement, budget, r.logger)
+			}
+			if err != nil {
+				return nil, err
+			}
+			spanCount := 0
+			for _, trace := range schemaTraces {
+				spanCount += len(trace.Spans)
+			}
+			common.QueryStatsFromContext(ctx).ObserveDecode(spanCount, len(schemaTraces), time.Since(decodeStarted))
+			traces = append(traces, schemaTraces...)
+			if budget.Exhausted() {
+				break
+			}
+		}
+		if budget.Exhausted() {
+			break
+		}
+	}
+
+	traces = dbmodel.MergeTraces(traces)
+	for _, trace := range traces {
+		dbmodel.ComputeTraceStatistics(trace)
+		for _, adjust := range r.adjusters {
+			adjust(trace)
+		}
+	}
+
+	return traces, nil
+}
+
+// StreamSpans fetches one trace and hands each schema's spans to fn as soon
+// as that schema's result is decoded, instead of accumulating the merged
+// trace in memory first. Spans duplicated across schemas (e.g. during a
+// migration dual-write window) are not deduplicated; the gRPC streaming
+// path accepts that in exchange for bounded memory.
+func (r *Reader) StreamSpans(ctx context.Context, traceID model.TraceID, fn func([]*model.Span) error) error {
+	r.logger.Debug("StreamSpans called")
+
+	var found bool
+	budget := r.decodeBudget()
+	for _, schema := range r.schemas {
+		tq := dbmodel.NewFluxTraceQuery(r.bucket, schema.SpanMeasurement, schema.LogMeasurement, time.Now().Add(-r.defaultLookback)).MaxRows(r.maxRowsPerQuery)
+		if r.searchFilter != "" {
+			tq.ExtraFilter(r.searchFilter)
+		}
+		var fluxQuery string
+		switch {
+		case schema.SinglePoint:
+			fluxQuery = tq.BuildSinglePointTraceQuery([]model.TraceID{traceID})
+		case schema.Flat:
+			fluxQuery = tq.BuildFlatTraceQuery([]model.TraceID{traceID})
+		default:
+			fluxQuery = tq.BuildTraceQuery([]model.TraceID{traceID})
+		}
+
+		result, err := r.query(ctx, fluxQuery)
+		if err != nil {
+			if err == io.EOF {
+				continue
+			}
+			return err
+		}
+		var schemaTraces []*model.Trace
+		if schema.Flat {
+			schemaTraces, err = dbmodel.TracesFromFlatFluxResult(result, schema.SpanMeasurement, schema.LogMeasurement, r.logger)
+		} else {
+			schemaTraces, err = dbmodel.TracesFromFluxResultWithBudget(result, schema.SpanMeasurement, schema.LogMeasurement, budget, r.logger)
+		}
+		if err != nil {
+			return err
+		}
+		for _, trace := range schemaTraces {
+			dbmodel.ComputeTraceStatistics(trace)
+			for _, adjust := range r.adjusters {
+				adjust(trace)
+			}
+			found = true
+			if err := fn(trace.Spans); err != nil {
+				return err
+			}
+		}
+		if budget.Exhausted() {
+			break
+		}
+	}
+
+	if !found {
+		return spanstore.ErrTraceNotFound
+	}
+	return nil
+}
+
+// GetTrace takes a traceID and returns a Trace associated with that traceID
+func (r *Reader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	return r.GetTraceWithTimeHints(ctx, traceID, time.Time{}, time.Time{})
+}
+
+// GetTraceWithTimeHints is GetTrace narrowed to the given span time bounds,
+// for callers on the newer storage API that carries them with the trace ID.
+// With hints the query ranges over exactly the hinted window instead of
+// scanning the default lookback; zero bounds fall back to the lookback with
+// progressive widening.
+func (r *Reader) GetTraceWithTimeHints(ctx context.Context, traceID model.TraceID, startTime, endTime time.Time) (trace *model.Trace, err error) {
+	r.logger.Debug("GetTrace called")
+
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.GetTrace)
+	defer cancel()
+	ctx, finish := r.statsContext(ctx, "GetTrace")
+	defer func() { finish(err) }()
+
+	hinted := !startTime.IsZero()
+
+	buildQuery := func(start time.Time) func(bucket string, schema dbmodel.Schema) string {
+		return func(bucket string, schema dbmodel.Schema) string {
+			bucketStart := start
+			if bucket == r.bucket {
+				// Cold and archive buckets outlive the primary retention.
+				bucketStart = r.clampToRetention(bucketStart)
+			}
+			tq := dbmodel.NewFluxTraceQuery(bucket, schema.SpanMeasurement, schema.LogMeasurement, bucketStart).MaxRows(r.maxRowsPerQuery)
+			if hinted && !endTime.IsZero() {
+				tq.StartTimeMax(endTime)
+			}
+			if r.searchFilter != "" {
+				tq.ExtraFilter(r.searchFilter)
+			}
+			if schema.SinglePoint {
+				return tq.BuildSinglePointTraceQuery([]model.TraceID{traceID})
+			}
+			if schema.Flat {
+				return tq.BuildFlatTraceQuery([]model.TraceID{traceID})
+			}
+			return tq.BuildTraceQuery([]model.TraceID{traceID})
+		}
+	}
+
+	// Cold buckets join the union automatically once the window reaches
+	// past the primary bucket's retention.
+	lookback := r.defaultLookback
+	start := time.Now().Add(-lookback)
+	if hinted {
+		start = startTime
+	}
+	traces, err := r.tracesFromSchemas(ctx, r.searchBuckets(start), buildQuery(start))
 	if err != nil {
 		return nil, err
 	}
+
+	// Older traces silently disappear behind a fixed lookback; widen the
+	// window progressively, up to maxLookback, before giving up. Hinted
+	// lookups skip this: the caller already knows where the trace lives.
+	for len(traces) == 0 && !hinted && lookback < r.maxLookback {
+		lookback *= 4
+		if lookback > r.maxLookback {
+			lookback = r.maxLookback
+		}
+		start = time.Now().Add(-lookback)
+		r.logger.Warn("trace not found; widening lookback", "lookback", lookback)
+		traces, err = r.tracesFromSchemas(ctx, r.searchBuckets(start), buildQuery(start))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(traces) == 0 && r.archiveBucket != "" {
+		r.logger.Warn("trace not found in primary bucket; trying the archive bucket", "bucket", r.archiveBucket)
+		traces, err = r.tracesFromSchemas(ctx, []string{r.archiveBucket}, buildQuery(start))
+		if err != nil {
+			return nil, err
+		}
+	}
+	// A trace queried right after ingest may simply not be queryable yet;
+	// give the server one chance to catch up before reporting not-found.
+	if len(traces) == 0 && r.getTraceRetryDelay > 0 {
+		r.logger.Warn("trace not found; retrying once after read-consistency delay", "delay", r.getTraceRetryDelay)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(r.getTraceRetryDelay):
+		}
+		traces, err = r.tracesFromSchemas(ctx, r.searchBuckets(start), buildQuery(start))
+		if err != nil {
+			return nil, err
+		}
+	}
 	if len(traces) == 0 {
 		return nil, spanstore.ErrTraceNotFound
 	}
 	if len(traces) > 1 {
-		panic("more than one trace returned, expected exactly one; bug in query?")
+		// Spans straddling measurement or bucket boundaries can come back as
+		// separate traces; combine them rather than failing the lookup.
+		r.logger.Warn("GetTrace returned more than one trace; merging", "traces", len(traces))
+		merged := dbmodel.MergeTraceSpans(traces)
+		dbmodel.ComputeTraceStatistics(merged)
+		return merged, nil
 	}
 
 	return traces[0], nil
 }
 
 // FindTraces retrieve traces that match the traceQuery
-func (r *Reader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
-	r.logger.Warn("FindTraces called")
+func (r *Reader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) (traces []*model.Trace, err error) {
+	r.logger.Debug("FindTraces called")
+
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.FindTraces)
+	defer cancel()
+	ctx, finish := r.statsContext(ctx, "FindTraces")
+	defer func() { finish(err) }()
+
+	query, err = dbmodel.NormalizeTraceQueryParams(query, r.defaultLookback)
+	if err != nil {
+		return nil, err
+	}
 
 	traceIDs, err := r.FindTraceIDs(ctx, query)
 	if err != nil {
@@ -172,32 +1154,497 @@ func (r *Reader) FindTraces(ctx context.Context, query *spanstore.TraceQueryPara
 	if len(traceIDs) == 0 {
 		return nil, nil
 	}
+	if query.NumTraces > 0 && len(traceIDs) > query.NumTraces {
+		traceIDs = traceIDs[:query.NumTraces]
+	}
 
-	tq := dbmodel.NewFluxTraceQuery(r.bucket, r.spanMeasurement, r.logMeasurement, query.StartTimeMin)
-	if !query.StartTimeMax.IsZero() {
-		tq.StartTimeMax(query.StartTimeMax)
+	var chunks [][]model.TraceID
+	for len(traceIDs) > 0 {
+		n := r.maxTraceIDsPerQuery
+		if len(traceIDs) < n {
+			n = len(traceIDs)
+		}
+		chunks = append(chunks, traceIDs[:n])
+		traceIDs = traceIDs[n:]
 	}
-	result, err := r.query(ctx, tq.BuildTraceQuery(traceIDs))
-	if err != nil {
-		if err == io.EOF {
-			err = nil
+
+	// Chunks are fetched by a bounded worker pool; results keep chunk order
+	// so pagination over the ID list stays stable.
+	concurrency := r.fetchConcurrency
+	if concurrency <= 1 || len(chunks) == 1 {
+		concurrency = 1
+	}
+	chunkTraces := make([][]*model.Trace, len(chunks))
+	chunkErrs := make([]error, len(chunks))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range chunks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, chunk []model.TraceID) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			chunkTraces[i], chunkErrs[i] = r.tracesFromSchemas(ctx, r.searchBuckets(query.StartTimeMin), func(bucket string, schema dbmodel.Schema) string {
+				tq := dbmodel.NewFluxTraceQuery(bucket, schema.SpanMeasurement, schema.LogMeasurement, query.StartTimeMin).MaxRows(r.maxRowsPerQuery)
+				if r.searchFilter != "" {
+					tq.ExtraFilter(r.searchFilter)
+				}
+				if !query.StartTimeMax.IsZero() {
+					tq.StartTimeMax(query.StartTimeMax)
+				}
+				if r.skipLogsForQuery(query) {
+					tq.SkipLogs()
+				}
+				if schema.SinglePoint {
+					return tq.BuildSinglePointTraceQuery(chunk)
+				}
+				if schema.Flat {
+					return tq.BuildFlatTraceQuery(chunk)
+				}
+				return tq.BuildTraceQuery(chunk)
+			})
+		}(i, chunks[i])
+	}
+	wg.Wait()
+
+	for i := range chunks {
+		if chunkErrs[i] != nil {
+			return nil, chunkErrs[i]
 		}
+		traces = append(traces, chunkTraces[i]...)
+	}
+
+	return traces, nil
+}
+
+// FindTraceIDs retrieve traceIDs that match the traceQuery
+func (r *Reader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) (traceIDs []model.TraceID, err error) {
+	r.logger.Debug("FindTraceIDs called")
+
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.FindTraceIDs)
+	defer cancel()
+	ctx, finish := r.statsContext(ctx, "FindTraceIDs")
+	defer func() { finish(err) }()
+
+	query, err = dbmodel.NormalizeTraceQueryParams(query, r.defaultLookback)
+	if err != nil {
 		return nil, err
 	}
-	traces, err := dbmodel.TracesFromFluxResult(result, r.spanMeasurement, r.logMeasurement, r.logger)
+
+	// With cold buckets configured the window past the primary retention is
+	// still searchable, so the clamp only applies to a single-bucket setup.
+	if len(r.coldBuckets) == 0 {
+		if clamped := r.clampToRetention(query.StartTimeMin); !clamped.Equal(query.StartTimeMin) {
+			clampedQuery := *query
+			clampedQuery.StartTimeMin = clamped
+			query = &clampedQuery
+		}
+	}
+
+	// Freshly ingested spans are not queryable yet; keep the window clear of
+	// them so searches don't return partial traces.
+	if r.readConsistencyDelay > 0 {
+		cutoff := time.Now().Add(-r.readConsistencyDelay)
+		if query.StartTimeMax.After(cutoff) && cutoff.After(query.StartTimeMin) {
+			delayedQuery := *query
+			delayedQuery.StartTimeMax = cutoff
+			query = &delayedQuery
+		}
+	}
+
+	// Slice long search windows into bounded sub-range queries, newest first,
+	// stopping early once NumTraces IDs have been found.
+	if r.maxQueryWindow > 0 && query.StartTimeMax.Sub(query.StartTimeMin) > r.maxQueryWindow {
+		traceIDs, err := r.windowedTraceIDs(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		return r.withFederatedTraceIDs(ctx, query, traceIDs)
+	}
+
+	traceIDs, err = r.findTraceIDsOnce(ctx, query)
 	if err != nil {
 		return nil, err
 	}
+	return r.withFederatedTraceIDs(ctx, query, traceIDs)
+}
 
-	return traces, nil
+// windowedTraceIDs executes the trace ID query as sub-range queries of at
+// most maxQueryWindow each, newest window first, merging and deduplicating
+// the IDs client-side. Windows run in batches of up to fetchConcurrency
+// concurrent Flux queries — Flux degrades sharply on huge range() spans, and
+// the parallel windows use multiple server query slots — while results merge
+// in window order so newer traces still rank first, and the batch boundary
+// preserves the early stop once NumTraces IDs have been found.
+func (r *Reader) windowedTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	var windows []time.Time
+	for windowMax := query.StartTimeMax; windowMax.After(query.StartTimeMin); windowMax = windowMax.Add(-r.maxQueryWindow) {
+		windows = append(windows, windowMax)
+	}
+
+	concurrency := r.fetchConcurrency
+	if concurrency <= 1 {
+		concurrency = 1
+	}
+
+	var traceIDs []model.TraceID
+	seen := make(map[model.TraceID]struct{})
+	for len(windows) > 0 {
+		batch := windows
+		if len(batch) > concurrency {
+			batch = batch[:concurrency]
+		}
+		windows = windows[len(batch):]
+
+		batchIDs := make([][]model.TraceID, len(batch))
+		batchErrs := make([]error, len(batch))
+		var wg sync.WaitGroup
+		for i := range batch {
+			wg.Add(1)
+			go func(i int, windowMax time.Time) {
+				defer wg.Done()
+				windowMin := windowMax.Add(-r.maxQueryWindow)
+				if windowMin.Before(query.StartTimeMin) {
+					windowMin = query.StartTimeMin
+				}
+				window := *query
+				window.StartTimeMin = windowMin
+				window.StartTimeMax = windowMax
+				batchIDs[i], batchErrs[i] = r.findTraceIDsOnce(ctx, &window)
+			}(i, batch[i])
+		}
+		wg.Wait()
+
+		for i := range batch {
+			if batchErrs[i] != nil {
+				return nil, batchErrs[i]
+			}
+			for _, traceID := range batchIDs[i] {
+				if _, found := seen[traceID]; !found {
+					seen[traceID] = struct{}{}
+					traceIDs = append(traceIDs, traceID)
+				}
+			}
+		}
+
+		if query.NumTraces > 0 && len(traceIDs) >= query.NumTraces {
+			return traceIDs[:query.NumTraces], nil
+		}
+	}
+	return traceIDs, nil
 }
 
-// FindTraceIDs retrieve traceIDs that match the traceQuery
-func (r *Reader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
-	r.logger.Warn("FindTraceIDs called")
+// withFederatedTraceIDs merges the trace IDs found by federated org readers
+// into traceIDs; an unreachable org degrades the search rather than failing
+// it.
+func (r *Reader) withFederatedTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters, traceIDs []model.TraceID) ([]model.TraceID, error) {
+	if len(r.federated) == 0 {
+		return traceIDs, nil
+	}
+
+	seen := make(map[model.TraceID]struct{}, len(traceIDs))
+	for _, traceID := range traceIDs {
+		seen[traceID] = struct{}{}
+	}
+	for _, federated := range r.federated {
+		federatedIDs, err := federated.FindTraceIDs(ctx, query)
+		if err != nil {
+			r.logger.Warn("federated trace search failed", "error", err)
+			continue
+		}
+		for _, traceID := range federatedIDs {
+			if _, found := seen[traceID]; !found {
+				seen[traceID] = struct{}{}
+				traceIDs = append(traceIDs, traceID)
+			}
+		}
+	}
+
+	if query.NumTraces > 0 && len(traceIDs) > query.NumTraces {
+		traceIDs = traceIDs[:query.NumTraces]
+	}
+	return traceIDs, nil
+}
+
+// findTraceIDsOnce executes the trace ID query for a single time window
+// against every configured schema, in every bucket the window reaches.
+func (r *Reader) findTraceIDsOnce(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	var traceIDs []model.TraceID
+	seen := make(map[model.TraceID]struct{})
+	for _, bucket := range r.searchBuckets(query.StartTimeMin) {
+		for _, schema := range r.schemas {
+			q := dbmodel.FluxTraceQueryFromTQP(bucket, schema.SpanMeasurement, schema.LogMeasurement, query).MaxRows(r.maxRowsPerQuery)
+			if r.searchFilter != "" {
+				q.ExtraFilter(r.searchFilter)
+			}
+			if r.regexTags {
+				q.RegexTags()
+			}
+			fluxQuery := q.BuildTraceIDQuery()
+			if r.templates != nil && r.templates.findTraceIDs != nil {
+				var err error
+				fluxQuery, err = renderTemplate(r.templates.findTraceIDs, q.TraceIDQueryTemplateData())
+				if err != nil {
+					return nil, err
+				}
+			}
+			result, err := r.query(ctx, fluxQuery)
+			if err != nil {
+				if err == io.EOF {
+					continue
+				}
+				return nil, err
+			}
+
+			schemaTraceIDs, err := dbmodel.TraceIDsFromFluxResult(result)
+			if err != nil {
+				return nil, err
+			}
+			for _, traceID := range schemaTraceIDs {
+				if _, found := seen[traceID]; !found {
+					seen[traceID] = struct{}{}
+					traceIDs = append(traceIDs, traceID)
+				}
+			}
+		}
+	}
+
+	// Each schema's Flux query is limited individually; cap the union too so
+	// callers never fetch more traces than were asked for.
+	if query.NumTraces > 0 && len(traceIDs) > query.NumTraces {
+		traceIDs = traceIDs[:query.NumTraces]
+	}
+
+	return traceIDs, nil
+}
+
+// FindTraceIDsByPrefix returns the IDs of traces whose hex trace ID starts
+// with prefix, covering the default lookback in every searchable bucket.
+// Log lines often carry only a shortened trace ID; this resolves the short
+// form to the full IDs it could denote. The prefix is matched against the
+// stored encoding, so 128-bit IDs need their leading zeros included.
+func (r *Reader) FindTraceIDsByPrefix(ctx context.Context, prefix string) ([]model.TraceID, error) {
+	r.logger.Debug("FindTraceIDsByPrefix called")
+
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.FindTraceIDs)
+	defer cancel()
+
+	prefix = strings.ToLower(prefix)
+	if len(prefix) == 0 || len(prefix) > 32 {
+		return nil, errors.Errorf("trace ID prefix must be 1-32 characters, got %d", len(prefix))
+	}
+	// The prefix is embedded in a Flux regular expression; restricting it to
+	// hex digits also keeps Flux metacharacters out of the query.
+	for _, c := range prefix {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return nil, errors.Errorf("trace ID prefix contains non-hex character %q", c)
+		}
+	}
+
+	start := time.Now().Add(-r.defaultLookback)
+	var traceIDs []model.TraceID
+	seen := make(map[model.TraceID]struct{})
+	for _, bucket := range r.searchBuckets(start) {
+		for _, schema := range r.schemas {
+			fluxQuery := fmt.Sprintf(traceIDsByPrefixQueryFlux,
+				bucket, start.UTC().Format(time.RFC3339Nano),
+				schema.SpanMeasurement, prefix)
+			result, err := r.query(ctx, fluxQuery)
+			if err != nil {
+				if err == io.EOF {
+					continue
+				}
+				return nil, err
+			}
+
+			schemaTraceIDs, err := dbmodel.TraceIDsFromFluxResult(result)
+			if err != nil {
+				return nil, err
+			}
+			for _, traceID := range schemaTraceIDs {
+				if _, found := seen[traceID]; !found {
+					seen[traceID] = struct{}{}
+					traceIDs = append(traceIDs, traceID)
+				}
+			}
+		}
+	}
+
+	return traceIDs, nil
+}
 
-	q := dbmodel.FluxTraceQueryFromTQP(r.bucket, r.spanMeasurement, r.logMeasurement, query)
-	result, err := r.query(ctx, q.BuildTraceIDQuery())
+// traceIDsByPrefixQueryFlux matches the trace ID tag against an anchored
+// prefix regex; unique() dedupes server-side while keeping the trace ID
+// column that TraceIDsFromFluxResult decodes.
+var traceIDsByPrefixQueryFlux = fmt.Sprintf(`
+from(bucket: "%%s")
+ |> range(start: %%s)
+ |> filter(fn: (r) => r.%s == "%%s" and r.%s =~ /^%%s/)
+ |> keep(columns: ["%s"])
+ |> group()
+ |> unique(column: "%s")
+`, common.MeasurementKey, common.TraceIDKey,
+	common.TraceIDKey,
+	common.TraceIDKey)
+
+// getDependenciesQueryFlux self-joins spans on the referenced parent span ID
+// and counts calls per (parent service, child service) pair server-side, so
+// only the aggregated links cross the wire. Only a span's first reference is
+// considered, and cross-trace references (which carry a leading trace ID)
+// drop out of the join.
+var getDependenciesQueryFlux = fmt.Sprintf(`
+import "strings"
+
+spans = from(bucket: "%%s")
+ |> range(start: %%s, stop: %%s)
+ |> filter(fn: (r) => r._measurement == "%%s" and (r._field == "%s" or r._field == "%s"))
+ |> pivot(rowKey:["_time"], columnKey: ["_field"], valueColumn: "_value")
+ |> group()
+
+parents = spans
+ |> keep(columns: ["%s", "%s"])
+ |> rename(columns: {%s: "%s"})
+
+children = spans
+ |> filter(fn: (r) => exists r.%s)
+ |> map(fn: (r) => ({%s: r.%s, ref: strings.split(v: r.%s, t: ",")[0]}))
+ |> filter(fn: (r) => strings.hasSuffix(v: r.ref, suffix: ":%s"))
+ |> map(fn: (r) => ({%s: r.%s, %s: strings.split(v: r.ref, t: ":")[0]}))
+
+join(tables: {p: parents, c: children}, on: ["%s"])
+ |> group(columns: ["%s", "%s"])
+ |> count(column: "%s")
+ |> rename(columns: {%s: "%s"})
+ |> group()
+`,
+	common.SpanIDKey, common.ReferencesKey,
+	common.SpanIDKey, common.ServiceNameKey,
+	common.ServiceNameKey, common.DependencyParentKey,
+	common.ReferencesKey,
+	common.DependencyChildKey, common.ServiceNameKey, common.ReferencesKey,
+	common.ReferenceTypeChildOf,
+	common.DependencyChildKey, common.DependencyChildKey, common.SpanIDKey,
+	common.SpanIDKey,
+	common.DependencyParentKey, common.DependencyChildKey,
+	common.SpanIDKey,
+	common.SpanIDKey, common.DependencyCallCountKey)
+
+// The flat schema needs no pivot; each span row already carries the packed
+// field holding the span ID and references.
+var getDependenciesFlatQueryFlux = fmt.Sprintf(`
+from(bucket: "%%s")
+ |> range(start: %%s, stop: %%s)
+ |> filter(fn: (r) => r._measurement == "%%s" and r._field == "%s")
+ |> group()
+ |> keep(columns: ["%s", "%s"])
+`, "span", "_value", "service_name")
+
+// GetDependencies returns all inter-service dependencies. The
+// dependencystore.Reader interface predates context; callers that have one
+// should use GetDependenciesWithContext instead.
+func (r *Reader) GetDependencies(endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	return r.GetDependenciesWithContext(context.Background(), endTs, lookback)
+}
+
+// GetDependenciesWithContext is GetDependencies honoring the caller's context.
+func (r *Reader) GetDependenciesWithContext(ctx context.Context, endTs time.Time, lookback time.Duration) (links []model.DependencyLink, err error) {
+	ctx, finish := r.statsContext(ctx, "GetDependencies")
+	defer func() { finish(err) }()
+	r.logger.Debug("GetDependencies called")
+
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.GetDependencies)
+	defer cancel()
+
+	startTime := r.clampToRetention(endTs.Add(-1 * lookback))
+	if r.dependencyQueryChunk > 0 && endTs.Sub(startTime) > r.dependencyQueryChunk {
+		return r.chunkedDependencies(ctx, startTime, endTs)
+	}
+	return r.dependenciesWindow(ctx, startTime, endTs)
+}
+
+// chunkedDependencies slices [startTime, endTs) into sub-windows of at most
+// the configured chunk, queries them with up to fetchConcurrency concurrent
+// Flux queries, and merges the links with summed call counts.
+func (r *Reader) chunkedDependencies(ctx context.Context, startTime, endTs time.Time) ([]model.DependencyLink, error) {
+	var windows []time.Time
+	for t := startTime; t.Before(endTs); t = t.Add(r.dependencyQueryChunk) {
+		windows = append(windows, t)
+	}
+
+	concurrency := r.fetchConcurrency
+	if concurrency <= 1 {
+		concurrency = 1
+	}
+	windowLinks := make([][]model.DependencyLink, len(windows))
+	windowErrs := make([]error, len(windows))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range windows {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			stop := windows[i].Add(r.dependencyQueryChunk)
+			if stop.After(endTs) {
+				stop = endTs
+			}
+			windowLinks[i], windowErrs[i] = r.dependenciesWindow(ctx, windows[i], stop)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range windows {
+		if windowErrs[i] != nil {
+			return nil, windowErrs[i]
+		}
+	}
+	return dbmodel.MergeDependencyLinks(windowLinks...), nil
+}
+
+// dependenciesWindow runs one dependency query over [startTime, endTs).
+func (r *Reader) dependenciesWindow(ctx context.Context, startTime, endTs time.Time) ([]model.DependencyLink, error) {
+	start := startTime.UTC().Format(time.RFC3339Nano)
+	stop := endTs.UTC().Format(time.RFC3339Nano)
+
+	// As with the default schema, only the primary layout is aggregated.
+	if r.schemas[0].Flat {
+		resultIterator, err := r.query(ctx,
+			fmt.Sprintf(getDependenciesFlatQueryFlux, r.bucket, start, stop, r.schemas[0].SpanMeasurement))
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return nil, err
+		}
+
+		return dbmodel.DependencyLinksFromFlatResultV2(resultIterator)
+	}
+
+	// Operator templates produce raw span rows, which are still aggregated
+	// client-side; the built-in query aggregates in InfluxDB.
+	if r.templates != nil && r.templates.getDependencies != nil {
+		q, err := renderTemplate(r.templates.getDependencies, dependenciesTemplateData{
+			Bucket:      r.bucket,
+			Measurement: r.spanMeasurement,
+			Start:       start,
+			Stop:        stop,
+		})
+		if err != nil {
+			return nil, err
+		}
+		resultIterator, err := r.query(ctx, q)
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return nil, err
+		}
+		return dbmodel.DependencyLinksFromResultV2(resultIterator)
+	}
+
+	resultIterator, err := r.query(ctx,
+		fmt.Sprintf(getDependenciesQueryFlux, r.bucket, start, stop, r.spanMeasurement))
 	if err != nil {
 		if err == io.EOF {
 			err = nil
@@ -205,25 +1652,35 @@ func (r *Reader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryPa
 		return nil, err
 	}
 
-	return dbmodel.TraceIDsFromFluxResult(result)
+	return dbmodel.DependencyLinksFromJoinResultV2(resultIterator)
 }
 
-var getDependenciesQueryFlux = fmt.Sprintf(`
+// As getDependenciesQueryFlux, widened with the duration field and the error
+// tag so per-edge statistics can be derived.
+var getDependencyStatsQueryFlux = fmt.Sprintf(`
 from(bucket: "%%s")
  |> range(start: %%s, stop: %%s)
- |> filter(fn: (r) => r._measurement == "%%s" and (r._field == "%s" or r._field == "%s"))
+ |> filter(fn: (r) => r._measurement == "%%s" and (r._field == "%s" or r._field == "%s" or r._field == "%s"))
  |> pivot(rowKey:["_time"], columnKey: ["_field"], valueColumn: "_value")
  |> group()
- |> keep(columns: ["%s", "%s", "%s"])
-`, "span_id", "references", "span_id", "references", "service_name")
+ |> keep(columns: ["%s", "%s", "%s", "%s", "%s"])
+`, "span_id", "references", "duration", "span_id", "references", "duration", "service_name", "error")
 
-// GetDependencies returns all inter-service dependencies
-func (r *Reader) GetDependencies(endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
-	r.logger.Warn("GetDependencies called")
+// GetDependencyLinkStats returns inter-service dependencies annotated with
+// per-edge latency percentiles and error ratios. As with GetDependencies,
+// only the primary layout is aggregated; the flat layout is not supported.
+func (r *Reader) GetDependencyLinkStats(endTs time.Time, lookback time.Duration) ([]dbmodel.DependencyLinkStats, error) {
+	r.logger.Debug("GetDependencyLinkStats called")
+
+	if r.schemas[0].Flat {
+		return nil, errors.New("dependency link statistics are not supported with the flat span layout")
+	}
+
+	start := endTs.Add(-1 * lookback).UTC().Format(time.RFC3339Nano)
+	stop := endTs.UTC().Format(time.RFC3339Nano)
 
 	resultIterator, err := r.query(context.TODO(),
-		fmt.Sprintf(getDependenciesQueryFlux,
-			r.bucket, endTs.Add(-1*lookback).UTC().Format(time.RFC3339Nano), endTs.UTC().Format(time.RFC3339Nano), r.spanMeasurement))
+		fmt.Sprintf(getDependencyStatsQueryFlux, r.bucket, start, stop, r.spanMeasurement))
 	if err != nil {
 		if err == io.EOF {
 			err = nil
@@ -231,5 +1688,17 @@ func (r *Reader) GetDependencies(endTs time.Time, lookback time.Duration) ([]mod
 		return nil, err
 	}
 
-	return dbmodel.DependencyLinksFromResultV2(resultIterator)
+	return dbmodel.DependencyLinkStatsFromResultV2(resultIterator)
+}
+
+// GetDependencyPaths returns the transitive caller and callee paths through
+// the given service, each path bounded by maxDepth hops.
+func (r *Reader) GetDependencyPaths(endTs time.Time, lookback time.Duration, service string, maxDepth int) (upstream, downstream []dbmodel.DependencyPath, err error) {
+	links, err := r.GetDependencies(endTs, lookback)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dbmodel.UpstreamDependencyPaths(links, service, maxDepth),
+		dbmodel.DownstreamDependencyPaths(links, service, maxDepth), nil
 }
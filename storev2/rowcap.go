@@ -0,0 +1,69 @@
+package storev2
+
+import (
+	"sync/atomic"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/influxdata/flux"
+)
+
+// rowCapIterator watches each table of a query result and warns when a
+// table's row count reaches the configured cap, since the server-side
+// limit() truncates silently.
+type rowCapIterator struct {
+	flux.ResultIterator
+	cap    int
+	logger hclog.Logger
+	hits   *uint64
+}
+
+func (itr *rowCapIterator) Next() flux.Result {
+	return &rowCapResult{Result: itr.ResultIterator.Next(), itr: itr}
+}
+
+// tableCapped records one table that filled the row cap, warning with the
+// usual once-then-every-thousandth cadence.
+func (itr *rowCapIterator) tableCapped() {
+	hits := atomic.AddUint64(itr.hits, 1)
+	if hits == 1 || hits%1000 == 0 {
+		itr.logger.Warn("flux query row cap reached; results may be truncated",
+			"cap", itr.cap, "hits", hits)
+	}
+}
+
+type rowCapResult struct {
+	flux.Result
+	itr *rowCapIterator
+}
+
+func (r *rowCapResult) Tables() flux.TableIterator {
+	return &rowCapTables{TableIterator: r.Result.Tables(), itr: r.itr}
+}
+
+type rowCapTables struct {
+	flux.TableIterator
+	itr *rowCapIterator
+}
+
+func (t *rowCapTables) Do(f func(flux.Table) error) error {
+	return t.TableIterator.Do(func(tbl flux.Table) error {
+		return f(&rowCapTable{Table: tbl, itr: t.itr})
+	})
+}
+
+type rowCapTable struct {
+	flux.Table
+	itr  *rowCapIterator
+	rows int
+}
+
+func (t *rowCapTable) Do(f func(flux.ColReader) error) error {
+	err := t.Table.Do(func(cr flux.ColReader) error {
+		t.rows += cr.Len()
+		return f(cr)
+	})
+	if err == nil && t.rows >= t.itr.cap {
+		t.itr.tableCapped()
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package storev2
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/influxdata/flux"
+)
+
+// slowQueryIterator wraps a query result so that, once the caller releases
+// it, queries that ran longer than the configured threshold are logged with
+// their text, duration, and row count. The duration includes decode time,
+// since results stream from the response body as the caller iterates.
+type slowQueryIterator struct {
+	flux.ResultIterator
+
+	logger    hclog.Logger
+	fluxQuery string
+	threshold time.Duration
+	started   time.Time
+
+	rows    int64
+	logOnce sync.Once
+}
+
+func (itr *slowQueryIterator) Next() flux.Result {
+	return &slowQueryResult{Result: itr.ResultIterator.Next(), itr: itr}
+}
+
+func (itr *slowQueryIterator) Release() {
+	itr.ResultIterator.Release()
+	itr.logOnce.Do(func() {
+		elapsed := time.Since(itr.started)
+		if elapsed < itr.threshold {
+			return
+		}
+		itr.logger.Warn("slow flux query",
+			"duration", elapsed.String(), "threshold", itr.threshold.String(),
+			"rows", itr.rows, "query", itr.fluxQuery)
+	})
+}
+
+type slowQueryResult struct {
+	flux.Result
+	itr *slowQueryIterator
+}
+
+func (r *slowQueryResult) Tables() flux.TableIterator {
+	return &slowQueryTables{TableIterator: r.Result.Tables(), itr: r.itr}
+}
+
+type slowQueryTables struct {
+	flux.TableIterator
+	itr *slowQueryIterator
+}
+
+func (t *slowQueryTables) Do(f func(flux.Table) error) error {
+	return t.TableIterator.Do(func(tbl flux.Table) error {
+		return f(&slowQueryTable{Table: tbl, itr: t.itr})
+	})
+}
+
+type slowQueryTable struct {
+	flux.Table
+	itr *slowQueryIterator
+}
+
+func (t *slowQueryTable) Do(f func(flux.ColReader) error) error {
+	return t.Table.Do(func(cr flux.ColReader) error {
+		t.itr.rows += int64(cr.Len())
+		return f(cr)
+	})
+}
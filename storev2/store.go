@@ -3,15 +3,23 @@ package storev2
 import (
 	"context"
 	"io"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/influxdata/influxdb"
+	"github.com/influxdata/jaeger-influxdb/canary"
 	"github.com/influxdata/jaeger-influxdb/common"
 	"github.com/influxdata/jaeger-influxdb/config"
+	"github.com/influxdata/jaeger-influxdb/dbmodel"
 	"github.com/influxdata/jaeger-influxdb/influx2http"
+	"github.com/influxdata/jaeger-influxdb/quality"
+	"github.com/influxdata/jaeger-influxdb/spm"
 	"github.com/jaegertracing/jaeger/plugin/storage/grpc/shared"
 	"github.com/jaegertracing/jaeger/storage/dependencystore"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/pkg/errors"
+	"github.com/uber/jaeger-lib/metrics"
 )
 
 var (
@@ -20,26 +28,153 @@ var (
 )
 
 type Store struct {
-	reader *Reader
-	writer *Writer
+	reader        *Reader
+	spanReader    spanstore.Reader
+	writer        *Writer
+	spanWriter    spanstore.Writer
+	depReader     dependencystore.Reader
+	staleReader   *common.StaleMetadataReader
+	metadataCache *common.MetadataCachingReader
+	analyzer      *quality.Analyzer
+	emitter       *spm.Emitter
+	metricsReader *spm.Reader
+	canary        *canary.Canary
+	retentionStop chan struct{}
 }
 
+// retentionRefreshInterval is how often the bucket's retention period is
+// re-read, so an operator shortening retention is picked up without a
+// restart.
+const retentionRefreshInterval = time.Hour
+
 func NewStore(conf *config.Configuration, logger hclog.Logger) (*Store, func() error, error) {
 	orgID, err := findOrgID(context.TODO(), conf.Host, conf.Token, conf.Organization)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	bucketID, err := findBucketID(context.TODO(), conf.Host, conf.Token, orgID, conf.Bucket)
+	bucket, err := findBucket(context.TODO(), conf.Host, conf.Token, orgID, conf.Bucket)
 	if err != nil {
 		return nil, nil, err
 	}
+	bucketID := bucket.ID
 
 	fluxQueryService := &influx2http.FluxQueryService{
-		Addr:  conf.Host,
-		Token: conf.Token,
+		Addr:             conf.Host,
+		Token:            conf.Token,
+		MaxResponseBytes: conf.MaxResponseBytes,
+		MaxRetries:       conf.QueryRetries,
+		RetryLogger:      logger,
+		FastDecoder:      conf.FastCSVDecoder,
+		HedgeAddr:        conf.HedgeAddr,
+		HedgeDelay:       conf.HedgeDelay,
 	}
 	reader := NewReader(fluxQueryService, orgID, conf.Bucket, common.DefaultSpanMeasurement, common.DefaultSpanMetaMeasurement, common.DefaultLogMeasurement, conf.DefaultLookback, logger)
+	reader.SetMaxTraceIDsPerQuery(conf.MaxTraceIDsPerQuery)
+	reader.SetMaxRowsPerQuery(conf.MaxRowsPerQuery)
+	reader.SetMaxServices(conf.MaxServices)
+	reader.SetMetaQueryLookback(conf.MetaQueryLookback)
+	reader.SetMaxQueryWindow(conf.MaxQueryWindow)
+	reader.SetMaxLookback(conf.MaxLookback)
+	reader.SetRetention(bucket.RetentionPeriod)
+	reader.SetFetchConcurrency(conf.TraceFetchConcurrency)
+	reader.SetDependencyQueryChunk(conf.DependencyQueryChunk)
+	reader.SetSlowQueryThreshold(conf.SlowQueryThreshold)
+	reader.SetReadConsistencyDelay(conf.ReadConsistencyDelay)
+	reader.SetGetTraceRetryDelay(conf.GetTraceRetryDelay)
+	if conf.TraceMemoryBudget > 0 {
+		reader.SetTraceMemoryBudget(conf.TraceMemoryBudget)
+	}
+	for i, spanAlias := range conf.SpanMeasurementAliases {
+		logAlias := common.DefaultLogMeasurement
+		if i < len(conf.LogMeasurementAliases) {
+			logAlias = conf.LogMeasurementAliases[i]
+		}
+		reader.AddSchema(spanAlias, logAlias)
+	}
+	if conf.FluxTemplateDir != "" {
+		templates, err := LoadQueryTemplates(conf.FluxTemplateDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader.SetQueryTemplates(templates)
+	}
+	if len(conf.Adjusters) > 0 {
+		adjusters, err := dbmodel.NewAdjusterPipeline(conf.Adjusters, conf.ClockSkewMaxAdjust)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader.SetAdjusters(adjusters)
+	}
+	if conf.RegexTags {
+		reader.SetRegexTags()
+	}
+	if conf.LogQueries {
+		reader.SetLogQueries()
+	}
+	if conf.TagQueriesWithRequestID {
+		reader.SetTagQueriesWithRequestID()
+	}
+	if conf.FluxProfiling {
+		reader.SetProfiling()
+	}
+	if conf.SkipSearchLogs {
+		reader.SetSkipSearchLogs()
+	}
+	reader.SetQueryTimeouts(common.QueryTimeouts{
+		GetTrace:        conf.GetTraceTimeout,
+		FindTraceIDs:    conf.FindTraceIDsTimeout,
+		FindTraces:      conf.FindTracesTimeout,
+		GetServices:     conf.GetServicesTimeout,
+		GetDependencies: conf.GetDependenciesTimeout,
+	})
+	if conf.CircuitBreakerThreshold > 0 {
+		reader.SetCircuitBreaker(common.NewCircuitBreaker(conf.CircuitBreakerThreshold, conf.CircuitBreakerCoolDown))
+	}
+	reader.SetMaxConcurrentQueries(conf.MaxConcurrentQueries)
+	if conf.ArchiveBucket != "" {
+		reader.SetArchiveBucket(conf.ArchiveBucket)
+	}
+	if len(conf.ColdBuckets) > 0 {
+		reader.SetColdBuckets(conf.ColdBuckets)
+	}
+	for _, target := range conf.FederatedReadTargets {
+		// Tokens are base64, so the colon is safe as a separator.
+		parts := strings.SplitN(target, ":", 3)
+		if len(parts) != 3 {
+			return nil, nil, errors.Errorf("malformed federated read target '%s': expected org:bucket:token", target)
+		}
+		federatedOrgID, err := findOrgID(context.TODO(), conf.Host, parts[2], parts[0])
+		if err != nil {
+			return nil, nil, errors.WithMessagef(err, "failed to resolve federated read target org '%s'", parts[0])
+		}
+		federatedQueryService := &influx2http.FluxQueryService{
+			Addr:             conf.Host,
+			Token:            parts[2],
+			MaxResponseBytes: conf.MaxResponseBytes,
+			MaxRetries:       conf.QueryRetries,
+			RetryLogger:      logger,
+			FastDecoder:      conf.FastCSVDecoder,
+		}
+		reader.AddFederatedReader(NewReader(federatedQueryService, federatedOrgID, parts[1],
+			common.DefaultSpanMeasurement, common.DefaultSpanMetaMeasurement, common.DefaultLogMeasurement,
+			conf.DefaultLookback, logger))
+	}
+	if conf.SearchFilterFlux != "" {
+		if err := dbmodel.ValidateFluxPredicate(conf.SearchFilterFlux); err != nil {
+			return nil, nil, err
+		}
+		reader.SetSearchFilter(conf.SearchFilterFlux)
+	}
+	if conf.FlatSpanMeasurement != "" {
+		reader.SetFlatSpanMeasurement(conf.FlatSpanMeasurement)
+	}
+	if conf.SinglePointSpans {
+		if conf.FlatSpanMeasurement == "" {
+			return nil, nil, errors.New("single-point-spans requires flat-span-measurement")
+		}
+		reader.SetSinglePointSpans()
+	}
 
 	writeService := &influx2http.WriteService{
 		Addr:      conf.Host,
@@ -47,29 +182,239 @@ func NewStore(conf *config.Configuration, logger hclog.Logger) (*Store, func() e
 		Precision: "ns",
 	}
 	writer := NewWriter(writeService, orgID, bucketID, common.DefaultSpanMeasurement, common.DefaultSpanMetaMeasurement, common.DefaultLogMeasurement, logger)
+	writer.SetChecksums(conf.SpanChecksums)
+	writer.SetFlushPolicy(conf.WriteFlushPoints, conf.WriteFlushInterval)
+	if conf.WriteQueueSize > 0 {
+		switch conf.WriteQueuePolicy {
+		case "", common.QueuePolicyBlock, common.QueuePolicyDropNew, common.QueuePolicyDropOld:
+		default:
+			return nil, nil, errors.Errorf("unrecognized write-queue-policy '%s'", conf.WriteQueuePolicy)
+		}
+		writer.SetWriteQueue(common.NewWriteQueue(conf.WriteQueueSize, conf.WriteQueuePolicy))
+	}
+	if conf.WALDir != "" {
+		wal, err := common.NewWriteWAL(conf.WALDir, conf.WALSegmentBytes, conf.WALMaxBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		writer.SetWAL(wal)
+	}
+	if conf.FlatSpanMeasurement != "" {
+		writer.SetFlatSpanMeasurement(conf.FlatSpanMeasurement)
+	}
+	if conf.SinglePointSpans {
+		maxLogBytes := conf.MaxEmbeddedLogBytes
+		if maxLogBytes <= 0 {
+			maxLogBytes = common.DefaultMaxEmbeddedLogBytes
+		}
+		writer.SetSinglePointSpans(maxLogBytes)
+		if conf.LogCompressionThreshold > 0 {
+			writer.SetLogCompressionThreshold(conf.LogCompressionThreshold)
+		}
+	}
+	switch conf.CollisionStrategy {
+	case "", common.CollisionStrategyJitter:
+	case common.CollisionStrategySpanIDTag:
+		writer.SetCollisionStrategy(conf.CollisionStrategy)
+	default:
+		return nil, nil, errors.Errorf("unrecognized collision-strategy '%s'", conf.CollisionStrategy)
+	}
+	if conf.CollisionDetectionCacheSize > 0 {
+		writer.SetCollisionDetector(common.NewCollisionDetector(conf.CollisionDetectionCacheSize))
+	}
+	if conf.WriteRateLimit > 0 {
+		writer.SetRateLimiter(common.NewWriteRateLimiter(conf.WriteRateLimit, conf.WriteRateBurst))
+	}
+	if conf.WriteQuotaPointsPerDay > 0 || conf.WriteQuotaBytesPerDay > 0 {
+		writer.SetWriteQuota(common.NewWriteQuota(conf.WriteQuotaPointsPerDay, conf.WriteQuotaBytesPerDay, conf.WriteQuotaSampleRate))
+	}
+	if conf.DedupeCacheSize > 0 {
+		writer.SetDeduper(common.NewWriteDeduper(conf.DedupeCacheSize))
+	}
+	if conf.WriteLagThreshold > 0 {
+		writer.SetLagWatchdog(common.NewWriteLagWatchdog(conf.WriteLagThreshold, logger))
+	}
+	if conf.WriteBackpressure {
+		writer.SetPacer(common.NewWritePacer())
+	}
 
 	store := &Store{
-		reader: reader,
-		writer: writer,
+		reader:     reader,
+		spanReader: reader,
+		writer:     writer,
+		spanWriter: writer,
+		depReader:  reader,
+	}
+	if conf.StaleMetadataFallback {
+		staleReader := common.NewStaleMetadataReader(reader, logger)
+		if conf.MetadataSnapshotFile != "" {
+			interval := conf.MetadataSnapshotInterval
+			if interval <= 0 {
+				interval = common.DefaultMetadataSnapshotInterval
+			}
+			staleReader.PersistSnapshots(conf.MetadataSnapshotFile, interval)
+		}
+		if conf.MetadataRefreshInterval > 0 {
+			staleReader.RefreshInBackground(conf.MetadataRefreshInterval)
+		}
+		store.spanReader = staleReader
+		store.depReader = staleReader
+		store.staleReader = staleReader
+	}
+	// The decryptor sits beneath the caches so a cached trace is decrypted
+	// exactly once before the caches share it; decryptTrace mutates spans in
+	// place, and the caches hand the same trace to concurrent callers.
+	if conf.EncryptionKey != "" && len(conf.EncryptTags) > 0 {
+		keyProvider, err := common.NewStaticKeyProvider(conf.EncryptionKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		tagCipher, err := common.NewTagCipher(keyProvider, conf.EncryptTags)
+		if err != nil {
+			return nil, nil, err
+		}
+		store.spanWriter = common.NewEncryptingWriter(store.spanWriter, tagCipher)
+		store.spanReader = common.NewDecryptingReader(store.spanReader, tagCipher)
+	}
+	if conf.SearchCacheTTL > 0 {
+		store.spanReader = common.NewSearchCachingReader(store.spanReader, conf.SearchCacheTTL)
+	}
+	if conf.TraceCacheTTL > 0 {
+		traceCache := common.NewTraceCachingReader(store.spanReader, conf.TraceCacheTTL, conf.TraceCacheMaxBytes)
+		if conf.TraceCacheNegativeTTL > 0 {
+			traceCache.SetNegativeTTL(conf.TraceCacheNegativeTTL)
+		}
+		store.spanReader = traceCache
+	}
+	if conf.MetadataCacheTTL > 0 {
+		metadataCache := common.NewMetadataCachingReader(store.spanReader, conf.MetadataCacheTTL, conf.MetadataCacheSize)
+		if conf.MetadataWarmInterval > 0 {
+			metadataCache.WarmInBackground(conf.MetadataWarmInterval, logger)
+		}
+		store.spanReader = metadataCache
+		store.metadataCache = metadataCache
+	}
+	if conf.AccessPolicyFile != "" {
+		policy, err := common.LoadAccessPolicy(conf.AccessPolicyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		store.spanReader = common.NewAuthorizedReader(store.spanReader, policy)
+	}
+	if conf.AuditLog {
+		store.spanReader = common.NewAuditedReader(store.spanReader, logger)
 	}
 
+	if conf.TraceQualityInterval > 0 {
+		store.analyzer = quality.NewAnalyzer(reader, writer, common.DefaultTraceQualityMeasurement, conf.TraceQualityInterval, logger)
+	}
+	if conf.SpanMetricsInterval > 0 {
+		store.emitter = spm.NewEmitter(writer, common.DefaultSpanMetricsMeasurement, conf.SpanMetricsInterval, logger)
+		writer.SetMetricsEmitter(store.emitter)
+	}
+	metricsReader := spm.NewReader(reader, conf.Bucket, common.DefaultSpanMetricsMeasurement, logger)
+	switch conf.SpanMetricsSource {
+	case "", spm.SourceSpans:
+	case spm.SourceOtel:
+		metricsReader.SetOtelMetricsSource()
+	default:
+		return nil, nil, errors.Errorf("unrecognized span-metrics-source '%s'", conf.SpanMetricsSource)
+	}
+	store.metricsReader = metricsReader
+	if conf.CanaryInterval > 0 {
+		store.canary = canary.NewCanary(reader, store.spanWriter, conf.CanaryInterval, logger)
+	}
+
+	store.retentionStop = make(chan struct{})
+	go func() {
+		t := time.NewTicker(retentionRefreshInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-store.retentionStop:
+				return
+			case <-t.C:
+				b, err := findBucket(context.Background(), conf.Host, conf.Token, orgID, conf.Bucket)
+				if err != nil {
+					logger.Warn("failed to refresh bucket retention", "error", err)
+					continue
+				}
+				reader.SetRetention(b.RetentionPeriod)
+			}
+		}
+	}()
+
 	return store, store.Close, nil
 }
 
 func (s *Store) Close() error {
+	if s.canary != nil {
+		if err := s.canary.Close(); err != nil {
+			return err
+		}
+	}
+	if s.analyzer != nil {
+		if err := s.analyzer.Close(); err != nil {
+			return err
+		}
+	}
+	if s.emitter != nil {
+		if err := s.emitter.Close(); err != nil {
+			return err
+		}
+	}
+	if s.staleReader != nil {
+		if err := s.staleReader.Close(); err != nil {
+			return err
+		}
+	}
+	if s.metadataCache != nil {
+		if err := s.metadataCache.Close(); err != nil {
+			return err
+		}
+	}
+	if s.retentionStop != nil {
+		close(s.retentionStop)
+	}
 	return s.writer.Close()
 }
 
+// FlushMetadataCaches discards the named metadata cache ("services",
+// "operations", "dependencies", or "all"); no-op unless the stale metadata
+// fallback is enabled.
+func (s *Store) FlushMetadataCaches(name string) {
+	if s.staleReader != nil {
+		s.staleReader.Flush(name)
+	}
+}
+
 func (s *Store) SpanReader() spanstore.Reader {
-	return s.reader
+	return s.spanReader
 }
 
 func (s *Store) SpanWriter() spanstore.Writer {
-	return s.writer
+	return s.spanWriter
 }
 
 func (s *Store) DependencyReader() dependencystore.Reader {
-	return s.reader
+	return s.depReader
+}
+
+// MetricsReader serves the RED metrics behind the Jaeger Monitor tab.
+func (s *Store) MetricsReader() *spm.Reader {
+	return s.metricsReader
+}
+
+// CheckHealth reports whether the store can currently serve queries; see
+// Reader.CheckHealth.
+func (s *Store) CheckHealth(ctx context.Context) error {
+	return s.reader.CheckHealth(ctx)
+}
+
+// SetMetricsFactory exports reader statistics through the given factory,
+// e.g. a Prometheus-backed one; pair it with flux-profiling.
+func (s *Store) SetMetricsFactory(factory metrics.Factory) {
+	s.reader.SetMetricsFactory(factory)
 }
 
 func findOrgID(ctx context.Context, host, token, org string) (influxdb.ID, error) {
@@ -88,16 +433,20 @@ func findOrgID(ctx context.Context, host, token, org string) (influxdb.ID, error
 	return o.ID, nil
 }
 
-func findBucketID(ctx context.Context, host, token string, orgID influxdb.ID, bucket string) (influxdb.ID, error) {
+func findBucket(ctx context.Context, host, token string, orgID influxdb.ID, bucket string) (*influxdb.Bucket, error) {
 	svc := &influx2http.BucketService{
 		Addr:  host,
 		Token: token,
 	}
 
-	b, err := svc.FindBucket(ctx, influxdb.BucketFilter{
+	return svc.FindBucket(ctx, influxdb.BucketFilter{
 		Name:           &bucket,
 		OrganizationID: &orgID,
 	})
+}
+
+func findBucketID(ctx context.Context, host, token string, orgID influxdb.ID, bucket string) (influxdb.ID, error) {
+	b, err := findBucket(ctx, host, token, orgID, bucket)
 	if err != nil {
 		return influxdb.InvalidID(), err
 	}
@@ -0,0 +1,111 @@
+package storev2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/influxdata/jaeger-influxdb/dbmodel"
+	"github.com/pkg/errors"
+)
+
+// File names looked up in the template directory; each is optional and
+// replaces the corresponding built-in Flux query when present.
+const (
+	templateGetServices     = "get-services.flux"
+	templateGetOperations   = "get-operations.flux"
+	templateFindTraceIDs    = "find-trace-ids.flux"
+	templateGetDependencies = "get-dependencies.flux"
+)
+
+// servicesTemplateData is the placeholder set of a get-services template.
+type servicesTemplateData struct {
+	Bucket      string
+	Measurement string
+	Tag         string
+}
+
+// operationsTemplateData is the placeholder set of a get-operations template.
+type operationsTemplateData struct {
+	Bucket         string
+	Tag            string
+	Measurement    string
+	ServiceNameKey string
+	ServiceName    string
+}
+
+// dependenciesTemplateData is the placeholder set of a get-dependencies
+// template.
+type dependenciesTemplateData struct {
+	Bucket      string
+	Measurement string
+	Start       string
+	Stop        string
+}
+
+// QueryTemplates holds operator-supplied Flux templates that replace the
+// built-in metadata and search queries, for installations with custom
+// schemas or hand-tuned queries that previously required a fork. Templates
+// use text/template placeholders and are validated at load time, so a typo
+// fails at startup rather than on the first query.
+type QueryTemplates struct {
+	getServices     *template.Template
+	getOperations   *template.Template
+	findTraceIDs    *template.Template
+	getDependencies *template.Template
+}
+
+// LoadQueryTemplates reads the known template files from dir; missing files
+// leave the corresponding built-in query in place.
+func LoadQueryTemplates(dir string) (*QueryTemplates, error) {
+	t := &QueryTemplates{}
+
+	var err error
+	if t.getServices, err = loadTemplate(dir, templateGetServices, servicesTemplateData{}); err != nil {
+		return nil, err
+	}
+	if t.getOperations, err = loadTemplate(dir, templateGetOperations, operationsTemplateData{}); err != nil {
+		return nil, err
+	}
+	if t.findTraceIDs, err = loadTemplate(dir, templateFindTraceIDs, dbmodel.TraceIDQueryTemplateData{}); err != nil {
+		return nil, err
+	}
+	if t.getDependencies, err = loadTemplate(dir, templateGetDependencies, dependenciesTemplateData{}); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// loadTemplate parses one template file and validates its placeholders by
+// rendering it against the zero value of its data type.
+func loadTemplate(dir, name string, sampleData interface{}) (*template.Template, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read flux template '%s'", name)
+	}
+
+	t, err := template.New(name).Option("missingkey=error").Parse(string(contents))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse flux template '%s'", name)
+	}
+	if err := t.Execute(&strings.Builder{}, sampleData); err != nil {
+		return nil, errors.Wrapf(err, "flux template '%s' references unknown placeholders", name)
+	}
+
+	return t, nil
+}
+
+// renderTemplate executes one validated template with live query data.
+func renderTemplate(t *template.Template, data interface{}) (string, error) {
+	var builder strings.Builder
+	if err := t.Execute(&builder, data); err != nil {
+		return "", errors.Wrapf(err, "failed to render flux template '%s'", t.Name())
+	}
+	return builder.String(), nil
+}
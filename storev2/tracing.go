@@ -0,0 +1,45 @@
+package storev2
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// clientSpanOperation names the client span wrapped around each Flux query
+// when the incoming Jaeger request is itself traced.
+const clientSpanOperation = "influxdb-flux-query"
+
+// jaegerTraceContextKey is the TextMap carrier key under which the Jaeger
+// tracer encodes its trace context; its value doubles as the request ID
+// tagged onto generated queries.
+const jaegerTraceContextKey = "uber-trace-id"
+
+// startClientSpan starts a client span for one Flux query as a child of the
+// trace context on ctx, so the plugin's own queries show up in self-tracing
+// and the HTTP layer injects the span's headers into the InfluxDB request.
+// When the incoming request carries no trace context it returns a nil span
+// and ctx unchanged.
+func (r *Reader) startClientSpan(ctx context.Context) (opentracing.Span, context.Context) {
+	parent := opentracing.SpanFromContext(ctx)
+	if parent == nil {
+		return nil, ctx
+	}
+	span := parent.Tracer().StartSpan(clientSpanOperation, opentracing.ChildOf(parent.Context()))
+	ext.SpanKindRPCClient.Set(span)
+	ext.DBType.Set(span, "influxdb")
+	ext.DBInstance.Set(span, r.bucket)
+	return span, opentracing.ContextWithSpan(ctx, span)
+}
+
+// spanRequestID returns the span's encoded trace context, suitable for
+// tagging a generated query so server-side query logs can be tied back to
+// the Jaeger request; empty when the tracer does not expose one.
+func spanRequestID(span opentracing.Span) string {
+	carrier := opentracing.TextMapCarrier{}
+	if err := span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier); err != nil {
+		return ""
+	}
+	return carrier[jaegerTraceContextKey]
+}
@@ -0,0 +1,114 @@
+package storev3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/influxdata/jaeger-influxdb/dbmodel"
+	"github.com/influxdata/jaeger-influxdb/influx2http"
+)
+
+const (
+	querySQLPath = "/api/v3/query_sql"
+	writeLPPath  = "/api/v3/write_lp"
+)
+
+// SQLService runs SQL queries and line protocol writes against the InfluxDB
+// 3.x HTTP API.
+type SQLService struct {
+	Addr               string
+	Token              string
+	Database           string
+	InsecureSkipVerify bool
+}
+
+type sqlQueryRequest struct {
+	Database string `json:"db"`
+	Query    string `json:"q"`
+	Format   string `json:"format"`
+}
+
+// Query runs a SQL query and returns the response rows. Numeric columns are
+// decoded as json.Number so nanosecond values survive intact.
+func (s *SQLService) Query(ctx context.Context, sqlQuery string) ([]dbmodel.SQLRow, error) {
+	u, err := influx2http.NewURL(s.Addr, querySQLPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(sqlQueryRequest{
+		Database: s.Database,
+		Query:    sqlQuery,
+		Format:   "jsonl",
+	}); err != nil {
+		return nil, err
+	}
+
+	hreq, err := http.NewRequest("POST", u.String(), &body)
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Authorization", "Bearer "+s.Token)
+	hreq.Header.Set("Content-Type", "application/json")
+	hreq = hreq.WithContext(ctx)
+
+	hc := influx2http.NewClient(u.Scheme, s.InsecureSkipVerify)
+	resp, err := hc.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := influx2http.CheckError(resp); err != nil {
+		return nil, err
+	}
+
+	var rows []dbmodel.SQLRow
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	for {
+		var row dbmodel.SQLRow
+		if err := decoder.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// Write sends a line protocol batch to the database.
+func (s *SQLService) Write(ctx context.Context, lineProtocol io.Reader) error {
+	u, err := influx2http.NewURL(s.Addr, writeLPPath)
+	if err != nil {
+		return err
+	}
+	params := url.Values{}
+	params.Set("db", s.Database)
+	params.Set("precision", "nanosecond")
+	u.RawQuery = params.Encode()
+
+	hreq, err := http.NewRequest("POST", u.String(), lineProtocol)
+	if err != nil {
+		return err
+	}
+	hreq.Header.Set("Authorization", "Bearer "+s.Token)
+	hreq.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	hreq = hreq.WithContext(ctx)
+
+	hc := influx2http.NewClient(u.Scheme, s.InsecureSkipVerify)
+	resp, err := hc.Do(hreq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return influx2http.CheckError(resp)
+}
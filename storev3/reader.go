@@ -0,0 +1,247 @@
+package storev3
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/influxdata/jaeger-influxdb/common"
+	"github.com/influxdata/jaeger-influxdb/dbmodel"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+)
+
+var _ spanstore.Reader = (*Reader)(nil)
+
+// Reader can query for and load traces from InfluxDB 3.x.
+type Reader struct {
+	client              *SQLService
+	spanMeasurement     string
+	spanMetaMeasurement string
+	defaultLookback     time.Duration
+	adjusters           []dbmodel.Adjuster
+	logQueries          bool
+	timeouts            common.QueryTimeouts
+
+	logger hclog.Logger
+}
+
+// NewReader returns a new SpanReader for InfluxDB 3.x.
+func NewReader(client *SQLService, spanMeasurement, spanMetaMeasurement string, defaultLookback time.Duration, logger hclog.Logger) *Reader {
+	return &Reader{
+		client:              client,
+		spanMeasurement:     spanMeasurement,
+		spanMetaMeasurement: spanMetaMeasurement,
+		defaultLookback:     defaultLookback,
+		logger:              logger,
+	}
+}
+
+// SetAdjusters configures the post-processing pipeline applied to every
+// trace returned by GetTrace and FindTraces.
+func (r *Reader) SetAdjusters(adjusters []dbmodel.Adjuster) {
+	r.adjusters = adjusters
+}
+
+// SetLogQueries includes the full generated query text in the debug-level
+// query log; off by default because query text can contain tag values.
+func (r *Reader) SetLogQueries() {
+	r.logQueries = true
+}
+
+// SetQueryTimeouts bounds each reader operation with its own context
+// deadline; zero durations leave the corresponding operation unbounded.
+func (r *Reader) SetQueryTimeouts(timeouts common.QueryTimeouts) {
+	r.timeouts = timeouts
+}
+
+func (r *Reader) query(ctx context.Context, sqlQuery string) ([]dbmodel.SQLRow, error) {
+	if r.logQueries {
+		r.logger.Debug("executing SQL query", "database", r.client.Database, "query", sqlQuery)
+	} else {
+		r.logger.Debug("executing SQL query", "database", r.client.Database)
+	}
+
+	return r.client.Query(ctx, sqlQuery)
+}
+
+// GetServices returns all services traced by Jaeger
+func (r *Reader) GetServices(ctx context.Context) ([]string, error) {
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.GetServices)
+	defer cancel()
+
+	rows, err := r.query(ctx, fmt.Sprintf(`SELECT DISTINCT "%s" FROM "%s"`,
+		common.ServiceNameKey, r.spanMetaMeasurement))
+	if err != nil {
+		return nil, err
+	}
+
+	var services []string
+	for _, row := range rows {
+		if service, ok := row[common.ServiceNameKey].(string); ok && service != "" {
+			services = append(services, service)
+		}
+	}
+
+	return services, nil
+}
+
+// GetOperations returns all operations for a specific service traced by Jaeger
+func (r *Reader) GetOperations(ctx context.Context, param spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	rows, err := r.query(ctx, fmt.Sprintf(`SELECT DISTINCT "%s", "%s" FROM "%s" WHERE "%s" = '%s'`,
+		common.OperationNameKey, common.SpanKindTagKey, r.spanMetaMeasurement,
+		common.ServiceNameKey, dbmodel.EscapeSQLString(param.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	var operations []spanstore.Operation
+	for _, row := range rows {
+		operation, ok := row[common.OperationNameKey].(string)
+		if !ok || operation == "" {
+			continue
+		}
+		kind, _ := row[common.SpanKindTagKey].(string)
+		if kind == "" {
+			// Spans written before kinds were recorded; only visible when the
+			// caller does not filter by kind.
+			if param.SpanKind == "" {
+				operations = append(operations, spanstore.Operation{Name: operation})
+			}
+			continue
+		}
+		if param.SpanKind != "" && kind != param.SpanKind {
+			continue
+		}
+		operations = append(operations, spanstore.Operation{
+			Name:     operation,
+			SpanKind: kind,
+		})
+	}
+
+	return operations, nil
+}
+
+// FindTraces retrieve traces that match the traceQuery
+func (r *Reader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.FindTraces)
+	defer cancel()
+
+	traceIDs, err := r.FindTraceIDs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(traceIDs) == 0 {
+		return nil, nil
+	}
+
+	q := dbmodel.NewSQLTraceQuery(r.spanMeasurement)
+	if !query.StartTimeMin.IsZero() {
+		q.StartTimeMin(query.StartTimeMin)
+	}
+	rows, err := r.query(ctx, q.BuildTraceQuery(traceIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	traces, err := dbmodel.TracesFromFlatSQLRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, trace := range traces {
+		dbmodel.ComputeTraceStatistics(trace)
+		for _, adjust := range r.adjusters {
+			adjust(trace)
+		}
+	}
+
+	return traces, nil
+}
+
+// GetTrace takes a traceID and returns a Trace associated with that traceID
+func (r *Reader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.GetTrace)
+	defer cancel()
+
+	q := dbmodel.NewSQLTraceQuery(r.spanMeasurement).
+		StartTimeMin(time.Now().Add(-r.defaultLookback))
+	rows, err := r.query(ctx, q.BuildTraceQuery([]model.TraceID{traceID}))
+	if err != nil {
+		return nil, err
+	}
+
+	traces, err := dbmodel.TracesFromFlatSQLRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(traces) == 0 {
+		return nil, spanstore.ErrTraceNotFound
+	}
+	if len(traces) > 1 {
+		// Both encodings of a 128-bit trace ID can match; combine them rather
+		// than failing the lookup.
+		r.logger.Warn("GetTrace returned more than one trace; merging", "traces", len(traces))
+		traces = []*model.Trace{dbmodel.MergeTraceSpans(traces)}
+	}
+
+	dbmodel.ComputeTraceStatistics(traces[0])
+	for _, adjust := range r.adjusters {
+		adjust(traces[0])
+	}
+
+	return traces[0], nil
+}
+
+// FindTraceIDs retrieve traceIDs that match the traceQuery
+func (r *Reader) FindTraceIDs(ctx context.Context, query *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.FindTraceIDs)
+	defer cancel()
+
+	query, err := dbmodel.NormalizeTraceQueryParams(query, r.defaultLookback)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.query(ctx, dbmodel.SQLTraceQueryFromTQP(r.spanMeasurement, query).BuildTraceIDQuery())
+	if err != nil {
+		return nil, err
+	}
+
+	return dbmodel.TraceIDsFromSQLRows(rows)
+}
+
+// GetDependencies returns all inter-service dependencies. The
+// dependencystore.Reader interface predates context; callers that have one
+// should use GetDependenciesWithContext instead.
+func (r *Reader) GetDependencies(endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	return r.GetDependenciesWithContext(context.Background(), endTs, lookback)
+}
+
+// GetDependenciesWithContext is GetDependencies honoring the caller's context.
+func (r *Reader) GetDependenciesWithContext(ctx context.Context, endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	ctx, cancel := common.BoundContext(ctx, r.timeouts.GetDependencies)
+	defer cancel()
+
+	rows, err := r.query(ctx, fmt.Sprintf(`SELECT "%s", "%s" FROM "%s" WHERE "time" >= '%s' AND "time" <= '%s'`,
+		common.ServiceNameKey, common.FlatSpanKey, r.spanMeasurement,
+		endTs.Add(-lookback).UTC().Format(time.RFC3339Nano), endTs.UTC().Format(time.RFC3339Nano)))
+	if err != nil {
+		return nil, err
+	}
+
+	return dbmodel.DependencyLinksFromFlatSQLRows(rows)
+}
+
+// GetDependencyPaths returns the transitive caller and callee paths through
+// the given service, each path bounded by maxDepth hops.
+func (r *Reader) GetDependencyPaths(endTs time.Time, lookback time.Duration, service string, maxDepth int) (upstream, downstream []dbmodel.DependencyPath, err error) {
+	links, err := r.GetDependencies(endTs, lookback)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dbmodel.UpstreamDependencyPaths(links, service, maxDepth),
+		dbmodel.DownstreamDependencyPaths(links, service, maxDepth), nil
+}
@@ -0,0 +1,113 @@
+// Package storev3 implements the Jaeger storage interfaces against InfluxDB
+// 3.x (IOx), where Flux is deprecated and SQL is the query language. Spans
+// live in the flat single-point schema, whose tags and fields become plain
+// table columns on the new engine. Queries go over the v3 HTTP SQL endpoint;
+// SQL over Arrow Flight speaks the same dialect to the same engine, and the
+// transport is isolated in SQLService so a Flight client can replace it once
+// the vendored Arrow supports one.
+package storev3
+
+import (
+	"io"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/influxdata/jaeger-influxdb/common"
+	"github.com/influxdata/jaeger-influxdb/config"
+	"github.com/influxdata/jaeger-influxdb/dbmodel"
+	"github.com/jaegertracing/jaeger/plugin/storage/grpc/shared"
+	"github.com/jaegertracing/jaeger/storage/dependencystore"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ shared.StoragePlugin = (*Store)(nil)
+	_ io.Closer            = (*Store)(nil)
+)
+
+type Store struct {
+	reader *Reader
+	writer *Writer
+}
+
+func NewStore(conf *config.Configuration, logger hclog.Logger) (*Store, func() error, error) {
+	client := &SQLService{
+		Addr:               conf.Host,
+		Token:              conf.Token,
+		Database:           conf.V3Database,
+		InsecureSkipVerify: conf.UnsafeSsl,
+	}
+
+	spanMeasurement := conf.FlatSpanMeasurement
+	if spanMeasurement == "" {
+		spanMeasurement = common.DefaultSpanMeasurement
+	}
+
+	reader := NewReader(client, spanMeasurement, common.DefaultSpanMetaMeasurement, conf.DefaultLookback, logger)
+	if len(conf.Adjusters) > 0 {
+		adjusters, err := dbmodel.NewAdjusterPipeline(conf.Adjusters, conf.ClockSkewMaxAdjust)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader.SetAdjusters(adjusters)
+	}
+	if conf.LogQueries {
+		reader.SetLogQueries()
+	}
+	reader.SetQueryTimeouts(common.QueryTimeouts{
+		GetTrace:        conf.GetTraceTimeout,
+		FindTraceIDs:    conf.FindTraceIDsTimeout,
+		FindTraces:      conf.FindTracesTimeout,
+		GetServices:     conf.GetServicesTimeout,
+		GetDependencies: conf.GetDependenciesTimeout,
+	})
+
+	maxLogBytes := conf.MaxEmbeddedLogBytes
+	if maxLogBytes <= 0 {
+		maxLogBytes = common.DefaultMaxEmbeddedLogBytes
+	}
+	writer := NewWriter(client, spanMeasurement, common.DefaultSpanMetaMeasurement, maxLogBytes, logger)
+	writer.SetChecksums(conf.SpanChecksums)
+	writer.SetFlushPolicy(conf.WriteFlushPoints, conf.WriteFlushInterval)
+	if conf.WriteQueueSize > 0 {
+		switch conf.WriteQueuePolicy {
+		case "", common.QueuePolicyBlock, common.QueuePolicyDropNew, common.QueuePolicyDropOld:
+		default:
+			return nil, nil, errors.Errorf("unrecognized write-queue-policy '%s'", conf.WriteQueuePolicy)
+		}
+		writer.SetWriteQueue(common.NewWriteQueue(conf.WriteQueueSize, conf.WriteQueuePolicy))
+	}
+	if conf.WALDir != "" {
+		wal, err := common.NewWriteWAL(conf.WALDir, conf.WALSegmentBytes, conf.WALMaxBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		writer.SetWAL(wal)
+	}
+	if conf.LogCompressionThreshold > 0 {
+		writer.SetLogCompressionThreshold(conf.LogCompressionThreshold)
+	}
+
+	store := &Store{
+		reader: reader,
+		writer: writer,
+	}
+
+	return store, store.Close, nil
+}
+
+func (s *Store) Close() error {
+	return s.writer.Close()
+}
+
+func (s *Store) SpanReader() spanstore.Reader {
+	return s.reader
+}
+
+func (s *Store) SpanWriter() spanstore.Writer {
+	return s.writer
+}
+
+func (s *Store) DependencyReader() dependencystore.Reader {
+	return s.reader
+}
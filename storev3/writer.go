@@ -0,0 +1,251 @@
+package storev3
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/jaeger-influxdb/common"
+	"github.com/influxdata/jaeger-influxdb/dbmodel"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/pkg/errors"
+)
+
+var _ spanstore.Writer = (*Writer)(nil)
+var _ io.Closer = (*Writer)(nil)
+
+// Writer handles all writes to InfluxDB 3.x for the Jaeger data model.
+// Spans are written in the flat single-point schema, which maps one span to
+// one table row and so reads back naturally over SQL.
+type Writer struct {
+	client              *SQLService
+	spanMeasurement     string
+	spanMetaMeasurement string
+	maxEmbeddedLogBytes int
+	logCompressThresh   int
+	checksums           bool
+	flushPoints         int
+	flushInterval       time.Duration
+
+	// Points as line protocol
+	writeCh chan string
+	writeWG sync.WaitGroup
+	queue   *common.WriteQueue
+	queueWG sync.WaitGroup
+
+	wal           *common.WriteWAL
+	walWG         sync.WaitGroup
+	flushFailures uint64
+
+	metaCache *common.WriterMetaCache
+
+	logger hclog.Logger
+}
+
+// NewWriter returns a Writer for InfluxDB 3.x
+func NewWriter(client *SQLService, spanMeasurement, spanMetaMeasurement string, maxEmbeddedLogBytes int, logger hclog.Logger) *Writer {
+	w := &Writer{
+		client:              client,
+		spanMeasurement:     spanMeasurement,
+		spanMetaMeasurement: spanMetaMeasurement,
+		maxEmbeddedLogBytes: maxEmbeddedLogBytes,
+
+		writeCh:       make(chan string),
+		metaCache:     common.NewWriterMetaCache(common.MetaCacheInterval),
+		flushPoints:   common.MaxFlushPoints,
+		flushInterval: common.MaxFlushInterval,
+
+		logger: logger,
+	}
+
+	w.writeWG.Add(1)
+
+	go w.batchAndWrite()
+
+	return w
+}
+
+// Close triggers a graceful shutdown
+func (w *Writer) Close() error {
+	// A replay still in flight must finish submitting before the channels
+	// close under it.
+	w.walWG.Wait()
+	if w.queue != nil {
+		w.queue.Close()
+		w.queueWG.Wait()
+	}
+	close(w.writeCh)
+	w.writeWG.Wait()
+	if w.wal != nil {
+		if atomic.LoadUint64(&w.flushFailures) == 0 {
+			// Every point reached InfluxDB; nothing to replay next run.
+			if err := w.wal.Truncate(); err != nil {
+				w.logger.Warn("failed to truncate write-ahead log", "error", err)
+			}
+		}
+		return w.wal.Close()
+	}
+	return nil
+}
+
+// SetChecksums stores an integrity checksum field on each span point.
+func (w *Writer) SetChecksums(checksums bool) {
+	w.checksums = checksums
+}
+
+// SetLogCompressionThreshold compresses embedded log payloads of at least
+// threshold bytes; smaller payloads stay plaintext.
+func (w *Writer) SetLogCompressionThreshold(threshold int) {
+	w.logCompressThresh = threshold
+}
+
+// SetFlushPolicy overrides when buffered points are flushed to InfluxDB: a
+// batch is written once it holds points points or once interval has passed
+// since its first point, whichever comes first. Zero keeps the corresponding
+// default. Call before the first span is written.
+func (w *Writer) SetFlushPolicy(points int, interval time.Duration) {
+	if points > 0 {
+		w.flushPoints = points
+	}
+	if interval > 0 {
+		w.flushInterval = interval
+	}
+}
+
+// SetWriteQueue bounds the points buffered ahead of the batching flusher;
+// see common.WriteQueue for the full-queue policies. Call before the first
+// span is written.
+func (w *Writer) SetWriteQueue(queue *common.WriteQueue) {
+	w.queue = queue
+	w.queueWG.Add(1)
+	go func() {
+		defer w.queueWG.Done()
+		queue.Drain(func(line string) { w.writeCh <- line })
+	}()
+}
+
+// SetWAL persists each submitted point to the given write-ahead log before
+// it is queued, and replays what the log already holds, so points buffered
+// by an earlier run survive a plugin restart or a short InfluxDB outage.
+// Replayed points that were already written overwrite themselves harmlessly.
+// Call before the first span is written.
+func (w *Writer) SetWAL(wal *common.WriteWAL) {
+	w.wal = wal
+	w.walWG.Add(1)
+	go func() {
+		defer w.walWG.Done()
+		if err := wal.Replay(w.submit); err != nil {
+			w.logger.Warn("failed to replay write-ahead log", "error", err)
+		}
+	}()
+}
+
+// submit hands one point to the flusher, through the write-ahead log and
+// the bounded queue when they are configured.
+func (w *Writer) submit(line string) {
+	if w.wal != nil {
+		if err := w.wal.Append(line); err != nil {
+			w.logger.Warn("failed to append to write-ahead log", "error", err)
+		}
+	}
+	if w.queue != nil {
+		if !w.queue.Push(line) {
+			if dropped := w.queue.Dropped(); dropped == 1 || dropped%1000 == 0 {
+				w.logger.Warn("write queue full; dropping points",
+					"dropped", dropped, "depth", w.queue.Depth())
+			}
+		}
+		return
+	}
+	w.writeCh <- line
+}
+
+// WriteSpan saves the span into InfluxDB
+func (w *Writer) WriteSpan(span *model.Span) error {
+	point, err := dbmodel.SpanToSinglePointV2(span, w.spanMeasurement, w.maxEmbeddedLogBytes, w.logCompressThresh, w.checksums, w.logger)
+	if err != nil {
+		return err
+	}
+	w.submit(point.String())
+
+	// The span kind is part of the meta cache key, so one operation served
+	// under several kinds yields one meta point per kind.
+	kind := dbmodel.SpanKind(span)
+	if w.metaCache.ShouldWrite(span.Process.ServiceName, span.OperationName+"|"+kind, span.StartTime) {
+		tags := models.NewTags(map[string]string{
+			common.ServiceNameKey:   span.Process.ServiceName,
+			common.OperationNameKey: span.OperationName,
+		})
+		if kind != "" {
+			tags.SetString(common.SpanKindTagKey, kind)
+		}
+		fields := models.Fields{
+			"v": true,
+		}
+		point, err := models.NewPoint(w.spanMetaMeasurement, tags, fields, span.StartTime)
+		if err != nil {
+			return errors.Wrap(err, "failed to create meta point")
+		}
+
+		w.submit(point.String())
+	}
+
+	return nil
+}
+
+func (w *Writer) batchAndWrite() {
+	defer w.writeWG.Done()
+
+	batch := make([]string, 0, w.flushPoints)
+	var t <-chan time.Time
+
+	for {
+		select {
+		case point, ok := <-w.writeCh:
+			if !ok {
+				if len(batch) > 0 {
+					w.writeBatch(batch)
+				}
+				return
+			}
+
+			if t == nil {
+				t = time.After(w.flushInterval)
+			}
+
+			batch = append(batch, point)
+
+			if len(batch) >= w.flushPoints {
+				w.writeBatch(batch)
+				batch = batch[:0]
+				t = nil
+			}
+
+		case <-t:
+			w.writeBatch(batch)
+			batch = batch[:0]
+			t = nil
+		}
+	}
+}
+
+func (w *Writer) writeBatch(batch []string) {
+	buf := bytes.NewBuffer([]byte{})
+	for _, point := range batch {
+		_, _ = buf.WriteString(point)
+		_, _ = buf.WriteRune('\n')
+	}
+
+	if err := w.client.Write(context.TODO(), buf); err != nil {
+		atomic.AddUint64(&w.flushFailures, 1)
+		w.logger.Warn("failed to write batch", "error", err)
+		return
+	}
+	w.logger.Warn("wrote points to InfluxDB", "quantity", len(batch))
+}